@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+	"github.com/sirgallo/quicfiletransfer/common/serialize"
+)
+
+
+//============================================= Adaptive Streams
+
+
+// adaptStreams
+//	The scheduler for auto mode, run for the duration of a transfer attempt.
+//	Every sample interval, the throughput over the interval is compared against the previous interval:
+//		- after adding streams, if throughput improved by more than the gain threshold (and RTT is not inflated), add more
+//		- after adding streams, if throughput did not improve, retire the streams that were just added
+//		- after retiring streams, if throughput dropped, add them back
+//		- while holding steady, periodically probe by adding a stream, or retire one if RTT shows the path is queueing
+//	Reverting a step is not itself treated as exploration, so the scheduler settles instead of oscillating.
+//	This converges on the smallest number of streams that achieves the best throughput for the path.
+//	The scheduler never grows beyond the client's maximum or the per request maximum the server negotiated.
+func (cli *QuicClient) adaptStreams(
+	ctx context.Context,
+	session *clientConn,
+	commStream quic.Stream,
+	transfer *fileTransfer,
+	initial, serverMaxStreams int,
+) {
+	ticker := time.NewTicker(AUTO_SAMPLE_INTERVAL)
+	defer ticker.Stop()
+
+	maxStreams := cli.maxAutoStreams()
+	if serverMaxStreams > 0 && serverMaxStreams < maxStreams { maxStreams = serverMaxStreams }
+	active := initial
+	lastStep := 0
+	lastThroughput := float64(0)
+	lastBytes := transfer.tracker.bytesCompleted()
+	ticksHeld := 0
+
+	adjust := func(step int, explore bool) {
+		if active + step > maxStreams { step = maxStreams - active }
+		if active + step < 1 { step = 1 - active }
+		if step == 0 { 
+			lastStep = 0
+			return 
+		}
+
+		msgType := protocol.ADD_STREAMS
+		count := step
+		if step < 0 {
+			msgType = protocol.RETIRE_STREAMS
+			count = -step
+		}
+
+		writeErr := protocol.WriteMessage(commStream, msgType, serialize.SerializeUint16(uint16(count)))
+		if writeErr != nil { return }
+
+		active += step
+		ticksHeld = 0
+		lastStep = 0
+		if explore { lastStep = step }
+
+		transfer.logger.Debug("adjusted streams", logger.F("streams", active), logger.F("step", step))
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_STREAMS_CHANGED, Streams: active })
+	}
+
+	for {
+		select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+		}
+
+		bytesCompleted := transfer.tracker.bytesCompleted()
+		throughput := float64(bytesCompleted - lastBytes) / AUTO_SAMPLE_INTERVAL.Seconds()
+		lastBytes = bytesCompleted
+
+		smoothedRTT, minRTT := session.stats.rtt()
+		queueingDelay := smoothedRTT - minRTT
+		rttInflated := minRTT > 0 && smoothedRTT > minRTT * AUTO_RTT_INFLATION && queueingDelay > AUTO_MIN_QUEUEING_DELAY
+
+		transfer.logger.Debug("stream throughput sample",
+			logger.F("streams", active),
+			logger.F("throughput", int64(throughput)),
+			logger.F("perStream", int64(throughput / float64(active))),
+			logger.F("rtt", smoothedRTT),
+			logger.F("minRtt", minRTT),
+		)
+
+		remainingBytes := transfer.fileSize - bytesCompleted
+		if float64(remainingBytes) < throughput * AUTO_SAMPLE_INTERVAL.Seconds() * 2 { return }
+
+		switch {
+			case lastThroughput == 0:
+				adjust(active, true)
+			case lastStep > 0 && throughput > lastThroughput * (1 + AUTO_GAIN_THRESHOLD) && ! rttInflated:
+				grow := active / 2
+				if grow < 1 { grow = 1 }
+				adjust(grow, true)
+			case lastStep > 0:
+				adjust(-lastStep, false)
+			case lastStep < 0 && throughput < lastThroughput * (1 - AUTO_GAIN_THRESHOLD):
+				adjust(-lastStep, false)
+			default:
+				lastStep = 0
+				ticksHeld++
+				if ticksHeld >= AUTO_PROBE_INTERVAL {
+					if rttInflated { 
+						adjust(-1, true) 
+					} else { adjust(1, true) }
+				}
+		}
+
+		lastThroughput = throughput
+	}
+}
+
+// maxAutoStreams
+//	The upper bound on streams in auto mode. The configured stream count is used as the bound if provided.
+func (cli *QuicClient) maxAutoStreams() int {
+	if cli.streams == 0 { return DEFAULT_AUTO_MAX_STREAMS }
+	return int(cli.streams)
+}
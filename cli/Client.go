@@ -2,25 +2,20 @@ package cli
 
 import (
 	"bytes"
-	"context"
-	"crypto/tls"
-	"errors"
-	"io"
-	"log"
+	"encoding/hex"
 	"net"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strconv"
-	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/quic-go/quic-go"
-
 	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/attrs"
+	"github.com/sirgallo/quicfiletransfer/common/delta"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
 	"github.com/sirgallo/quicfiletransfer/common/md5"
-	"github.com/sirgallo/quicfiletransfer/common/serialize"
+	"github.com/sirgallo/quicfiletransfer/common/pool"
+	"github.com/sirgallo/quicfiletransfer/common/ratelimit"
 )
 
 
@@ -31,283 +26,300 @@ import (
 //	Create a new quic file transfer client.
 func NewClient(opts *QuicClientOpts) (*QuicClient, error) {
 	remoteHostPort := net.JoinHostPort(opts.RemoteHost, strconv.Itoa(opts.RemotePort))
-	log.Printf("remote server address: %s\n", remoteHostPort)
+
+	cliLogger := opts.Logger
+	if cliLogger == nil { cliLogger = logger.NewNopLogger() }
+	cliLogger.Debug("remote server address", logger.F(logger.REMOTE_ADDR_KEY, remoteHostPort))
+
+	tuningErr := opts.Tuning.Validate()
+	if tuningErr != nil { return nil, tuningErr }
+
+	retry := opts.Retry
+	if retry == nil { retry = DefaultRetryPolicy() }
+
+	memoryBudget := opts.MemoryBudget
+	if memoryBudget <= 0 { memoryBudget = DEFAULT_MEMORY_BUDGET }
+
+	bufferPool := pool.NewBoundedBufferPool(WRITE_BUFFER_SIZE, memoryBudget)
+	if opts.DirectIO { bufferPool = pool.NewAlignedBufferPool(WRITE_BUFFER_SIZE, DIRECT_IO_ALIGNMENT, memoryBudget) }
 
 	return &QuicClient{ 
 		remoteAddress: remoteHostPort,
 		cliPort: opts.ClientPort,
 		streams: opts.Streams,
+		autoStreams: opts.AutoStreams,
 		checkMd5: opts.CheckMd5,
+		delta: opts.Delta,
+		compression: opts.Compression,
+		preallocate: opts.Preallocate,
+		directIO: opts.DirectIO,
+		preserve: opts.Preserve,
+		keepPartial: opts.KeepPartial,
+		overwrite: opts.Overwrite,
+		tuning: opts.Tuning,
+		logger: cliLogger,
+		retry: retry,
+		eventHandler: opts.EventHandler,
+		bufferPool: bufferPool,
+		limiter: ratelimit.NewLimiter(opts.MaxRate),
 	}, nil
 }
 
+// SetMaxRate
+//	Change the most bytes per second the client receives across all transfers. 0 is unlimited.
+func (cli *QuicClient) SetMaxRate(rate int64) {
+	cli.limiter.SetRate(rate)
+}
+
 // StartFileTransferStream
 //	Invoke a file transfer operation.
 //	The client provides the total number of streams to open.
-//	Once each stream receives a metadata response from the server, the file is resized.
+//	Once the client receives a metadata response from the server, the file is resized.
 //	The streams for the client connection then receive and write the file chunks from the server to disk.
+//	If an attempt fails with a transient error, the client backs off, reconnects, and re-requests only the ranges that were not yet written.
+//	The file is written to a partial file alongside the destination, which is synced to disk, verified, given the preserved attributes of the remote file, then renamed over the destination.
+//	Readers never see a half written file, and a failed transfer leaves any existing destination file untouched.
+//	In delta mode, an existing destination file is used as the basis for the new file.
+//	An existing destination file is handled by the client's overwrite policy first. A skipped transfer returns the path of the existing file.
 func (cli *QuicClient) StartFileTransferStream(connectOpts *OpenConnectionOpts, filename, src, dst string) (*string, error){
-	var clientWG sync.WaitGroup
+	transfer := cli.newFileTransfer(filepath.Join(src, filename), filepath.Join(dst, filename))
 
-	isResizing := uint64(0)
-	srcPath := filepath.Join(src, filename)
-	cli.dstFile = filepath.Join(dst, filename)
-	
-	f, createErr := os.Create(cli.dstFile)
-	if createErr != nil { return nil, createErr }
-	f.Close()
-
-	conn, connErr := cli.openConnection(connectOpts)
-	if connErr != nil { return nil, connErr }
-	defer conn.CloseWithError(common.NO_ERROR, "closing")
-
-	commStream, openCommStreamErr := conn.OpenStream()
-	if openCommStreamErr != nil {
-		conn.CloseWithError(common.CONNECTION_ERROR, openCommStreamErr.Error())
-		return nil, openCommStreamErr
+	skip, conflictErr := cli.resolveConflict(connectOpts, transfer)
+	if conflictErr != nil {
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_FAILED, Err: conflictErr })
+		return nil, conflictErr
 	}
 
-	fileReq := func() []byte {
-		tags := []byte{ cli.streams }
-		return append(tags, []byte(srcPath)...)
-	}()
-
-	_, fileReqErr := commStream.Write(fileReq)
-	if fileReqErr != nil {
-		conn.CloseWithError(common.TRANSPORT_ERROR, fileReqErr.Error())
-		return nil, fileReqErr
+	if skip {
+		transfer.logger.Info("destination exists, skipping transfer", logger.F("policy", cli.overwrite))
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_SKIPPED })
+		return &transfer.dstFile, nil
 	}
 
-	buf := make([]byte, common.FILE_META_PAYLOAD_MAX_LENGTH)
-	payloadLength, readPayloadErr := commStream.Read(buf)
-	if readPayloadErr != nil {
-		conn.CloseWithError(common.TRANSPORT_ERROR, readPayloadErr.Error())
-		return nil, readPayloadErr
-	}
+	return cli.transferFile(connectOpts, transfer)
+}
 
-	remoteFileSize, sourceMd5, desMetaErr := cli.deserializeMetaPayload(buf[:payloadLength])
-	if desMetaErr != nil {
-		conn.CloseWithError(common.INTERNAL_ERROR, desMetaErr.Error())
-		return nil, desMetaErr
+// newFileTransfer
+//	Create the state for transferring a remote file to a local path.
+func (cli *QuicClient) newFileTransfer(srcPath, dstFile string) *fileTransfer {
+	transfer := &fileTransfer{ srcPath: srcPath, dstFile: dstFile, writePath: partialPath(dstFile) }
+	transfer.logger = cli.logger.With(logger.F(logger.REMOTE_ADDR_KEY, cli.remoteAddress), logger.F(logger.PATH_KEY, transfer.srcPath))
+	return transfer
+}
+
+// transferFile
+//	Transfer the file, retrying failed attempts, then verify it and move it into place.
+//	A partial file moved aside to resume from is restored if the transfer fails before any data is written.
+func (cli *QuicClient) transferFile(connectOpts *OpenConnectionOpts, transfer *fileTransfer) (*string, error) {
+	selectErr := cli.selectBasis(transfer)
+	if selectErr != nil {
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_FAILED, Err: selectErr })
+		return nil, selectErr
 	}
 
-	resizeErr := cli.resizeDstFile(&isResizing, int64(remoteFileSize))
-	if resizeErr != nil {
-		conn.CloseWithError(common.INTERNAL_ERROR, resizeErr.Error())
-		return nil, resizeErr
+	dstHandle, openDstErr := cli.openDestination(transfer)
+	if openDstErr != nil {
+		transfer.logger.Error("unable to open destination", logger.Err(openDstErr))
+		cli.discardPartial(transfer)
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_FAILED, Err: openDstErr })
+		return nil, openDstErr
 	}
 
+	defer dstHandle.close()
+
+	transfer.dst = dstHandle
+
 	streamStartTime := time.Now()
+	cli.emit(transfer, &TransferEvent{ Type: TRANSFER_STARTED })
 
-	clientWG.Add(1)
-	go func() {
-		defer clientWG.Done()
-		
-		totBytes := uint64(0)
-		for {
-			buf := make([]byte, 8)
-			_, readErr := commStream.Read(buf)
-			if readErr == io.EOF {
-				log.Println("done") 
-				return 
-			}
-
-			if readErr != nil {
-				conn.CloseWithError(common.TRANSPORT_ERROR, readErr.Error()) 
-				return 
-			}
-
-			chunkBytes, desErr := serialize.DeserializeUint64(buf)
-			if desErr != nil {
-				conn.CloseWithError(common.INTERNAL_ERROR, desErr.Error()) 
-				return 
-			}
-
-			totBytes += chunkBytes
-
-			p := (float64(totBytes) / float64(remoteFileSize)) * 100
-			currTime := time.Now()
-			log.Printf("total bytes received: %d, percentage of total: %f, time elapsed: %v\n", totBytes, p, currTime.Sub(streamStartTime))
-		}
-	}()
+	for {
+		transfer.attempt++
 
-	for range make([]uint8, cli.streams) {
-		dataStream, openSendStreamErr := conn.AcceptUniStream(context.Background())
-		if openSendStreamErr != nil { 
-			conn.CloseWithError(common.CONNECTION_ERROR, openSendStreamErr.Error())
-			return nil, openSendStreamErr
+		attemptErr := cli.runTransferAttempt(connectOpts, transfer)
+		if attemptErr == nil { break }
+
+		if ! cli.retry.shouldRetry(transfer.attempt, attemptErr) {
+			transfer.logger.Error("file transfer failed", logger.F("attempt", transfer.attempt), logger.Err(attemptErr))
+			cli.discardPartial(transfer)
+			cli.emit(transfer, &TransferEvent{ Type: TRANSFER_FAILED, Err: attemptErr })
+			return nil, attemptErr
 		}
 
-		go func() {
-			buf := make([]byte, common.CHUNK_META_PAYLOAD_MAX_LENGTH)
-			payloadLength, readPayloadErr := dataStream.Read(buf)
-			if readPayloadErr != nil { 
-				conn.CloseWithError(common.TRANSPORT_ERROR, readPayloadErr.Error())
-				return
-			}
-		
-			startOffset, chunkSize, desErr := cli.deserializeChunkPayload(buf[:payloadLength])
-			if desErr != nil {
-				conn.CloseWithError(common.INTERNAL_ERROR, desErr.Error())
-				return
-			}
-	
-			log.Printf("startOffset: %d, chunkSize: %d\n", startOffset, chunkSize)
-	
-			f, openErr := os.OpenFile(cli.dstFile, os.O_RDWR, 0666)
-			if openErr != nil { return }
-			defer f.Close()
-	
-			_, seekErr := f.Seek(int64(startOffset), 0)
-			if seekErr != nil { 
-				conn.CloseWithError(common.INTERNAL_ERROR, seekErr.Error())
-				return
-			}
-	
-			writeBuffer := make([]byte, WRITE_BUFFER_SIZE)
-			totalBytesRead := 0
-
-			for int(chunkSize) > totalBytesRead {
-				nRead, readErr := io.ReadFull(dataStream, writeBuffer)
-				if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
-					conn.CloseWithError(common.TRANSPORT_ERROR, readErr.Error())
-					return
-				}
-
-				nWritten, writeErr := f.Write(writeBuffer[:nRead])
-				if writeErr != nil {
-					conn.CloseWithError(common.INTERNAL_ERROR, writeErr.Error())
-					return
-				}
-
-				totalBytesRead += nWritten
-			}
-		}()
-	}
+		delay := cli.retry.backoff(transfer.attempt)
+		transfer.logger.Warn("file transfer attempt failed, retrying",
+			logger.F("attempt", transfer.attempt),
+			logger.F("delay", delay),
+			logger.Err(attemptErr),
+		)
 
-	clientWG.Wait()
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_RETRY, RetryDelay: delay, Err: attemptErr })
+		time.Sleep(delay)
+	}
 
-	streamEndTime := time.Now()
-	streamElapsedTime := streamEndTime.Sub(streamStartTime)
+	finishErr := cli.finishTransfer(transfer)
+	if finishErr != nil {
+		cli.discardPartial(transfer)
+		cli.emit(transfer, &TransferEvent{ Type: TRANSFER_FAILED, Err: finishErr })
+		return nil, finishErr
+	}
 
-	log.Println("file transfer complete, connection can now close")
-	log.Println("total elapsed time for file transfer", streamElapsedTime)
+	streamElapsedTime := time.Since(streamStartTime)
+	transfer.logger.Info("file transfer complete", 
+		logger.F("bytes", transfer.fileSize), 
+		logger.F("attempts", transfer.attempt), 
+		logger.F("elapsed", streamElapsedTime),
+	)
 
-	if cli.checkMd5 { return cli.performMd5Check(sourceMd5) }
-	return &cli.dstFile, nil
+	cli.emit(transfer, &TransferEvent{ Type: TRANSFER_COMPLETE })
+	return &transfer.dstFile, nil
 }
 
-// openConnection
-//	Open a connection to a http3 server running over quic.
-//	The DialEarly function attempts to make a connection using 0-RTT.
-func (cli *QuicClient) openConnection(opts *OpenConnectionOpts) (quic.Connection, error) {
-	tlsConfig := &tls.Config{ InsecureSkipVerify: opts.Insecure, NextProtos: []string{ common.FTRANSFER_PROTO }}
-	quicConfig := &quic.Config{ EnableDatagrams: true }
+// selectBasis
+//	Pick the existing file unchanged blocks are copied from, if any.
+//	With KeepPartial, a partial file left by an earlier failed transfer is moved aside and used as the basis, so the data it already holds is not sent again.
+//	Otherwise in delta mode, the current destination file is the basis.
+func (cli *QuicClient) selectBasis(transfer *fileTransfer) error {
+	if cli.keepPartial && isBasisCandidate(transfer.writePath) {
+		resumePath := transfer.writePath + RESUME_SUFFIX
+		renameErr := os.Rename(transfer.writePath, resumePath)
+		if renameErr != nil { return renameErr }
+
+		transfer.logger.Info("resuming from partial file", logger.F("partial", transfer.writePath))
+		transfer.basisFile = resumePath
+		transfer.resumed = true
+		return nil
+	}
 
-	udpAddr, getAddrErr := net.ResolveUDPAddr(common.NET_PROTOCOL, cli.remoteAddress)
-	if getAddrErr != nil { return nil, getAddrErr }
+	if cli.delta && isBasisCandidate(transfer.dstFile) { transfer.basisFile = transfer.dstFile }
+	return nil
+}
 
-	udpConn, udpErr := net.ListenUDP(common.NET_PROTOCOL, &net.UDPAddr{ Port: cli.cliPort })
-	if udpErr != nil { return nil, udpErr }
-	
-	ctx, cancel := context.WithTimeout(context.Background(), HANDSHAKE_TIMEOUT * time.Second)
-	defer cancel()
+// finishTransfer
+//	Sync the partial file to disk and verify it, then apply the preserved attributes and rename it over the destination.
+//	The md5 file is written once the destination is in place.
+func (cli *QuicClient) finishTransfer(transfer *fileTransfer) error {
+	syncErr := transfer.dst.sync()
+	if syncErr != nil { return syncErr }
 
-	tr := &quic.Transport{ Conn: udpConn }
-	conn, connErr := tr.DialEarly(ctx, udpAddr, tlsConfig, quicConfig)
-	if connErr != nil { return nil, connErr }
-	
-	log.Println("connection made with:", conn.RemoteAddr())
-	return conn, nil
-}
+	closeErr := transfer.dst.close()
+	if closeErr != nil { return closeErr }
 
-// deserializePayload
-//	Initial metadata payload with remote filesize and md5.
-//	Format:
-//		bytes 0-7: uint64 representing the size of the file
-//		bytes 8-23: md5 in byte format
-func (cli *QuicClient) deserializeMetaPayload(payload []byte) (uint64, []byte, error) {
-	if len(payload) != common.FILE_META_PAYLOAD_MAX_LENGTH { return 0, nil, errors.New("payload incorrect length") }
+	if cli.checkMd5 {
+		md5Err := cli.performMd5Check(transfer)
+		if md5Err != nil { return md5Err }
+	}
 
-	remoteFileSize, desFSizeErr := serialize.DeserializeUint64(payload[:8])
-	if desFSizeErr != nil { return 0, nil, desFSizeErr }
+	if cli.preserve != 0 && transfer.attrs != nil {
+		applyErr := attrs.Apply(transfer.writePath, transfer.attrs, cli.preserve)
+		if applyErr != nil { transfer.logger.Warn("unable to preserve some file attributes", logger.Err(applyErr)) }
+	}
 
-	return remoteFileSize, payload[8:], nil
-}
+	if cli.overwrite == OVERWRITE_RENAME {
+		backupErr := backupExisting(transfer)
+		if backupErr != nil { return backupErr }
+	}
 
-// deserializeChunkPayload
-//	Metadata payload regarding chunk size and start offset in file.
-//	Format:
-//		bytes 0-7: uint64 representing the start offset in the file where the stream should begin processing
-//		bytes 8-16: uint64 representing the size of the chunk being received by the stream
-func (cli *QuicClient) deserializeChunkPayload(payload []byte) (uint64, uint64, error) {
-	if len(payload) != common.CHUNK_META_PAYLOAD_MAX_LENGTH { return 0, 0, errors.New("payload incorrect length") }
-	
-	startOffset, desOffsetErr := serialize.DeserializeUint64(payload[:8])
-	if desOffsetErr != nil { return 0, 0, desOffsetErr }
+	renameErr := os.Rename(transfer.writePath, transfer.dstFile)
+	if renameErr != nil { return renameErr }
 
-	chunkSize, desChunkSizeErr := serialize.DeserializeUint64(payload[8:])
-	if desChunkSizeErr != nil { return 0, 0, desChunkSizeErr }
+	syncDirErr := syncDir(filepath.Dir(transfer.dstFile))
+	if syncDirErr != nil { transfer.logger.Debug("unable to sync destination directory", logger.Err(syncDirErr)) }
 
-	return startOffset, chunkSize, nil
+	if transfer.resumed { cli.removeLogged(transfer, transfer.basisFile) }
+	if ! cli.checkMd5 { return nil }
+
+	return writeMd5File(transfer.dstFile + common.MD5_SUFFIX, transfer.sourceMd5)
 }
 
-// resizeDstFile
-//	When the streams receive the metadata, the file created needs to be resized to match the size of the remote file.
-func (cli *QuicClient) resizeDstFile(isResizing *uint64, remoteFileSize int64) error {
-	f, openErr := os.OpenFile(cli.dstFile, os.O_RDWR, 0666)
-	if openErr != nil { return openErr }
-	defer f.Close()
-
-	fSize := int64(0)
-	for fSize != remoteFileSize {
-		stat, statErr := f.Stat()
-		if statErr != nil { return statErr }
-
-		fSize = stat.Size()
-		if atomic.CompareAndSwapUint64(isResizing, 0, 1) {				
-			truncateErr := f.Truncate(remoteFileSize)
-			if truncateErr != nil { return truncateErr }
-			break
-		}
+// discardPartial
+//	Clean up after a failed transfer. The partial file is removed, unless KeepPartial is set, where it is kept for inspection and to resume from on the next transfer.
+//	If the transfer resumed from an earlier partial file but failed before receiving any metadata, that file is put back as it was.
+func (cli *QuicClient) discardPartial(transfer *fileTransfer) {
+	transfer.dst.close()
 
-		runtime.Gosched()
+	if cli.keepPartial && transfer.resumed && transfer.tracker == nil {
+		restoreErr := os.Rename(transfer.basisFile, transfer.writePath)
+		if restoreErr != nil { transfer.logger.Warn("unable to restore partial file", logger.Err(restoreErr)) }
+		return
 	}
 
-	return nil
+	if transfer.resumed { cli.removeLogged(transfer, transfer.basisFile) }
+	if ! cli.keepPartial {
+		cli.removeLogged(transfer, transfer.writePath)
+		return
+	}
+
+	transfer.logger.Info("kept partial file", logger.F("partial", transfer.writePath))
+}
+
+// removeLogged
+//	Remove a file left over from a transfer, logging rather than returning a failure.
+func (cli *QuicClient) removeLogged(transfer *fileTransfer, path string) {
+	removeErr := os.Remove(path)
+	if removeErr != nil && ! os.IsNotExist(removeErr) { transfer.logger.Warn("unable to remove file", logger.F("file", path), logger.Err(removeErr)) }
 }
 
 // performMd5Check
-//	Optionally perform and md5 check on the transferred file.
-func (cli *QuicClient) performMd5Check(sourceMd5 []byte) (*string, error){
+//	Optionally perform and md5 check on the transferred file, before it is renamed into place.
+func (cli *QuicClient) performMd5Check(transfer *fileTransfer) error {
 	md5StartTime := time.Now()
-	log.Println("calculating md5 checksum")
+	transfer.logger.Debug("calculating md5 checksum")
 	
-	md5Bytes, md5Err := md5.CalculateMD5(cli.dstFile)
-	if md5Err != nil { return nil, md5Err }
-
-	md5EndTime := time.Now()
-	md5ElapsedTime := md5EndTime.Sub(md5StartTime)
-
-	log.Printf("calculated md5: %v, source md5: %v\n", md5Bytes, sourceMd5)
-	log.Println("total elapsed time for md5 calculation:", md5ElapsedTime)
-
-	if ! bytes.Equal(md5Bytes, sourceMd5) {
-		remErr := os.Remove(cli.dstFile)
-		if remErr != nil { return nil, remErr }
-		return nil, errors.New("md5 checksums did not match")
+	md5Bytes, md5Err := md5.CalculateMD5(transfer.writePath)
+	if md5Err != nil { return md5Err }
+
+	md5ElapsedTime := time.Since(md5StartTime)
+	transfer.logger.Debug("md5 calculated",
+		logger.F("md5", hex.EncodeToString(md5Bytes)),
+		logger.F("sourceMd5", hex.EncodeToString(transfer.sourceMd5)),
+		logger.F("elapsed", md5ElapsedTime),
+	)
+
+	if ! bytes.Equal(md5Bytes, transfer.sourceMd5) {
+		transfer.logger.Error("md5 checksums did not match")
+		return ErrMd5Mismatch
 	}
 
-	md5File, createFileErr := os.Create(cli.dstFile + ".md5")
-	if createFileErr != nil { return nil, createFileErr }
+	transfer.logger.Info("md5 check passed")
+	return nil
+}
+
+// writeMd5File
+//	Write the hex encoded md5 of a verified file alongside it.
+func writeMd5File(path string, md5Bytes []byte) error {
+	md5File, createFileErr := os.Create(path)
+	if createFileErr != nil { return createFileErr }
 	defer md5File.Close()
 
 	md5Hex, decodeErr := md5.DeserializeMD5ToHex(md5Bytes)
-	if decodeErr != nil { return nil, decodeErr }
+	if decodeErr != nil { return decodeErr }
 
 	_, md5WriteErr := md5File.Write([]byte(md5Hex))
-	if md5WriteErr != nil { return nil, md5WriteErr }
+	return md5WriteErr
+}
 
-	log.Println("md5 check passed, done")
-	return &cli.dstFile, nil
-}
\ No newline at end of file
+// partialPath
+//	The hidden file in the destination directory a transfer is written to before it is renamed into place.
+func partialPath(dstFile string) string {
+	return filepath.Join(filepath.Dir(dstFile), "." + filepath.Base(dstFile) + PARTIAL_SUFFIX)
+}
+
+// isBasisCandidate
+//	Check whether a file exists and is large enough to sign for a delta transfer.
+func isBasisCandidate(path string) bool {
+	basisStat, statErr := os.Stat(path)
+	return statErr == nil && basisStat.Mode().IsRegular() && basisStat.Size() >= delta.MIN_BLOCK_SIZE
+}
+
+// emit
+//	Send an event for the transfer to the client's event handler, if one was provided.
+func (cli *QuicClient) emit(transfer *fileTransfer, event *TransferEvent) {
+	if cli.eventHandler == nil { return }
+
+	event.Path = transfer.srcPath
+	event.Attempt = transfer.attempt
+	event.TotalBytes = transfer.fileSize
+	if transfer.tracker != nil { event.BytesTransferred = transfer.tracker.bytesCompleted() }
+
+	cli.eventHandler(event)
+}
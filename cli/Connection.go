@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+)
+
+
+//============================================= Client Connection
+
+
+// openConnection
+//	Open a connection to a http3 server running over quic.
+//	The DialEarly function attempts to make a connection using 0-RTT.
+//	The client's tuning is applied over the defaults, so a tuned limit on incoming streams replaces the one derived from the stream count.
+//	A tracer is attached to sample RTT from the congestion controller, which is used when adapting the stream count.
+//	The returned connection owns the udp connection and must be closed once the transfer is done.
+func (cli *QuicClient) openConnection(opts *OpenConnectionOpts) (*clientConn, error) {
+	stats := &connStats{}
+
+	tlsConfig := &tls.Config{ InsecureSkipVerify: opts.Insecure, NextProtos: []string{ common.FTRANSFER_PROTO }}
+	if opts.Certificate != nil { tlsConfig.Certificates = []tls.Certificate{ *opts.Certificate } }
+
+	quicConfig := &quic.Config{ 
+		EnableDatagrams: true,
+		MaxIncomingUniStreams: int64(cli.maxStreams()),
+		Tracer: func(ctx context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+			return &logging.ConnectionTracer{ UpdatedMetrics: stats.update }
+		},
+	}
+
+	cli.tuning.Apply(quicConfig)
+
+	udpAddr, getAddrErr := net.ResolveUDPAddr(common.NET_PROTOCOL, cli.remoteAddress)
+	if getAddrErr != nil { return nil, getAddrErr }
+
+	udpConn, udpErr := net.ListenUDP(common.NET_PROTOCOL, &net.UDPAddr{ Port: cli.cliPort })
+	if udpErr != nil { return nil, udpErr }
+	
+	ctx, cancel := context.WithTimeout(context.Background(), cli.handshakeTimeout())
+	defer cancel()
+
+	tr := &quic.Transport{ Conn: udpConn }
+	conn, connErr := tr.DialEarly(ctx, udpAddr, tlsConfig, quicConfig)
+	if connErr != nil { 
+		tr.Close()
+		udpConn.Close()
+		return nil, connErr 
+	}
+	
+	cli.logger.Debug("connection made", logger.F(logger.REMOTE_ADDR_KEY, conn.RemoteAddr()))
+	return &clientConn{ conn: conn, transport: tr, stats: stats }, nil
+}
+
+// close
+//	Close the connection, then the quic transport along with the udp connection it was created with, freeing the client port for the next connection.
+func (cc *clientConn) close() {
+	cc.conn.CloseWithError(common.NO_ERROR, "closing")
+	cc.transport.Close()
+	cc.transport.Conn.Close()
+}
+
+// maxStreams
+//	The most data streams the client will have open at once, used as the limit on streams the server may open to the client.
+func (cli *QuicClient) maxStreams() int {
+	if cli.autoStreams { return cli.maxAutoStreams() }
+	if cli.streams == 0 { return 1 }
+	
+	return int(cli.streams)
+}
+
+// handshakeTimeout
+//	The longest the client waits for a connection to be established.
+func (cli *QuicClient) handshakeTimeout() time.Duration {
+	if cli.tuning.HandshakeTimeout > 0 { return cli.tuning.HandshakeTimeout }
+	return HANDSHAKE_TIMEOUT * time.Second
+}
+
+// update
+//	Called by the tracer every time the congestion controller updates its metrics.
+func (stats *connStats) update(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
+	atomic.StoreInt64(&stats.smoothedRTT, int64(rttStats.SmoothedRTT()))
+	atomic.StoreInt64(&stats.minRTT, int64(rttStats.MinRTT()))
+}
+
+// rtt
+//	The latest smoothed and minimum RTT observed on the connection.
+func (stats *connStats) rtt() (time.Duration, time.Duration) {
+	return time.Duration(atomic.LoadInt64(&stats.smoothedRTT)), time.Duration(atomic.LoadInt64(&stats.minRTT))
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common/delta"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Client Delta
+
+
+// runDelta
+//	Sign the blocks of the existing copy of the file and send the signatures to the server on their own comm stream.
+//	The server responds with the metadata for the file and the blocks that can be reused.
+//	Reused blocks are copied from the existing file into the new one and marked complete,
+//	so only the ranges left over are requested from the server over the data streams.
+func (cli *QuicClient) runDelta(conn quic.Connection, transfer *fileTransfer) error {
+	basis, openErr := os.Open(transfer.basisFile)
+	if openErr != nil { return openErr }
+	defer basis.Close()
+
+	basisStat, statErr := basis.Stat()
+	if statErr != nil { return statErr }
+
+	signStartTime := time.Now()
+	blockSize := delta.BlockSizeFor(uint64(basisStat.Size()))
+	signatures, signErr := delta.ComputeSignatures(basis, blockSize)
+	if signErr != nil { return signErr }
+
+	transfer.logger.Debug("basis signed", 
+		logger.F("blockSize", blockSize), 
+		logger.F("blocks", len(signatures)), 
+		logger.F("elapsed", time.Since(signStartTime)),
+	)
+
+	deltaStream, openStreamErr := conn.OpenStream()
+	if openStreamErr != nil { return openStreamErr }
+	defer deltaStream.Close()
+
+	deltaReq := &protocol.DeltaRequest{ Path: transfer.srcPath, BlockSize: blockSize, Preserve: cli.preserve, Blocks: signatures }
+	writeReqErr := protocol.WriteMessage(deltaStream, protocol.DELTA_REQUEST, protocol.SerializeDeltaRequest(deltaReq))
+	if writeReqErr != nil { return writeReqErr }
+
+	payload, readPayloadErr := protocol.ExpectMessage(deltaStream, protocol.DELTA_META)
+	if readPayloadErr != nil { return readPayloadErr }
+
+	meta, desMetaErr := protocol.DeserializeDeltaMeta(payload)
+	if desMetaErr != nil { return desMetaErr }
+
+	initErr := cli.initTransfer(transfer, &protocol.FileMeta{ Size: meta.Size, Md5: meta.Md5, Attrs: meta.Attrs })
+	if initErr != nil { return initErr }
+
+	applyErr := cli.applyCopies(transfer, basis, uint64(basisStat.Size()), meta.Copies)
+	if applyErr != nil { return applyErr }
+
+	reused := transfer.tracker.bytesCompleted()
+	transfer.logger.Info("delta applied", 
+		logger.F("reused", reused), 
+		logger.F("remaining", transfer.fileSize - reused), 
+		logger.F("copies", len(meta.Copies)),
+	)
+
+	return nil
+}
+
+// applyCopies
+//	Copy each reused range from the existing file into the new file, marking it complete in the tracker.
+func (cli *QuicClient) applyCopies(transfer *fileTransfer, basis *os.File, basisSize uint64, copies []protocol.BlockCopy) error {
+	buf := cli.bufferPool.Get()
+	defer cli.bufferPool.Put(buf)
+
+	for _, c := range copies {
+		if c.Offset > transfer.fileSize || c.Length > transfer.fileSize - c.Offset { return errCopyOutOfRange }
+		if c.BasisOffset > basisSize || c.Length > basisSize - c.BasisOffset { return errCopyOutOfRange }
+
+		totalCopied := uint64(0)
+		for c.Length > totalCopied {
+			copySize := uint64(len(buf))
+			if c.Length - totalCopied < copySize { copySize = c.Length - totalCopied }
+
+			nRead, readErr := basis.ReadAt(buf[:copySize], int64(c.BasisOffset + totalCopied))
+			if uint64(nRead) < copySize { return readErr }
+
+			_, writeErr := transfer.dst.file.WriteAt(buf[:nRead], int64(c.Offset + totalCopied))
+			if writeErr != nil { return writeErr }
+
+			totalCopied += uint64(nRead)
+		}
+
+		transfer.tracker.complete(c.Offset, c.Length)
+	}
+
+	return nil
+}
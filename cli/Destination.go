@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Client Destination
+
+
+// openDestination
+//	Create the destination file once for the transfer. Every stream writes to the same file descriptor with positional writes.
+//	In direct io mode, a second descriptor is opened with O_DIRECT for aligned writes. If the filesystem does not support it, writes stay buffered.
+func (cli *QuicClient) openDestination(transfer *fileTransfer) (*destination, error) {
+	f, createErr := os.Create(transfer.writePath)
+	if createErr != nil { return nil, createErr }
+
+	dst := &destination{ file: f, alignment: 1 }
+	if ! cli.directIO { return dst, nil }
+
+	direct, openDirectErr := openDirect(transfer.writePath)
+	if openDirectErr != nil {
+		transfer.logger.Warn("direct io unavailable, using buffered writes", logger.Err(openDirectErr))
+		return dst, nil
+	}
+
+	dst.direct = direct
+	dst.alignment = DIRECT_IO_ALIGNMENT
+	return dst, nil
+}
+
+// resize
+//	Size the destination to match the remote file. Truncating leaves the file sparse, so the holes of a sparse remote file are recreated as is.
+//	With preallocation, blocks are reserved with fallocate, only for the data extents if the remote file is sparse. Where fallocate is unsupported, the file is left sparse.
+func (dst *destination) resize(size uint64, extents []protocol.Range, sparse, shouldPreallocate bool, transferLogger logger.Logger) error {
+	truncateErr := dst.file.Truncate(int64(size))
+	if truncateErr != nil { return truncateErr }
+	if ! shouldPreallocate { return nil }
+
+	if ! sparse { extents = []protocol.Range{{ Offset: 0, Length: size }} }
+	for _, extent := range extents {
+		preallocateErr := preallocate(dst.file, int64(extent.Offset), int64(extent.Length))
+		if preallocateErr != nil {
+			transferLogger.Warn("preallocation unavailable, leaving the file sparse", logger.Err(preallocateErr))
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// writeAt
+//	Write a slice of a chunk to the destination, returning the number of bytes written.
+//	The data is buf[lead:], where buf is a pooled buffer and lead is the offset modulo the alignment, so file blocks line up with the buffer.
+//	With O_DIRECT, the unaligned head up to the next block boundary is written through the buffered descriptor and whole blocks are written directly.
+//	A trailing partial block is left unwritten for the caller to carry into the next read, unless final is set because the chunk has no more data.
+func (dst *destination) writeAt(buf []byte, lead int, offset uint64, final bool) (int, error) {
+	data := buf[lead:]
+	if dst.direct == nil { return dst.file.WriteAt(data, int64(offset)) }
+
+	written := 0
+	if lead > 0 {
+		head := dst.alignment - lead
+		if head > len(data) { head = len(data) }
+
+		nHead, headErr := dst.file.WriteAt(data[:head], int64(offset))
+		written += nHead
+		if headErr != nil { return written, headErr }
+	}
+
+	body := (len(data) - written) / dst.alignment * dst.alignment
+	if body > 0 {
+		nBody, bodyErr := dst.direct.WriteAt(data[written:written + body], int64(offset) + int64(written))
+		written += nBody
+		if bodyErr != nil { return written, bodyErr }
+	}
+
+	if final && written < len(data) {
+		nTail, tailErr := dst.file.WriteAt(data[written:], int64(offset) + int64(written))
+		written += nTail
+		if tailErr != nil { return written, tailErr }
+	}
+
+	return written, nil
+}
+
+// write
+//	Take a buffer from the pool and fill it after any carried partial block, then write what it holds to the destination.
+//	fill is passed the free space in the buffer, limited to the bytes left in the chunk, and returns the number of bytes it placed.
+//	Bytes are marked complete in the tracker only after they are written to disk.
+func (w *chunkWriter) write(fill func([]byte) int) error {
+	buf, getBufferErr := w.bufferPool.GetContext(w.ctx)
+	if getBufferErr != nil { return getBufferErr }
+	defer w.bufferPool.Put(buf)
+
+	dst := w.transfer.dst
+	lead := int(w.offset % uint64(dst.alignment))
+	filled := lead + copy(buf[lead:], w.carry)
+
+	space := uint64(len(buf) - filled)
+	if w.remaining < space { space = w.remaining }
+
+	nFilled := fill(buf[filled:filled + int(space)])
+	w.remaining -= uint64(nFilled)
+
+	data := buf[:filled + nFilled]
+	nWritten, writeErr := dst.writeAt(data, lead, w.offset, w.remaining == 0)
+	w.carry = append(w.carry[:0], data[lead + nWritten:]...)
+	if writeErr != nil { return writeErr }
+
+	w.transfer.tracker.complete(w.offset, uint64(nWritten))
+	w.offset += uint64(nWritten)
+
+	return nil
+}
+
+// Write
+//	Write decoded bytes from a compressed chunk, copying them into pooled buffers.
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > total {
+		if w.remaining == 0 { return total, errChunkOverflow }
+
+		writeErr := w.write(func(buf []byte) int {
+			nCopied := copy(buf, p[total:])
+			total += nCopied
+			return nCopied
+		})
+
+		if writeErr != nil { return total, writeErr }
+	}
+
+	return total, nil
+}
+
+// sync
+//	Flush the written data and metadata of the destination to disk. Both descriptors share the same file, so syncing one is enough.
+func (dst *destination) sync() error {
+	if dst.file == nil { return nil }
+	return dst.file.Sync()
+}
+
+// syncDir
+//	Flush a directory to disk, so a file renamed into it survives a crash. Not every platform supports syncing a directory.
+func syncDir(dir string) error {
+	d, openErr := os.Open(dir)
+	if openErr != nil { return openErr }
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// close
+//	Close both descriptors for the destination. Safe to call more than once, or before the destination is opened.
+func (dst *destination) close() error {
+	if dst == nil { return nil }
+
+	var closeErr error
+	if dst.direct != nil {
+		closeErr = dst.direct.Close()
+		dst.direct = nil
+	}
+
+	if dst.file != nil {
+		if fileCloseErr := dst.file.Close(); fileCloseErr != nil { closeErr = fileCloseErr }
+		dst.file = nil
+	}
+
+	return closeErr
+}
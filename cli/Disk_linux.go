@@ -0,0 +1,24 @@
+//go:build linux
+
+package cli
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+
+// openDirect
+//	Open the destination file a second time with O_DIRECT, so aligned writes bypass the page cache.
+//	Filesystems without O_DIRECT support, like tmpfs, fail the open.
+func openDirect(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY | unix.O_DIRECT, 0666)
+}
+
+// preallocate
+//	Reserve the blocks for a single extent of the file with fallocate. The file is already sized, so the range is within it and holes between extents stay sparse.
+func preallocate(f *os.File, offset, length int64) error {
+	if length == 0 { return nil }
+	return unix.Fallocate(int(f.Fd()), 0, offset, length)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package cli
+
+import "os"
+
+
+// openDirect
+//	O_DIRECT is only supported on linux.
+func openDirect(path string) (*os.File, error) {
+	return nil, errDiskOpUnsupported
+}
+
+// preallocate
+//	fallocate is only supported on linux. The caller leaves the truncated file sparse.
+func preallocate(f *os.File, offset, length int64) error {
+	return errDiskOpUnsupported
+}
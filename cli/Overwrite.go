@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/md5"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Client Overwrite
+
+
+// ParseOverwritePolicy
+//	Parse the name of an overwrite policy, as passed on the command line.
+func ParseOverwritePolicy(name string) (OverwritePolicy, error) {
+	switch name {
+		case OVERWRITE_ALWAYS_NAME:
+			return OVERWRITE_ALWAYS, nil
+		case OVERWRITE_FAIL_NAME:
+			return OVERWRITE_FAIL, nil
+		case OVERWRITE_SKIP_IDENTICAL_NAME:
+			return OVERWRITE_SKIP_IDENTICAL, nil
+		case OVERWRITE_SKIP_NEWER_NAME:
+			return OVERWRITE_SKIP_NEWER, nil
+		case OVERWRITE_RENAME_NAME:
+			return OVERWRITE_RENAME, nil
+		default:
+			return 0, ErrUnknownOverwritePolicy
+	}
+}
+
+// String
+//	The name of the overwrite policy, as passed on the command line.
+func (policy OverwritePolicy) String() string {
+	switch policy {
+		case OVERWRITE_ALWAYS:
+			return OVERWRITE_ALWAYS_NAME
+		case OVERWRITE_FAIL:
+			return OVERWRITE_FAIL_NAME
+		case OVERWRITE_SKIP_IDENTICAL:
+			return OVERWRITE_SKIP_IDENTICAL_NAME
+		case OVERWRITE_SKIP_NEWER:
+			return OVERWRITE_SKIP_NEWER_NAME
+		case OVERWRITE_RENAME:
+			return OVERWRITE_RENAME_NAME
+		default:
+			return "unknown"
+	}
+}
+
+// resolveConflict
+//	Apply the overwrite policy to a single file transfer, returning whether the transfer should be skipped.
+//	Nothing is requested from the server unless a destination file exists and the policy needs the remote size, modification time, or md5 to decide.
+func (cli *QuicClient) resolveConflict(connectOpts *OpenConnectionOpts, transfer *fileTransfer) (bool, error) {
+	localInfo, statErr := os.Lstat(transfer.dstFile)
+	if os.IsNotExist(statErr) { return false, nil }
+	if statErr != nil { return false, statErr }
+
+	var entry protocol.ManifestEntry
+	if cli.overwrite == OVERWRITE_SKIP_IDENTICAL || cli.overwrite == OVERWRITE_SKIP_NEWER {
+		remoteEntry, remoteStatErr := cli.statRemote(connectOpts, transfer.srcPath)
+		if remoteStatErr != nil { return false, remoteStatErr }
+		entry = *remoteEntry
+	}
+
+	return cli.checkConflict(entry, transfer.dstFile, localInfo)
+}
+
+// checkConflict
+//	Decide whether an existing local entry in the way of a remote file is skipped, according to the overwrite policy.
+//	With OVERWRITE_FAIL, ErrDestinationExists is returned. Files are identical if their size matches and the md5 of the local file matches the md5 the server has for the remote file.
+func (cli *QuicClient) checkConflict(entry protocol.ManifestEntry, localPath string, localInfo fs.FileInfo) (bool, error) {
+	switch cli.overwrite {
+		case OVERWRITE_FAIL:
+			return false, ErrDestinationExists
+		case OVERWRITE_SKIP_IDENTICAL:
+			if ! localInfo.Mode().IsRegular() || uint64(localInfo.Size()) != entry.Size { return false, nil }
+
+			localMd5, md5Err := md5.CalculateMD5(localPath)
+			if md5Err != nil { return false, md5Err }
+			return bytes.Equal(localMd5, entry.Md5), nil
+		case OVERWRITE_SKIP_NEWER:
+			return localInfo.ModTime().After(time.Unix(0, entry.ModTime)), nil
+		default:
+			return false, nil
+	}
+}
+
+// statRemote
+//	Request the manifest entry for a single remote file.
+func (cli *QuicClient) statRemote(connectOpts *OpenConnectionOpts, srcPath string) (*protocol.ManifestEntry, error) {
+	entries, listErr := cli.listRemote(connectOpts, &protocol.ListRequest{ Path: srcPath })
+	if listErr != nil { return nil, listErr }
+	if len(entries) != 1 { return nil, ErrRemoteNotFound }
+
+	return &entries[0], nil
+}
+
+// backupExisting
+//	Rename an existing destination file to the first free numbered backup name, so the new file can take its place.
+func backupExisting(transfer *fileTransfer) error {
+	_, statErr := os.Lstat(transfer.dstFile)
+	if os.IsNotExist(statErr) { return nil }
+	if statErr != nil { return statErr }
+
+	for n := 1; ; n++ {
+		backupPath := transfer.dstFile + fmt.Sprintf(BACKUP_SUFFIX_FORMAT, n)
+
+		_, backupStatErr := os.Lstat(backupPath)
+		if os.IsNotExist(backupStatErr) {
+			transfer.logger.Info("renaming existing destination", logger.F("backup", backupPath))
+			return os.Rename(transfer.dstFile, backupPath)
+		}
+
+		if backupStatErr != nil { return backupStatErr }
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"sort"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Range Tracker
+
+
+// newRangeTracker
+//	Create a tracker for the ranges of the file that need to be written before the transfer is complete.
+func newRangeTracker(required []protocol.Range) *rangeTracker {
+	return &rangeTracker{ required: required }
+}
+
+// complete
+//	Mark a range as written to disk, merging it with any adjacent or overlapping completed ranges.
+func (rt *rangeTracker) complete(offset, length uint64) {
+	if length == 0 { return }
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.completed = append(rt.completed, protocol.Range{ Offset: offset, Length: length })
+	sort.Slice(rt.completed, func(i, j int) bool { return rt.completed[i].Offset < rt.completed[j].Offset })
+
+	merged := rt.completed[:1]
+	for _, r := range rt.completed[1:] {
+		last := &merged[len(merged) - 1]
+		if r.Offset <= last.Offset + last.Length {
+			if end := r.Offset + r.Length; end > last.Offset + last.Length { last.Length = end - last.Offset }
+		} else { merged = append(merged, r) }
+	}
+
+	rt.completed = merged
+	rt.totalCompleted = 0
+	for _, r := range rt.completed { rt.totalCompleted += r.Length }
+}
+
+// completeHoles
+//	Mark everything outside the data extents of a sparse file as complete. Extents are in order and do not overlap.
+func (rt *rangeTracker) completeHoles(extents []protocol.Range, size uint64) {
+	cursor := uint64(0)
+	for _, extent := range extents {
+		if extent.Offset > cursor { rt.complete(cursor, extent.Offset - cursor) }
+		cursor = extent.Offset + extent.Length
+	}
+
+	if cursor < size { rt.complete(cursor, size - cursor) }
+}
+
+// remaining
+//	The required ranges that have not yet been written to disk.
+//	These are re-requested from the server when a transfer is retried.
+func (rt *rangeTracker) remaining() []protocol.Range {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var remaining []protocol.Range
+	for _, req := range rt.required {
+		cursor := req.Offset
+		end := req.Offset + req.Length
+
+		for _, done := range rt.completed {
+			doneEnd := done.Offset + done.Length
+			if doneEnd <= cursor || done.Offset >= end { continue }
+			if done.Offset > cursor { remaining = append(remaining, protocol.Range{ Offset: cursor, Length: done.Offset - cursor }) }
+			cursor = doneEnd
+		}
+
+		if cursor < end { remaining = append(remaining, protocol.Range{ Offset: cursor, Length: end - cursor }) }
+	}
+
+	return remaining
+}
+
+// bytesCompleted
+//	The total number of bytes written to disk so far.
+func (rt *rangeTracker) bytesCompleted() uint64 {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	return rt.totalCompleted
+}
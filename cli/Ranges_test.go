@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+// span: a range written positionally, converted to a protocol range for the tracker
+type span struct {
+	offset uint64
+	length uint64
+}
+
+func ranges(spans []span) []protocol.Range {
+	if spans == nil { return nil }
+
+	converted := make([]protocol.Range, len(spans))
+	for idx, s := range spans { converted[idx] = protocol.Range{ Offset: s.offset, Length: s.length } }
+
+	return converted
+}
+
+
+func TestRangeTracker(t *testing.T) {
+	tests := []struct {
+		name string
+		required []span
+		completed []span
+		merged []span
+		remaining []span
+	}{
+		{ "nothing written", []span{{ 0, 100 }}, nil, nil, []span{{ 0, 100 }} },
+		{ "everything written", []span{{ 0, 100 }}, []span{{ 0, 100 }}, []span{{ 0, 100 }}, nil },
+		{ "empty writes are ignored", []span{{ 0, 100 }}, []span{{ 50, 0 }}, nil, []span{{ 0, 100 }} },
+		{ "adjacent writes merge", []span{{ 0, 100 }}, []span{{ 0, 10 }, { 10, 10 }}, []span{{ 0, 20 }}, []span{{ 20, 80 }} },
+		{ "out of order writes merge", []span{{ 0, 100 }}, []span{{ 20, 10 }, { 0, 10 }, { 10, 10 }}, []span{{ 0, 30 }}, []span{{ 30, 70 }} },
+		{ "overlapping writes merge", []span{{ 0, 100 }}, []span{{ 0, 30 }, { 20, 20 }}, []span{{ 0, 40 }}, []span{{ 40, 60 }} },
+		{ "contained write does not shrink", []span{{ 0, 100 }}, []span{{ 0, 50 }, { 10, 5 }}, []span{{ 0, 50 }}, []span{{ 50, 50 }} },
+		{ "gaps stay separate", []span{{ 0, 100 }}, []span{{ 10, 10 }, { 50, 10 }}, []span{{ 10, 10 }, { 50, 10 }}, []span{{ 0, 10 }, { 20, 30 }, { 60, 40 }} },
+		{ "write bridges a gap", []span{{ 0, 100 }}, []span{{ 0, 10 }, { 20, 10 }, { 5, 20 }}, []span{{ 0, 30 }}, []span{{ 30, 70 }} },
+		{ "several required ranges", []span{{ 0, 10 }, { 50, 10 }}, []span{{ 5, 50 }}, []span{{ 5, 50 }}, []span{{ 0, 5 }, { 55, 5 }} },
+		{ "writes outside the required ranges", []span{{ 10, 10 }}, []span{{ 0, 5 }, { 25, 5 }}, []span{{ 0, 5 }, { 25, 5 }}, []span{{ 10, 10 }} },
+		{ "write covers several required ranges", []span{{ 0, 10 }, { 20, 10 }}, []span{{ 0, 30 }}, []span{{ 0, 30 }}, nil },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := newRangeTracker(ranges(test.required))
+			for _, s := range test.completed { rt.complete(s.offset, s.length) }
+
+			if ! reflect.DeepEqual(rt.completed, ranges(test.merged)) { t.Errorf("expected completed %v, got %v", test.merged, rt.completed) }
+			if remaining := rt.remaining(); ! reflect.DeepEqual(remaining, ranges(test.remaining)) { t.Errorf("expected remaining %v, got %v", test.remaining, remaining) }
+
+			total := uint64(0)
+			for _, s := range test.merged { total += s.length }
+			if rt.bytesCompleted() != total { t.Errorf("expected %d bytes completed, got %d", total, rt.bytesCompleted()) }
+		})
+	}
+}
+
+func TestRangeTrackerCompleteHoles(t *testing.T) {
+	tests := []struct {
+		name string
+		extents []span
+		size uint64
+		remaining []span
+	}{
+		{ "no extents", nil, 100, nil },
+		{ "single extent in the middle", []span{{ 10, 20 }}, 100, []span{{ 10, 20 }} },
+		{ "extents at both ends", []span{{ 0, 10 }, { 90, 10 }}, 100, []span{{ 0, 10 }, { 90, 10 }} },
+		{ "adjacent extents", []span{{ 0, 10 }, { 10, 10 }}, 30, []span{{ 0, 20 }} },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := newRangeTracker(ranges([]span{{ 0, test.size }}))
+			rt.completeHoles(ranges(test.extents), test.size)
+			if remaining := rt.remaining(); ! reflect.DeepEqual(remaining, ranges(test.remaining)) { t.Errorf("expected remaining %v, got %v", test.remaining, remaining) }
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+)
+
+
+//============================================= Retry
+
+
+// DefaultRetryPolicy
+//	Retry transient failures up to 5 attempts, backing off exponentially from 500ms up to 30s.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: DEFAULT_MAX_ATTEMPTS,
+		InitialBackoff: DEFAULT_INITIAL_BACKOFF,
+		MaxBackoff: DEFAULT_MAX_BACKOFF,
+		Multiplier: DEFAULT_BACKOFF_MULTIPLIER,
+		IsRetryable: IsRetryableError,
+	}
+}
+
+// IsRetryableError
+//	The default error classification.
+//	Network level failures (timeouts, stateless resets, transport errors, connections closed by the server due to stream errors) are transient.
+//	So are requests the server refused or connections it closed while shutting down, since it is expected to come back.
+//	Errors the server reports as internal (missing file, bad request), requests it rejected as protocol errors, transfers an operator canceled on the server, and local disk errors are not.
+func IsRetryableError(err error) bool {
+	if err == nil { return false }
+	if errors.Is(err, ErrIncompleteTransfer) || errors.Is(err, io.ErrUnexpectedEOF) { return true }
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) { return true }
+
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) {
+		return appErr.ErrorCode == common.CONNECTION_ERROR || appErr.ErrorCode == common.TRANSPORT_ERROR || appErr.ErrorCode == common.SHUTDOWN_ERROR
+	}
+
+	var streamErr *quic.StreamError
+	if errors.As(err, &streamErr) && streamErr.ErrorCode == quic.StreamErrorCode(common.SHUTDOWN_ERROR) { return true }
+
+	var idleErr *quic.IdleTimeoutError
+	var handshakeErr *quic.HandshakeTimeoutError
+	var resetErr *quic.StatelessResetError
+	var transportErr *quic.TransportError
+	if errors.As(err, &idleErr) || errors.As(err, &handshakeErr) || errors.As(err, &resetErr) || errors.As(err, &transportErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() { return true }
+
+	return false
+}
+
+// shouldRetry
+//	Determine if another attempt should be made after the given attempt failed.
+func (policy *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if attempt >= policy.MaxAttempts { return false }
+	
+	isRetryable := policy.IsRetryable
+	if isRetryable == nil { isRetryable = IsRetryableError }
+	
+	return isRetryable(err)
+}
+
+// backoff
+//	The delay before the next attempt, growing exponentially with the attempt number and capped at MaxBackoff.
+//	Up to 20% jitter is subtracted so many clients retrying at once do not reconnect in lockstep.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 { multiplier = 1 }
+
+	delay := float64(policy.InitialBackoff)
+	for idx := 1; idx < attempt; idx++ { delay *= multiplier }
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) { delay = float64(policy.MaxBackoff) }
+
+	jitter := delay * 0.2 * rand.Float64()
+	return time.Duration(delay - jitter)
+}
@@ -0,0 +1,324 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/filter"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/md5"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Client Sync
+
+
+// ParseCompareMode
+//	Parse the name of a compare mode, as passed on the command line.
+func ParseCompareMode(name string) (CompareMode, error) {
+	switch name {
+		case COMPARE_SIZE_MTIME_NAME:
+			return COMPARE_SIZE_MTIME, nil
+		case COMPARE_CHECKSUM_NAME:
+			return COMPARE_CHECKSUM, nil
+		default:
+			return 0, ErrUnknownCompareMode
+	}
+}
+
+// Sync
+//	Mirror a directory tree on the remote system into a local directory.
+//	The server first sends a manifest of the remote tree, which is compared against the local tree to plan the sync.
+//	New and changed files are then transferred one at a time, each with the usual multi-stream transfer and retries.
+//	Transferred files are given the modification time of the remote file, even if times are not otherwise preserved, so later syncs comparing size and modification time skip them.
+//	Changed local files are handled by the client's overwrite policy, which is applied while planning, so a dry run shows what would be skipped or would conflict.
+//	Local entries in the way of an entry of a different type are replaced, unless the policy is to fail. With Delete, local entries missing from the remote tree are removed last.
+//	A failed action does not stop the sync. If any action failed, the result is returned along with ErrSyncIncomplete.
+func (cli *QuicClient) Sync(connectOpts *OpenConnectionOpts, opts *SyncOpts) (*SyncResult, error) {
+	syncLogger := cli.logger.With(logger.F(logger.REMOTE_ADDR_KEY, cli.remoteAddress), logger.F(logger.PATH_KEY, opts.Remote))
+	syncStartTime := time.Now()
+
+	treeFilter, filterErr := filter.New(opts.Rules)
+	if filterErr != nil { return nil, filterErr }
+
+	remoteEntries, listErr := cli.listRemote(connectOpts, &protocol.ListRequest{ Path: opts.Remote, Rules: opts.Rules })
+	if listErr != nil { return nil, listErr }
+
+	localEntries, walkErr := listLocal(opts.Local, treeFilter)
+	if walkErr != nil { return nil, walkErr }
+
+	result, planErr := cli.planSync(opts, remoteEntries, localEntries)
+	if planErr != nil { return nil, planErr }
+
+	syncLogger.Info("sync planned",
+		logger.F("remoteEntries", len(remoteEntries)),
+		logger.F("actions", len(result.Actions)),
+		logger.F("unchanged", result.Unchanged),
+		logger.F("skipped", result.Skipped),
+		logger.F("dryRun", opts.DryRun),
+	)
+
+	if opts.DryRun { return result, nil }
+
+	mkdirErr := os.MkdirAll(opts.Local, 0755)
+	if mkdirErr != nil { return nil, mkdirErr }
+
+	for idx := range result.Actions {
+		action := &result.Actions[idx]
+		action.Err = cli.applySyncAction(connectOpts, opts, action)
+		if action.Err != nil {
+			result.Failed++
+			syncLogger.Error("sync action failed", logger.F("file", action.Path), logger.Err(action.Err))
+			continue
+		}
+
+		if action.Type == SYNC_NEW_FILE || action.Type == SYNC_UPDATE_FILE { result.BytesTransferred += action.Size }
+	}
+
+	syncLogger.Info("sync complete",
+		logger.F("actions", len(result.Actions)),
+		logger.F("failed", result.Failed),
+		logger.F("bytes", result.BytesTransferred),
+		logger.F("elapsed", time.Since(syncStartTime)),
+	)
+
+	if result.Failed > 0 { return result, ErrSyncIncomplete }
+	return result, nil
+}
+
+// String
+//	The name of the action type, as shown in dry run output.
+func (actionType SyncActionType) String() string {
+	switch actionType {
+		case SYNC_CREATE_DIR:
+			return "mkdir"
+		case SYNC_NEW_FILE:
+			return "new"
+		case SYNC_UPDATE_FILE:
+			return "update"
+		case SYNC_DELETE:
+			return "delete"
+		case SYNC_CONFLICT:
+			return "conflict"
+		default:
+			return "unknown"
+	}
+}
+
+// listRemote
+//	Request the manifest of the remote tree on its own connection, retrying transient errors with the client's retry policy.
+func (cli *QuicClient) listRemote(connectOpts *OpenConnectionOpts, listReq *protocol.ListRequest) ([]protocol.ManifestEntry, error) {
+	for attempt := 1; ; attempt++ {
+		entries, requestErr := cli.requestManifest(connectOpts, listReq)
+		if requestErr == nil { return entries, nil }
+		if ! cli.retry.shouldRetry(attempt, requestErr) { return nil, requestErr }
+
+		delay := cli.retry.backoff(attempt)
+		cli.logger.Warn("manifest request failed, retrying", logger.F("attempt", attempt), logger.F("delay", delay), logger.Err(requestErr))
+		time.Sleep(delay)
+	}
+}
+
+// requestManifest
+//	Send a list request and read manifest batches until the server closes the stream.
+func (cli *QuicClient) requestManifest(connectOpts *OpenConnectionOpts, listReq *protocol.ListRequest) ([]protocol.ManifestEntry, error) {
+	session, connErr := cli.openConnection(connectOpts)
+	if connErr != nil { return nil, connErr }
+	defer session.close()
+
+	listStream, openStreamErr := session.conn.OpenStream()
+	if openStreamErr != nil { return nil, openStreamErr }
+
+	writeReqErr := protocol.WriteMessage(listStream, protocol.LIST_REQUEST, protocol.SerializeListRequest(listReq))
+	if writeReqErr != nil { return nil, writeReqErr }
+
+	closeErr := listStream.Close()
+	if closeErr != nil { return nil, closeErr }
+
+	var entries []protocol.ManifestEntry
+	reader := protocol.NewMessageReader(listStream)
+	for {
+		msgType, payload, readErr := reader.Read()
+		if readErr == io.EOF { return entries, nil }
+		if readErr != nil { return nil, readErr }
+		if msgType != protocol.MANIFEST { return nil, protocol.ErrUnexpectedMessage }
+
+		batch, desBatchErr := protocol.DeserializeManifest(payload)
+		if desBatchErr != nil { return nil, desBatchErr }
+
+		entries = append(entries, batch...)
+	}
+}
+
+// listLocal
+//	Walk the local tree, keyed by slash separated path relative to the root, leaving out excluded paths. A missing root is an empty tree.
+func listLocal(root string, treeFilter *filter.Filter) (map[string]fs.FileInfo, error) {
+	entries := make(map[string]fs.FileInfo)
+
+	_, statErr := os.Stat(root)
+	if os.IsNotExist(statErr) { return entries, nil }
+	if statErr != nil { return nil, statErr }
+
+	walkErr := filter.Walk(root, treeFilter, func(relPath string, info fs.FileInfo) error {
+		entries[relPath] = info
+		return nil
+	})
+
+	if walkErr != nil { return nil, walkErr }
+	return entries, nil
+}
+
+// planSync
+//	Compare the remote manifest against the local tree, in the order of the manifest so directories are created before their contents.
+//	Local entries of a different type than the remote entry are deleted in place, just before the remote entry is created.
+//	Extraneous local entries are deleted at the end. Directories are deleted along with their contents as a single action.
+//	Files present on both sides that differ are checked against the overwrite policy. Entries the policy fails on are planned as conflicts, which fail when applied.
+//	The md5 file for a remote file, or for a local file excluded by the filter, is kept, since the client writes one after checking the md5 of a transfer.
+func (cli *QuicClient) planSync(opts *SyncOpts, remoteEntries []protocol.ManifestEntry, localEntries map[string]fs.FileInfo) (*SyncResult, error) {
+	result := &SyncResult{}
+	remotePaths := make(map[string]bool, len(remoteEntries))
+	deletedDirs := make(map[string]bool)
+
+	for _, entry := range remoteEntries {
+		remotePaths[entry.Path] = true
+		remoteIsDir := os.FileMode(entry.Mode).IsDir()
+
+		localInfo, existsLocally := localEntries[entry.Path]
+		if existsLocally && localInfo.IsDir() != remoteIsDir {
+			if cli.overwrite == OVERWRITE_FAIL {
+				result.Actions = append(result.Actions, SyncAction{ Type: SYNC_CONFLICT, Path: entry.Path })
+				continue
+			}
+
+			result.Actions = append(result.Actions, SyncAction{ Type: SYNC_DELETE, Path: entry.Path })
+			if localInfo.IsDir() { deletedDirs[entry.Path] = true }
+			existsLocally = false
+		}
+
+		if remoteIsDir {
+			if ! existsLocally { result.Actions = append(result.Actions, SyncAction{ Type: SYNC_CREATE_DIR, Path: entry.Path }) }
+			continue
+		}
+
+		if ! existsLocally {
+			result.Actions = append(result.Actions, SyncAction{ Type: SYNC_NEW_FILE, Path: entry.Path, Size: entry.Size, modTime: entry.ModTime })
+			continue
+		}
+
+		unchanged, compareErr := isUnchanged(opts, entry, localInfo)
+		if compareErr != nil { return nil, compareErr }
+		if unchanged {
+			result.Unchanged++
+			continue
+		}
+
+		skip, conflictErr := cli.checkConflict(entry, filepath.Join(opts.Local, filepath.FromSlash(entry.Path)), localInfo)
+		if errors.Is(conflictErr, ErrDestinationExists) {
+			result.Actions = append(result.Actions, SyncAction{ Type: SYNC_CONFLICT, Path: entry.Path })
+			continue
+		}
+
+		if conflictErr != nil { return nil, conflictErr }
+		if skip {
+			result.Skipped++
+			continue
+		}
+
+		result.Actions = append(result.Actions, SyncAction{ Type: SYNC_UPDATE_FILE, Path: entry.Path, Size: entry.Size, modTime: entry.ModTime })
+	}
+
+	if ! opts.Delete { return result, nil }
+
+	var extraneous []string
+	for localPath := range localEntries {
+		if remotePaths[localPath] { continue }
+		if strings.HasSuffix(localPath, common.MD5_SUFFIX) && isKeptMd5File(opts.Local, strings.TrimSuffix(localPath, common.MD5_SUFFIX), remotePaths, localEntries) { continue }
+
+		extraneous = append(extraneous, localPath)
+	}
+
+	sort.Strings(extraneous)
+	for _, localPath := range extraneous {
+		if localEntries[localPath].IsDir() { deletedDirs[localPath] = true }
+	}
+
+	for _, localPath := range extraneous {
+		if hasDeletedAncestor(localPath, deletedDirs) { continue }
+		result.Actions = append(result.Actions, SyncAction{ Type: SYNC_DELETE, Path: localPath })
+	}
+
+	return result, nil
+}
+
+// isUnchanged
+//	Check whether a local file matches the remote file using the compare mode for the sync.
+func isUnchanged(opts *SyncOpts, entry protocol.ManifestEntry, localInfo fs.FileInfo) (bool, error) {
+	if uint64(localInfo.Size()) != entry.Size { return false, nil }
+
+	switch opts.Compare {
+		case COMPARE_CHECKSUM:
+			localMd5, md5Err := md5.CalculateMD5(filepath.Join(opts.Local, filepath.FromSlash(entry.Path)))
+			if md5Err != nil { return false, md5Err }
+			return bytes.Equal(localMd5, entry.Md5), nil
+		default:
+			return time.Unix(0, entry.ModTime).Unix() == localInfo.ModTime().Unix(), nil
+	}
+}
+
+// applySyncAction
+//	Make a single planned change to the local tree.
+//	Before a file is transferred, any md5 file left from the previous version is removed so it cannot go stale. It is rewritten if the transfer checks the md5.
+//	The overwrite policy was already applied while planning, so files are transferred directly.
+func (cli *QuicClient) applySyncAction(connectOpts *OpenConnectionOpts, opts *SyncOpts, action *SyncAction) error {
+	localPath := filepath.Join(opts.Local, filepath.FromSlash(action.Path))
+
+	switch action.Type {
+		case SYNC_CREATE_DIR:
+			return os.MkdirAll(localPath, 0755)
+		case SYNC_DELETE:
+			return os.RemoveAll(localPath)
+		case SYNC_CONFLICT:
+			return ErrDestinationExists
+		default:
+			removeErr := os.Remove(localPath + common.MD5_SUFFIX)
+			if removeErr != nil && ! os.IsNotExist(removeErr) { return removeErr }
+
+			transfer := cli.newFileTransfer(filepath.Join(opts.Remote, filepath.FromSlash(action.Path)), localPath)
+			_, transferErr := cli.transferFile(connectOpts, transfer)
+			if transferErr != nil { return transferErr }
+			if cli.preserve & protocol.ATTR_TIMES != 0 { return nil }
+
+			modTime := time.Unix(0, action.modTime)
+			return os.Chtimes(localPath, modTime, modTime)
+	}
+}
+
+// isKeptMd5File
+//	Check whether an md5 file belongs to a file that is on the remote system or that was excluded from the local tree, rather than one that is missing or being deleted.
+func isKeptMd5File(localRoot, filePath string, remotePaths map[string]bool, localEntries map[string]fs.FileInfo) bool {
+	if remotePaths[filePath] { return true }
+	if _, walked := localEntries[filePath]; walked { return false }
+
+	_, statErr := os.Stat(filepath.Join(localRoot, filepath.FromSlash(filePath)))
+	return statErr == nil
+}
+
+// hasDeletedAncestor
+//	Check whether any parent directory of a path is already being deleted.
+func hasDeletedAncestor(entryPath string, deletedDirs map[string]bool) bool {
+	for parent := path.Dir(entryPath); parent != "." && parent != "/"; parent = path.Dir(parent) {
+		if deletedDirs[parent] { return true }
+	}
+
+	return false
+}
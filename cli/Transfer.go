@@ -0,0 +1,376 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/compress"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+	"github.com/sirgallo/quicfiletransfer/common/ratelimit"
+	"github.com/sirgallo/quicfiletransfer/common/serialize"
+)
+
+
+//============================================= Client Transfer
+
+
+// runTransferAttempt
+//	A single attempt at transferring the file over a new connection.
+//	On the first attempt the entire file is requested, or in delta mode, only the ranges that could not be copied from the existing file.
+//	On later attempts, only the ranges not yet written are requested.
+//	The first error encountered by any stream closes the connection and is returned for classification by the retry policy.
+func (cli *QuicClient) runTransferAttempt(connectOpts *OpenConnectionOpts, transfer *fileTransfer) error {
+	var ranges []protocol.Range
+	if transfer.tracker != nil {
+		ranges = transfer.tracker.remaining()
+		if len(ranges) == 0 { return nil }
+	}
+
+	session, connErr := cli.openConnection(connectOpts)
+	if connErr != nil { return connErr }
+	defer session.close()
+
+	conn := session.conn
+
+	if transfer.tracker == nil && transfer.basisFile != "" {
+		deltaErr := cli.runDelta(conn, transfer)
+		if deltaErr != nil {
+			conn.CloseWithError(common.INTERNAL_ERROR, deltaErr.Error())
+			return deltaErr
+		}
+
+		ranges = transfer.tracker.remaining()
+		if len(ranges) == 0 { return nil }
+	}
+
+	var attemptErr error
+	var errOnce sync.Once
+	fail := func(code quic.ApplicationErrorCode, err error) {
+		errOnce.Do(func() {
+			// waits on the connection context fail with context.Canceled once it closes, so the reason the connection closed is reported instead
+			if errors.Is(err, context.Canceled) && context.Cause(conn.Context()) != nil { err = context.Cause(conn.Context()) }
+			attemptErr = err
+			conn.CloseWithError(code, err.Error())
+		})
+	}
+
+	commStream, openCommStreamErr := conn.OpenStream()
+	if openCommStreamErr != nil {
+		fail(common.CONNECTION_ERROR, openCommStreamErr)
+		return attemptErr
+	}
+
+	initialStreams := cli.initialStreams()
+	fileReq := &protocol.FileRequest{ 
+		Streams: uint16(initialStreams), 
+		Compression: cli.compression, 
+		Preserve: cli.preserve, 
+		Path: transfer.srcPath, 
+		Ranges: ranges,
+	}
+	fileReqErr := protocol.WriteMessage(commStream, protocol.FILE_REQUEST, protocol.SerializeFileRequest(fileReq))
+	if fileReqErr != nil {
+		fail(common.TRANSPORT_ERROR, fileReqErr)
+		return attemptErr
+	}
+
+	payload, readPayloadErr := protocol.ExpectMessage(commStream, protocol.FILE_META)
+	if readPayloadErr != nil {
+		fail(common.TRANSPORT_ERROR, readPayloadErr)
+		return attemptErr
+	}
+
+	meta, desMetaErr := protocol.DeserializeFileMeta(payload)
+	if desMetaErr != nil {
+		fail(common.INTERNAL_ERROR, desMetaErr)
+		return attemptErr
+	}
+
+	initErr := cli.initTransfer(transfer, meta)
+	if initErr != nil {
+		fail(common.INTERNAL_ERROR, initErr)
+		return attemptErr
+	}
+
+	if cli.compression != protocol.CODEC_NONE {
+		transfer.logger.Debug("compression negotiated", logger.F("requested", compress.CodecName(cli.compression)), logger.F("codec", compress.CodecName(meta.Compression)))
+	}
+
+	if int(meta.Streams) < initialStreams {
+		transfer.logger.Info("server granted fewer streams than requested", logger.F("requested", initialStreams), logger.F("granted", meta.Streams))
+	}
+
+	var clientWG sync.WaitGroup
+
+	acceptCtx, cancelAccept := context.WithCancel(context.Background())
+	defer cancelAccept()
+
+	acceptor := &dataStreamAcceptor{ expected: -1, cancel: cancelAccept }
+
+	clientWG.Add(1)
+	go func() {
+		defer clientWG.Done()
+		
+		commReader := protocol.NewMessageReader(commStream)
+		for {
+			msgType, msgPayload, readErr := commReader.Read()
+			if readErr == io.EOF {
+				transfer.logger.Debug("comm stream closed by server") 
+				return 
+			}
+
+			if readErr != nil {
+				fail(common.TRANSPORT_ERROR, readErr) 
+				return 
+			}
+
+			switch msgType {
+				case protocol.PROGRESS:
+					chunkBytes, desErr := serialize.DeserializeUint64(msgPayload)
+					if desErr != nil {
+						fail(common.INTERNAL_ERROR, desErr) 
+						return 
+					}
+
+					transfer.logger.Debug("chunk received", logger.F("bytes", chunkBytes), logger.F("total", transfer.tracker.bytesCompleted()))
+					cli.emit(transfer, &TransferEvent{ Type: TRANSFER_PROGRESS })
+				case protocol.TRANSFER_DONE:
+					totalStreams, desErr := serialize.DeserializeUint32(msgPayload)
+					if desErr != nil {
+						fail(common.INTERNAL_ERROR, desErr) 
+						return 
+					}
+
+					transfer.logger.Debug("server finished sending", logger.F("streams", totalStreams))
+					acceptor.setExpected(int(totalStreams))
+				default:
+					fail(common.INTERNAL_ERROR, protocol.ErrUnexpectedMessage)
+					return
+			}
+		}
+	}()
+
+	clientWG.Add(1)
+	go func() {
+		defer clientWG.Done()
+
+		for {
+			dataStream, acceptStreamErr := conn.AcceptUniStream(acceptCtx)
+			if acceptStreamErr != nil { 
+				if acceptCtx.Err() == nil { fail(common.CONNECTION_ERROR, acceptStreamErr) }
+				return
+			}
+
+			s := acceptor.accept()
+
+			clientWG.Add(1)
+			go func() {
+				defer clientWG.Done()
+
+				receiveErr := cli.receiveChunks(conn.Context(), transfer, dataStream, transfer.logger.With(logger.F(logger.STREAM_KEY, s)))
+				if receiveErr != nil { fail(common.TRANSPORT_ERROR, receiveErr) }
+			}()
+		}
+	}()
+
+	adaptCtx, cancelAdapt := context.WithCancel(context.Background())
+	if cli.autoStreams { go cli.adaptStreams(adaptCtx, session, commStream, transfer, int(meta.Streams), int(meta.MaxStreams)) }
+
+	clientWG.Wait()
+	cancelAdapt()
+	
+	if attemptErr != nil { return attemptErr }
+	if len(transfer.tracker.remaining()) > 0 { return ErrIncompleteTransfer }
+
+	return nil
+}
+
+// initialStreams
+//	The number of data streams to request at the start of an attempt.
+//	In auto mode, the client starts small and the adaptive scheduler grows the count from there.
+func (cli *QuicClient) initialStreams() int {
+	if ! cli.autoStreams { 
+		if cli.streams == 0 { return 1 }
+		return int(cli.streams) 
+	}
+
+	if maxStreams := cli.maxAutoStreams(); maxStreams < AUTO_INITIAL_STREAMS { return maxStreams }
+	return AUTO_INITIAL_STREAMS
+}
+
+// accept
+//	Record an accepted data stream, returning its index.
+//	Once every stream the server opened has been accepted, stop accepting.
+func (acceptor *dataStreamAcceptor) accept() int {
+	acceptor.mu.Lock()
+	defer acceptor.mu.Unlock()
+
+	idx := acceptor.accepted
+	acceptor.accepted++
+	if acceptor.expected >= 0 && acceptor.accepted >= acceptor.expected { acceptor.cancel() }
+
+	return idx
+}
+
+// setExpected
+//	Record the total number of data streams the server opened for the attempt.
+func (acceptor *dataStreamAcceptor) setExpected(expected int) {
+	acceptor.mu.Lock()
+	defer acceptor.mu.Unlock()
+
+	acceptor.expected = expected
+	if acceptor.accepted >= acceptor.expected { acceptor.cancel() }
+}
+
+// initTransfer
+//	On the first attempt, record the remote file metadata and resize the destination file.
+//	On later attempts, ensure the remote file has not changed since the transfer began.
+//	The holes of a sparse file are marked complete, since they read as zeros once the file is sized and the server never sends them.
+func (cli *QuicClient) initTransfer(transfer *fileTransfer, meta *protocol.FileMeta) error {
+	if transfer.tracker == nil {
+		transfer.fileSize = meta.Size
+		transfer.sourceMd5 = meta.Md5
+		transfer.attrs = meta.Attrs
+
+		resizeErr := transfer.dst.resize(meta.Size, meta.Extents, meta.Sparse, cli.preallocate, transfer.logger)
+		if resizeErr != nil { return resizeErr }
+
+		transfer.tracker = newRangeTracker([]protocol.Range{{ Offset: 0, Length: meta.Size }})
+	}
+
+	if meta.Size != transfer.fileSize || ! bytes.Equal(meta.Md5, transfer.sourceMd5) { return ErrRemoteFileChanged }
+	if meta.Sparse { transfer.tracker.completeHoles(meta.Extents, meta.Size) }
+
+	return nil
+}
+
+// receiveChunks
+//	Read chunks from a data stream until the server closes it.
+//	Each chunk is preceded by a header containing the offset in the file, the size of the chunk, and how it was compressed.
+//	Every stream writes to the shared destination with positional writes, so no seeking is needed.
+//	Compressed chunks are decoded before they are written. Decoders are created per stream on first use and reused across chunks.
+func (cli *QuicClient) receiveChunks(ctx context.Context, transfer *fileTransfer, dataStream quic.ReceiveStream, streamLogger logger.Logger) error {
+	header := make([]byte, protocol.CHUNK_HEADER_LENGTH)
+	writer := &chunkWriter{ 
+		ctx: ctx, 
+		transfer: transfer, 
+		bufferPool: cli.bufferPool, 
+		limiter: cli.limiter, 
+		carry: make([]byte, 0, transfer.dst.alignment),
+	}
+	decoders := make(map[protocol.Codec]compress.Decoder)
+
+	defer func() {
+		for _, decoder := range decoders { decoder.Close() }
+	}()
+
+	for {
+		dataStream.SetReadDeadline(time.Time{})
+		_, readHeaderErr := io.ReadFull(dataStream, header)
+		if readHeaderErr == io.EOF { return nil }
+		if readHeaderErr != nil { return readHeaderErr }
+
+		chunk, desErr := protocol.DeserializeChunkHeader(header)
+		if desErr != nil { return desErr }
+		if chunk.Offset > transfer.fileSize || chunk.Size > transfer.fileSize - chunk.Offset { return errors.New("chunk exceeds remote file size") }
+
+		streamLogger.Debug("receiving chunk", 
+			logger.F("offset", chunk.Offset), 
+			logger.F("size", chunk.Size), 
+			logger.F("encodedSize", chunk.EncodedSize),
+		)
+
+		writer.offset = chunk.Offset
+		writer.remaining = chunk.Size
+
+		if chunk.Codec == protocol.CODEC_NONE {
+			receiveErr := receiveRawChunk(dataStream, writer)
+			if receiveErr != nil { return receiveErr }
+			continue
+		}
+
+		decoder, ok := decoders[chunk.Codec]
+		if ! ok {
+			var newDecoderErr error
+			decoder, newDecoderErr = compress.NewDecoder(chunk.Codec)
+			if newDecoderErr != nil { return newDecoderErr }
+			decoders[chunk.Codec] = decoder
+		}
+
+		receiveErr := receiveCompressedChunk(dataStream, chunk, decoder, writer)
+		if receiveErr != nil { return receiveErr }
+	}
+}
+
+// receiveRawChunk
+//	Read an uncompressed chunk directly into pooled buffers.
+//	A buffer is only held from the client's pool while a slice of the chunk is read and written,
+//	so the memory budget is shared fairly between every stream of every transfer.
+//	Each read into a pooled buffer takes only what the stream has available and has a short deadline. If the stream has no data, the buffer is handed back rather than held,
+//	otherwise a stream waiting on data could hold a buffer while the connection's flow control window is filled by streams waiting on buffers.
+//	The rate limit is applied after the buffer is handed back, so a throttled stream never holds a buffer while it waits.
+func receiveRawChunk(dataStream quic.ReceiveStream, writer *chunkWriter) error {
+	for writer.remaining > 0 {
+		var nRead int
+		var readErr error
+		writeErr := writer.write(func(buf []byte) int {
+			dataStream.SetReadDeadline(time.Now().Add(BUFFER_HOLD_TIMEOUT))
+			nRead, readErr = dataStream.Read(buf)
+			return nRead
+		})
+
+		if writeErr != nil { return writeErr }
+
+		waitErr := writer.limiter.WaitN(writer.ctx, nRead)
+		if waitErr != nil { return waitErr }
+
+		if readErr == io.EOF && writer.remaining > 0 { return io.ErrUnexpectedEOF }
+		if readErr != nil && readErr != io.EOF && ! isTimeout(readErr) { return readErr }
+	}
+
+	return nil
+}
+
+// receiveCompressedChunk
+//	Decode a compressed chunk from the stream and write the decoded bytes.
+//	The decoder reads only the encoded bytes of the chunk, and whatever it leaves unread is discarded so the next header lines up.
+//	Pooled buffers are only taken once decoded data is ready, so no buffer is held while waiting on the stream or the rate limit.
+//	The rate limit applies to the encoded bytes, since those are what cross the network.
+func receiveCompressedChunk(dataStream quic.ReceiveStream, chunk *protocol.ChunkHeader, decoder compress.Decoder, writer *chunkWriter) error {
+	encoded := ratelimit.NewReader(writer.ctx, io.LimitReader(dataStream, int64(chunk.EncodedSize)), writer.limiter)
+	
+	resetErr := decoder.Reset(encoded)
+	if resetErr != nil { return shortChunk(resetErr) }
+
+	_, decodeErr := io.Copy(writer, decoder)
+	if decodeErr != nil { return shortChunk(decodeErr) }
+
+	_, drainErr := io.Copy(io.Discard, encoded)
+	if drainErr != nil { return drainErr }
+
+	if writer.remaining > 0 { return io.ErrUnexpectedEOF }
+	return nil
+}
+
+// shortChunk
+//	A chunk that ends before all of its encoded bytes arrive is reported as an unexpected EOF so the transfer can be retried.
+func shortChunk(err error) error {
+	if err == io.EOF { return io.ErrUnexpectedEOF }
+	return err
+}
+
+// isTimeout
+//	Whether a read ended because its deadline passed.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
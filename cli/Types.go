@@ -1,5 +1,22 @@
 package cli
 
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/pool"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+	"github.com/sirgallo/quicfiletransfer/common/ratelimit"
+	"github.com/sirgallo/quicfiletransfer/common/tuning"
+)
+
 
 // QuicClientOpts: options on client init
 type QuicClientOpts struct {
@@ -9,27 +26,297 @@ type QuicClientOpts struct {
 	RemotePort int
 	// ClientPort: the port the client starts the udp connection with
 	ClientPort int
-	// Streams: the number of streams the client should open (100 is default max)
-	Streams uint8
+	// Streams: the number of streams the client should open. The server may grant fewer based on its limits. In auto mode, the maximum number of streams
+	Streams uint16
+	// AutoStreams: start with a few streams and add or retire streams based on observed throughput and RTT
+	AutoStreams bool
 	// CheckMD5: optionally check the md5 file to ensure validity of data
 	CheckMd5 bool
+	// Logger: optional structured logger. If not provided, the client is silent
+	Logger logger.Logger
+	// Retry: the policy for retrying failed transfers. If not provided, DefaultRetryPolicy is used
+	Retry *RetryPolicy
+	// MemoryBudget: the most memory, in bytes, used for receive buffers at once across all streams and concurrent transfers on the client. 0 uses DEFAULT_MEMORY_BUDGET
+	MemoryBudget int64
+	// MaxRate: the most bytes per second received across every stream of every transfer on the client. 0 is unlimited
+	MaxRate int64
+	// Delta: if the destination file already exists, only transfer the blocks that differ from the remote file
+	Delta bool
+	// Compression: the codec to request for the transfer. CODEC_AUTO lets the server skip compression for incompressible files
+	Compression protocol.Codec
+	// Preallocate: reserve the blocks for the destination file with fallocate rather than creating a sparse file with truncate. Falls back to truncate where unsupported
+	Preallocate bool
+	// DirectIO: write the destination file with O_DIRECT, bypassing the page cache. Linux only, falls back to buffered writes where unsupported
+	DirectIO bool
+	// Preserve: the attributes of the remote file to apply to the destination once it is transferred and verified
+	Preserve protocol.AttrMask
+	// KeepPartial: keep the partial file of a failed transfer rather than removing it. The next transfer of the file resumes from the data it holds
+	KeepPartial bool
+	// Overwrite: how an existing destination file is handled. The zero value overwrites it
+	Overwrite OverwritePolicy
+	// Tuning: quic transport tuning, like tuning.HighBandwidthWAN for long, fast links. Zero values keep the client defaults
+	Tuning tuning.Options
+	// EventHandler: optional callback invoked for transfer lifecycle events (progress, retries, completion)
+	EventHandler func(*TransferEvent)
 }
 
 // QuicClient: the quic client implementation
 type QuicClient struct {
 	remoteAddress string
 	cliPort int
-	streams uint8
-	dstFile string
+	streams uint16
+	autoStreams bool
 	checkMd5 bool
+	delta bool
+	compression protocol.Codec
+	preallocate bool
+	directIO bool
+	preserve protocol.AttrMask
+	keepPartial bool
+	overwrite OverwritePolicy
+	tuning tuning.Options
+	logger logger.Logger
+	retry *RetryPolicy
+	eventHandler func(*TransferEvent)
+	bufferPool *pool.BufferPool
+	limiter *ratelimit.Limiter
 }
 
 // OpenConnectionOpts: options to pass when opening a new connection
 type OpenConnectionOpts struct {
 	// Insecure: tells the client to not verify server certs. Should only be used for testing
 	Insecure bool
+	// Certificate: the client certificate presented to servers that verify clients, identifying the client by its common name
+	Certificate *tls.Certificate
+}
+
+// RetryPolicy: determines if and when a failed transfer is retried
+type RetryPolicy struct {
+	// MaxAttempts: the total number of attempts, including the first. 1 disables retries
+	MaxAttempts int
+	// InitialBackoff: the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff: the upper bound on the delay between retries
+	MaxBackoff time.Duration
+	// Multiplier: the factor the delay grows by after each retry
+	Multiplier float64
+	// IsRetryable: classifies errors as transient. If not provided, IsRetryableError is used
+	IsRetryable func(error) bool
+}
+
+// TransferEventType: the kind of event emitted during a transfer
+type TransferEventType uint8
+
+const (
+	TRANSFER_STARTED TransferEventType = iota
+	TRANSFER_PROGRESS
+	TRANSFER_RETRY
+	TRANSFER_STREAMS_CHANGED
+	TRANSFER_COMPLETE
+	TRANSFER_FAILED
+	TRANSFER_SKIPPED
+)
+
+// TransferEvent: emitted to the client's event handler during a transfer
+type TransferEvent struct {
+	Type TransferEventType
+	// Path: the path of the file on the remote system
+	Path string
+	// Attempt: the current attempt, starting at 1
+	Attempt int
+	// BytesTransferred: the total bytes written to the destination so far
+	BytesTransferred uint64
+	// TotalBytes: the total bytes of the remote file, 0 if not yet known
+	TotalBytes uint64
+	// RetryDelay: for retry events, the backoff before the next attempt
+	RetryDelay time.Duration
+	// Streams: for stream change events, the number of data streams the client is now targeting
+	Streams int
+	// Err: for retry and failure events, the error that caused it
+	Err error
+}
+
+// OverwritePolicy: how the client handles a destination file that already exists
+type OverwritePolicy uint8
+
+const (
+	// OVERWRITE_ALWAYS: replace the existing file
+	OVERWRITE_ALWAYS OverwritePolicy = iota
+	// OVERWRITE_FAIL: fail the transfer, leaving the existing file as is
+	OVERWRITE_FAIL
+	// OVERWRITE_SKIP_IDENTICAL: skip the transfer if the existing file has the size and md5 of the remote file, otherwise replace it
+	OVERWRITE_SKIP_IDENTICAL
+	// OVERWRITE_SKIP_NEWER: skip the transfer if the existing file was modified after the remote file, otherwise replace it
+	OVERWRITE_SKIP_NEWER
+	// OVERWRITE_RENAME: keep the existing file by renaming it with a numbered suffix, like name.~1~, once the new file is ready to replace it
+	OVERWRITE_RENAME
+)
+
+// CompareMode: how a file present both locally and on the remote system is checked for changes during a sync
+type CompareMode uint8
+
+const (
+	// COMPARE_SIZE_MTIME: a file is unchanged if its size and modification time, to the second, match
+	COMPARE_SIZE_MTIME CompareMode = iota
+	// COMPARE_CHECKSUM: a file is unchanged if its size and md5 match. Every local file with a matching size is read
+	COMPARE_CHECKSUM
+)
+
+// SyncOpts: options for synchronizing a remote directory tree into a local one
+type SyncOpts struct {
+	// Remote: the path of the directory on the remote system
+	Remote string
+	// Local: the path of the local directory. Created if it does not exist
+	Local string
+	// Compare: how files present on both sides are checked for changes
+	Compare CompareMode
+	// Delete: remove local files and directories that do not exist on the remote system
+	Delete bool
+	// DryRun: plan the sync without creating, transferring, or deleting anything
+	DryRun bool
+	// Rules: filter rules for the tree, see filter.New. The server leaves excluded paths out of the manifest.
+	//	Local paths excluded by the rules, or by ignore files in the local tree, are neither compared nor deleted
+	Rules []string
+}
+
+// SyncActionType: the kind of change a sync makes to the local tree
+type SyncActionType uint8
+
+const (
+	SYNC_CREATE_DIR SyncActionType = iota
+	SYNC_NEW_FILE
+	SYNC_UPDATE_FILE
+	SYNC_DELETE
+	SYNC_CONFLICT
+)
+
+// SyncAction: a single change to the local tree
+type SyncAction struct {
+	Type SyncActionType
+	// Path: the slash separated path relative to the synced directories
+	Path string
+	// Size: for new and updated files, the size of the remote file
+	Size uint64
+	// Err: the error the action failed with, if any
+	Err error
+	modTime int64
+}
+
+// SyncResult: the changes planned, and unless in dry run mode made, by a sync
+type SyncResult struct {
+	Actions []SyncAction
+	// Unchanged: the number of files that already matched the remote system
+	Unchanged int
+	// Skipped: the number of changed files left as is by the overwrite policy
+	Skipped int
+	// Failed: the number of actions that failed. The rest of the sync still runs
+	Failed int
+	// BytesTransferred: the total size of the files transferred
+	BytesTransferred uint64
+}
+
+// clientConn: a connection to the server along with the transport that owns its udp connection
+type clientConn struct {
+	conn quic.Connection
+	transport *quic.Transport
+	stats *connStats
+}
+
+// connStats: connection level statistics sampled from the quic congestion controller
+type connStats struct {
+	smoothedRTT int64
+	minRTT int64
+}
+
+// dataStreamAcceptor: tracks the data streams accepted for an attempt against the total the server reports it opened
+type dataStreamAcceptor struct {
+	mu sync.Mutex
+	accepted int
+	expected int
+	cancel context.CancelFunc
+}
+
+// fileTransfer: the state for a single file transfer, kept across retry attempts
+type fileTransfer struct {
+	srcPath string
+	dstFile string
+	writePath string
+	basisFile string
+	resumed bool
+	dst *destination
+	fileSize uint64
+	sourceMd5 []byte
+	attrs *protocol.FileAttrs
+	tracker *rangeTracker
+	logger logger.Logger
+	attempt int
+}
+
+// destination: the local file a transfer writes to, shared by every stream with positional writes
+type destination struct {
+	file *os.File
+	direct *os.File
+	alignment int
+}
+
+// chunkWriter: writes the data of a single chunk to the destination in order, carrying a partial block between writes in O_DIRECT mode
+type chunkWriter struct {
+	ctx context.Context
+	transfer *fileTransfer
+	bufferPool *pool.BufferPool
+	limiter *ratelimit.Limiter
+	offset uint64
+	remaining uint64
+	carry []byte
+}
+
+// rangeTracker: tracks the byte ranges of a file that have been written to disk
+type rangeTracker struct {
+	mu sync.Mutex
+	required []protocol.Range
+	completed []protocol.Range
+	totalCompleted uint64
 }
 
 
 const HANDSHAKE_TIMEOUT = 3
-const WRITE_BUFFER_SIZE = 1024 * 1024 * 8 // 8MB
\ No newline at end of file
+const WRITE_BUFFER_SIZE = 1024 * 1024 * 8 // 8MB
+const DEFAULT_MEMORY_BUDGET = 1024 * 1024 * 256 // 256MB
+const BUFFER_HOLD_TIMEOUT = 100 * time.Millisecond
+const DIRECT_IO_ALIGNMENT = 4096
+const PARTIAL_SUFFIX = ".partial"
+const RESUME_SUFFIX = ".resume"
+const COMPARE_SIZE_MTIME_NAME = "size-mtime"
+const COMPARE_CHECKSUM_NAME = "checksum"
+const OVERWRITE_ALWAYS_NAME = "overwrite"
+const OVERWRITE_FAIL_NAME = "fail"
+const OVERWRITE_SKIP_IDENTICAL_NAME = "skip-identical"
+const OVERWRITE_SKIP_NEWER_NAME = "skip-newer"
+const OVERWRITE_RENAME_NAME = "rename"
+const BACKUP_SUFFIX_FORMAT = ".~%d~"
+
+const AUTO_INITIAL_STREAMS = 2
+const DEFAULT_AUTO_MAX_STREAMS = 64
+const AUTO_SAMPLE_INTERVAL = 1 * time.Second
+const AUTO_PROBE_INTERVAL = 5
+const AUTO_GAIN_THRESHOLD = 0.1
+const AUTO_RTT_INFLATION = 2
+const AUTO_MIN_QUEUEING_DELAY = 5 * time.Millisecond
+
+const DEFAULT_MAX_ATTEMPTS = 5
+const DEFAULT_INITIAL_BACKOFF = 500 * time.Millisecond
+const DEFAULT_MAX_BACKOFF = 30 * time.Second
+const DEFAULT_BACKOFF_MULTIPLIER = 2
+
+
+var ErrIncompleteTransfer = errors.New("transfer ended before all ranges were received")
+var ErrRemoteFileChanged = errors.New("remote file changed between attempts")
+var ErrMd5Mismatch = errors.New("md5 checksums did not match")
+var ErrSyncIncomplete = errors.New("one or more sync actions failed")
+var ErrUnknownCompareMode = errors.New("unknown compare mode, expected size-mtime or checksum")
+var ErrUnknownOverwritePolicy = errors.New("unknown overwrite policy, expected overwrite, fail, skip-identical, skip-newer, or rename")
+var ErrDestinationExists = errors.New("destination file already exists")
+var ErrRemoteNotFound = errors.New("remote file missing from manifest")
+var errCopyOutOfRange = errors.New("delta copy exceeds file size")
+var errChunkOverflow = errors.New("decoded chunk exceeds its size")
+var errDiskOpUnsupported = errors.New("operation not supported on this platform")
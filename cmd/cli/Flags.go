@@ -0,0 +1,126 @@
+package main
+
+import  (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/cli"
+	"github.com/sirgallo/quicfiletransfer/common/attrs"
+	"github.com/sirgallo/quicfiletransfer/common/compress"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/tuning"
+)
+
+
+// clientFlags: the flags shared by every command that creates a client
+type clientFlags struct {
+	host, compression, preserve, overwrite, certPath, keyPath, quicPreset, logLevel string
+	port, cliport, streams, retries, memoryBudgetMB, maxStreamWindowMB, maxConnectionWindowMB int
+	maxRateMB float64
+	maxIdleTimeout, handshakeTimeout time.Duration
+	insecure, checkMd5, autoStreams, preallocate, directIO, useDelta, keepPartial bool
+}
+
+
+// registerClientFlags
+//	Register the flags for creating a client on a flag set.
+func registerClientFlags(fs *flag.FlagSet) *clientFlags {
+	flags := &clientFlags{}
+
+	fs.StringVar(&flags.host, "host", "127.0.0.1", "the host where the remote file exists")
+	fs.IntVar(&flags.port, "port", 1234, "the port serving the file")
+	fs.IntVar(&flags.cliport, "cliPort", 1235, "the port the client establishes udp connection on")
+	fs.IntVar(&flags.streams, "streams", STREAMS, "determine the total number of streams to launch for a connection")
+	fs.BoolVar(&flags.insecure, "insecure", false, "whether or not to use an insecure connection")
+	fs.StringVar(&flags.certPath, "certPath", "", "the path to a client certificate, for servers that verify clients")
+	fs.StringVar(&flags.keyPath, "keyPath", "", "the path to the private key for the client certificate")
+	fs.BoolVar(&flags.autoStreams, "autoStreams", false, "start with a few streams and adapt the stream count to observed throughput. -streams becomes the maximum")
+	fs.BoolVar(&flags.checkMd5, "checkMd5", false, "whether or not to additionally compute + check the md5checksum for the file")
+	fs.IntVar(&flags.retries, "retries", cli.DEFAULT_MAX_ATTEMPTS - 1, "the number of times to retry a transfer that failed with a transient error")
+	fs.IntVar(&flags.memoryBudgetMB, "memoryBudget", cli.DEFAULT_MEMORY_BUDGET / (1024 * 1024), "the most memory in MB used for receive buffers across all streams")
+	fs.Float64Var(&flags.maxRateMB, "maxRate", 0, "the most MB per second to receive across all streams. 0 is unlimited")
+	fs.StringVar(&flags.compression, "compression", compress.NONE, "compress chunks on the wire (none, gzip, zstd, auto). auto skips compression for incompressible files")
+	fs.BoolVar(&flags.useDelta, "delta", false, "if the destination file already exists, only transfer the blocks that differ from the remote file")
+	fs.BoolVar(&flags.preallocate, "preallocate", false, "reserve the blocks for the destination file up front with fallocate instead of creating a sparse file")
+	fs.BoolVar(&flags.directIO, "directIO", false, "write the destination file with O_DIRECT, bypassing the page cache (linux only)")
+	fs.BoolVar(&flags.keepPartial, "keepPartial", false, "keep the partial file of a failed transfer for inspection, the next transfer of the file resumes from it")
+	fs.StringVar(&flags.preserve, "preserve", attrs.NONE, "comma separated attributes of the remote file to preserve once it is verified (mode, times, owner, xattrs, all, none)")
+	fs.StringVar(&flags.overwrite, "overwrite", cli.OVERWRITE_ALWAYS_NAME, "how an existing destination file is handled (overwrite, fail, skip-identical, skip-newer, rename)")
+	fs.StringVar(&flags.quicPreset, "quicPreset", tuning.DEFAULT_PRESET, "the quic transport tuning preset (default, wan). wan uses large flow control windows and long timeouts for fast, high latency links")
+	fs.IntVar(&flags.maxStreamWindowMB, "maxStreamWindow", 0, "the largest the flow control window of a stream may grow to, in MB. 0 keeps the preset")
+	fs.IntVar(&flags.maxConnectionWindowMB, "maxConnectionWindow", 0, "the largest the flow control window of the connection may grow to, in MB. 0 keeps the preset")
+	fs.DurationVar(&flags.maxIdleTimeout, "maxIdleTimeout", 0, "how long the connection may go without network activity before it is closed. 0 keeps the preset")
+	fs.DurationVar(&flags.handshakeTimeout, "handshakeTimeout", 0, "how long to wait for a connection to be established. 0 keeps the preset")
+	fs.StringVar(&flags.logLevel, "logLevel", "info", "the minimum log level to output (debug, info, warn, error, silent)")
+
+	return flags
+}
+
+// newClient
+//	Validate the parsed flags and create the client, along with the options for its connections.
+func (flags *clientFlags) newClient() (*cli.QuicClient, *cli.OpenConnectionOpts, error) {
+	if flags.streams < 1 || flags.streams > math.MaxUint16 { return nil, nil, fmt.Errorf("streams must be between 1 and %d", math.MaxUint16) }
+
+	codec, parseCodecErr := compress.ParseCodec(flags.compression)
+	if parseCodecErr != nil { return nil, nil, parseCodecErr }
+
+	preserve, parsePreserveErr := attrs.ParseMask(flags.preserve)
+	if parsePreserveErr != nil { return nil, nil, parsePreserveErr }
+
+	overwrite, parseOverwriteErr := cli.ParseOverwritePolicy(flags.overwrite)
+	if parseOverwriteErr != nil { return nil, nil, parseOverwriteErr }
+
+	preset, presetErr := tuning.Preset(flags.quicPreset)
+	if presetErr != nil { return nil, nil, presetErr }
+
+	tuningOpts := preset.Merge(tuning.Options{
+		MaxStreamReceiveWindow: uint64(flags.maxStreamWindowMB) * 1024 * 1024,
+		MaxConnectionReceiveWindow: uint64(flags.maxConnectionWindowMB) * 1024 * 1024,
+		MaxIdleTimeout: flags.maxIdleTimeout,
+		HandshakeTimeout: flags.handshakeTimeout,
+	})
+
+	level, parseLevelErr := logger.ParseLevel(flags.logLevel)
+	if parseLevelErr != nil { return nil, nil, parseLevelErr }
+
+	retryPolicy := cli.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = flags.retries + 1
+
+	cliOpts := &cli.QuicClientOpts{
+		RemoteHost: flags.host,
+		RemotePort: flags.port,
+		ClientPort: flags.cliport,
+		Streams: uint16(flags.streams),
+		AutoStreams: flags.autoStreams,
+		CheckMd5: flags.checkMd5,
+		Logger: logger.NewStdLogger(os.Stderr, level),
+		Retry: retryPolicy,
+		MemoryBudget: int64(flags.memoryBudgetMB) * 1024 * 1024,
+		MaxRate: int64(flags.maxRateMB * 1024 * 1024),
+		Compression: codec,
+		Delta: flags.useDelta,
+		Preallocate: flags.preallocate,
+		DirectIO: flags.directIO,
+		Preserve: preserve,
+		KeepPartial: flags.keepPartial,
+		Overwrite: overwrite,
+		Tuning: tuningOpts,
+	}
+
+	client, newCliErr := cli.NewClient(cliOpts)
+	if newCliErr != nil { return nil, nil, newCliErr }
+
+	connectOpts := &cli.OpenConnectionOpts{ Insecure: flags.insecure }
+	if flags.certPath != "" || flags.keyPath != "" {
+		cert, loadCertErr := tls.LoadX509KeyPair(flags.certPath, flags.keyPath)
+		if loadCertErr != nil { return nil, nil, loadCertErr }
+
+		connectOpts.Certificate = &cert
+	}
+
+	return client, connectOpts, nil
+}
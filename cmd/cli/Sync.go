@@ -0,0 +1,105 @@
+package main
+
+import  (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/sirgallo/quicfiletransfer/cli"
+)
+
+
+// ruleFlag: a repeatable flag that adds filter rules to a shared, ordered list
+type ruleFlag struct {
+	rules *[]string
+	negate bool
+}
+
+
+// runSync
+//	Mirror a remote directory into a local one.
+//	Usage: sync [flags] [host:]remoteDir localDir
+//	A host in the remote argument takes the place of -host.
+func runSync(args []string) {
+	fs := flag.NewFlagSet(SYNC_COMMAND, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s [flags] [host:]remoteDir localDir\n", os.Args[0], SYNC_COMMAND)
+		fs.PrintDefaults()
+	}
+
+	var compare string
+	var deleteExtraneous, dryRun bool
+	var rules []string
+
+	flags := registerClientFlags(fs)
+	fs.StringVar(&compare, "compare", cli.COMPARE_SIZE_MTIME_NAME, "how files present on both sides are checked for changes (size-mtime, checksum)")
+	fs.BoolVar(&deleteExtraneous, "delete", false, "remove local files and directories that do not exist on the remote system")
+	fs.BoolVar(&dryRun, "dryRun", false, "print the changes the sync would make without making them")
+	fs.Var(&ruleFlag{ rules: &rules }, "exclude", "exclude paths matching a gitignore-style pattern, or a predicate like size>100M or age>30d. Can be repeated")
+	fs.Var(&ruleFlag{ rules: &rules, negate: true }, "include", "re-include paths excluded by an earlier rule. Can be repeated")
+
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	host, remoteDir := splitRemote(fs.Arg(0))
+	if host != "" { flags.host = host }
+
+	compareMode, parseCompareErr := cli.ParseCompareMode(compare)
+	if parseCompareErr != nil { log.Fatal(parseCompareErr) }
+
+	client, openOpts, newCliErr := flags.newClient()
+	if newCliErr != nil { log.Fatal(newCliErr) }
+
+	syncOpts := &cli.SyncOpts{ Remote: remoteDir, Local: fs.Arg(1), Compare: compareMode, Delete: deleteExtraneous, DryRun: dryRun, Rules: rules }
+	result, syncErr := client.Sync(openOpts, syncOpts)
+	if result == nil { log.Fatal(syncErr) }
+
+	for _, action := range result.Actions {
+		switch {
+			case action.Err != nil:
+				fmt.Printf("%-7s %s: %v\n", action.Type, action.Path, action.Err)
+			case action.Type == cli.SYNC_NEW_FILE || action.Type == cli.SYNC_UPDATE_FILE:
+				fmt.Printf("%-7s %s (%d bytes)\n", action.Type, action.Path, action.Size)
+			default:
+				fmt.Printf("%-7s %s\n", action.Type, action.Path)
+		}
+	}
+
+	fmt.Printf("%d changes, %d unchanged, %d skipped, %d failed, %d bytes transferred\n", len(result.Actions), result.Unchanged, result.Skipped, result.Failed, result.BytesTransferred)
+	if syncErr != nil { log.Fatal(syncErr) }
+}
+
+// String
+//	The rules added by the flag so far.
+func (f *ruleFlag) String() string {
+	if f.rules == nil { return "" }
+	return strings.Join(*f.rules, ", ")
+}
+
+// Set
+//	Add a rule. Include and exclude flags share the same list, so rules keep the order they were given in.
+func (f *ruleFlag) Set(value string) error {
+	if f.negate { value = "!" + value }
+	*f.rules = append(*f.rules, value)
+	return nil
+}
+
+// splitRemote
+//	Split a remote argument like host:/data into its host and path. Without a host, the whole argument is the path.
+//	IPv6 hosts are written in brackets, like [::1]:/data.
+func splitRemote(arg string) (string, string) {
+	if strings.HasPrefix(arg, "[") {
+		end := strings.Index(arg, "]:")
+		if end > 0 { return arg[1:end], arg[end + 2:] }
+	}
+
+	colon := strings.Index(arg, ":")
+	if colon <= 0 || strings.Contains(arg[:colon], "/") { return "", arg }
+
+	return arg[:colon], arg[colon + 1:]
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/srv"
+)
+
+
+// adminClient: sends requests to the admin api of a running server
+type adminClient struct {
+	http *http.Client
+	baseURL string
+}
+
+
+const ADMIN_SOCKET_HOST = "admin"
+const ADMIN_SOCKET_MODE = 0600
+const ADMIN_REQUEST_TIMEOUT = 10 * time.Second
+const BYTES_PER_MB = 1024 * 1024
+
+
+// serveAdmin
+//	Serve the admin api in the background, on a unix socket only the user running the server can connect to, or on a tcp listener.
+//	A socket left behind by a server that did not exit cleanly is removed first.
+func serveAdmin(server *srv.QuicServer, adminCfg srv.AdminConfig, reload func() error) *http.Server {
+	network, address := "tcp", adminCfg.Listen
+	if adminCfg.Socket != "" {
+		network, address = "unix", adminCfg.Socket
+
+		info, statErr := os.Lstat(address)
+		if statErr == nil && info.Mode() & os.ModeSocket != 0 { os.Remove(address) }
+	}
+
+	listener, listenErr := net.Listen(network, address)
+	if listenErr != nil { log.Fatal(listenErr) }
+
+	if network == "unix" {
+		chmodErr := os.Chmod(address, ADMIN_SOCKET_MODE)
+		if chmodErr != nil { log.Fatal(chmodErr) }
+	}
+
+	adminServer := &http.Server{ Handler: server.AdminHandler(&srv.AdminOpts{ Reload: reload }), ReadHeaderTimeout: METRICS_READ_HEADER_TIMEOUT }
+	go func() {
+		serveErr := adminServer.Serve(listener)
+		if serveErr != http.ErrServerClosed { log.Fatal(serveErr) }
+	}()
+
+	log.Printf("serving admin api on %s %s\n", network, address)
+	return adminServer
+}
+
+// runAdmin
+//	Manage a running server through its admin api.
+//	Usage: admin [flags] command [args]
+func runAdmin(args []string) {
+	fs := flag.NewFlagSet(ADMIN_COMMAND, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s [flags] command [args]\n\ncommands:\n", os.Args[0], ADMIN_COMMAND)
+		fmt.Fprintln(fs.Output(), "  info                      build info and state of the server")
+		fmt.Fprintln(fs.Output(), "  connections               list open connections")
+		fmt.Fprintln(fs.Output(), "  transfers                 list transfers in progress")
+		fmt.Fprintln(fs.Output(), "  cancel id                 cancel a transfer")
+		fmt.Fprintln(fs.Output(), "  rates [set key=MB ...]    show the rate limits, or set any of global, perConnection, perClient in MB per second")
+		fmt.Fprintln(fs.Output(), "  reload                    reload the config file and command line, applying exports and rates")
+		fmt.Fprintf(fs.Output(), "\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	var socket, addr string
+	fs.StringVar(&socket, "socket", "", "the unix socket the server serves the admin api on (-adminSocket)")
+	fs.StringVar(&addr, "addr", "", "the host:port the server serves the admin api on (-adminListen)")
+
+	fs.Parse(args)
+	if fs.NArg() == 0 || (socket == "") == (addr == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	client := newAdminClient(socket, addr)
+
+	var commandErr error
+	switch command := fs.Arg(0); command {
+		case "info":
+			commandErr = client.info()
+		case "connections":
+			commandErr = client.connections()
+		case "transfers":
+			commandErr = client.transfers()
+		case "cancel":
+			if fs.NArg() != 2 {
+				fs.Usage()
+				os.Exit(2)
+			}
+
+			commandErr = client.cancel(fs.Arg(1))
+		case "rates":
+			commandErr = client.rates(fs.Args()[1:])
+		case "reload":
+			commandErr = client.do(http.MethodPost, srv.ADMIN_RELOAD_PATH, nil, nil)
+			if commandErr == nil { fmt.Println("config reloaded") }
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", command)
+			fs.Usage()
+			os.Exit(2)
+	}
+
+	if commandErr != nil { log.Fatal(commandErr) }
+}
+
+// newAdminClient
+//	Create a client for the admin api on a unix socket or at a host:port.
+func newAdminClient(socket, addr string) *adminClient {
+	if socket == "" { return &adminClient{ http: &http.Client{ Timeout: ADMIN_REQUEST_TIMEOUT }, baseURL: "http://" + addr } }
+
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &adminClient{ http: &http.Client{ Transport: transport, Timeout: ADMIN_REQUEST_TIMEOUT }, baseURL: "http://" + ADMIN_SOCKET_HOST }
+}
+
+// info
+//	Print the build info and state of the server.
+func (client *adminClient) info() error {
+	var info srv.ServerInfo
+	getErr := client.do(http.MethodGet, srv.ADMIN_INFO_PATH, nil, &info)
+	if getErr != nil { return getErr }
+
+	version := info.Build.Version
+	if info.Build.Revision != "" { version += " (" + info.Build.Revision + ")" }
+	if info.Build.Modified { version += " modified" }
+
+	fmt.Printf("module:      %s\n", info.Build.Module)
+	fmt.Printf("version:     %s\n", version)
+	fmt.Printf("go:          %s\n", info.Build.GoVersion)
+	fmt.Printf("state:       %s\n", info.State)
+	fmt.Printf("uptime:      %s\n", time.Since(info.Started).Round(time.Second))
+	fmt.Printf("connections: %d\n", info.Connections)
+	fmt.Printf("transfers:   %d\n", info.Transfers)
+	printRates(info.Rates)
+
+	return nil
+}
+
+// connections
+//	Print a table of the open connections.
+func (client *adminClient) connections() error {
+	var connections []srv.ConnectionInfo
+	getErr := client.do(http.MethodGet, srv.ADMIN_CONNECTIONS_PATH, nil, &connections)
+	if getErr != nil { return getErr }
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREMOTE\tCLIENT\tCONNECTED\tTRANSFERS")
+	for _, conn := range connections {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", conn.ID, conn.Remote, conn.Client, time.Since(conn.Connected).Round(time.Second), conn.Transfers)
+	}
+
+	return w.Flush()
+}
+
+// transfers
+//	Print a table of the transfers in progress, with their progress and average rate.
+func (client *adminClient) transfers() error {
+	var transfers []srv.TransferInfo
+	getErr := client.do(http.MethodGet, srv.ADMIN_TRANSFERS_PATH, nil, &transfers)
+	if getErr != nil { return getErr }
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCONN\tCLIENT\tPATH\tPROGRESS\tRATE\tSTREAMS\tELAPSED")
+	for _, transfer := range transfers {
+		elapsed := time.Since(transfer.Started)
+
+		percent := 100.0
+		if transfer.Size > 0 { percent = float64(transfer.Sent) / float64(transfer.Size) * 100 }
+
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%.1f/%.1fMB (%.0f%%)\t%.1fMB/s\t%d\t%s\n",
+			transfer.ID, transfer.ConnID, transfer.Client, transfer.Path,
+			float64(transfer.Sent) / BYTES_PER_MB, float64(transfer.Size) / BYTES_PER_MB, percent,
+			float64(transfer.Sent) / BYTES_PER_MB / elapsed.Seconds(),
+			transfer.Streams, elapsed.Round(time.Second),
+		)
+	}
+
+	return w.Flush()
+}
+
+// cancel
+//	Cancel a transfer by id.
+func (client *adminClient) cancel(id string) error {
+	_, parseErr := strconv.ParseUint(id, 10, 64)
+	if parseErr != nil { return fmt.Errorf("invalid transfer id %q", id) }
+
+	cancelErr := client.do(http.MethodPost, srv.ADMIN_TRANSFERS_PATH + "/" + id + srv.ADMIN_CANCEL_SUFFIX, nil, nil)
+	if cancelErr != nil { return cancelErr }
+
+	fmt.Printf("transfer %s canceled\n", id)
+	return nil
+}
+
+// rates
+//	Print the rate limits. With set, change the limits that apply outside of scheduled windows given as key=MB, keeping the others.
+func (client *adminClient) rates(args []string) error {
+	var status srv.RateStatus
+	getErr := client.do(http.MethodGet, srv.ADMIN_RATES_PATH, nil, &status)
+	if getErr != nil { return getErr }
+
+	if len(args) == 0 {
+		printRates(status)
+		return nil
+	}
+
+	if args[0] != "set" || len(args) == 1 { return errors.New("usage: rates [set global=MB perConnection=MB perClient=MB]") }
+
+	limits := status.Base
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		rateMB, parseErr := strconv.ParseFloat(value, 64)
+		if ! ok || parseErr != nil || rateMB < 0 { return fmt.Errorf("invalid rate %q, expected key=MB", arg) }
+
+		rate := int64(rateMB * BYTES_PER_MB)
+		switch key {
+			case "global":
+				limits.Global = rate
+			case "perConnection":
+				limits.PerConnection = rate
+			case "perClient":
+				limits.PerClient = rate
+			default:
+				return fmt.Errorf("unknown rate %q, expected global, perConnection, or perClient", key)
+		}
+	}
+
+	putErr := client.do(http.MethodPut, srv.ADMIN_RATES_PATH, limits, &status)
+	if putErr != nil { return putErr }
+
+	printRates(status)
+	return nil
+}
+
+// do
+//	Send a request to the admin api, encoding the body and decoding the response as JSON. Error responses are returned as errors.
+func (client *adminClient) do(method, path string, body, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, marshalErr := json.Marshal(body)
+		if marshalErr != nil { return marshalErr }
+
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	req, newReqErr := http.NewRequest(method, client.baseURL + path, reqBody)
+	if newReqErr != nil { return newReqErr }
+
+	resp, doErr := client.http.Do(req)
+	if doErr != nil { return doErr }
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var adminErr srv.AdminError
+		decodeErr := json.NewDecoder(resp.Body).Decode(&adminErr)
+		if decodeErr != nil || adminErr.Error == "" { return fmt.Errorf("admin api returned %s", resp.Status) }
+
+		return errors.New(adminErr.Error)
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent { return nil }
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// printRates
+//	Print the rate limits in effect in MB per second, along with the limits outside of scheduled windows while one is active.
+func printRates(status srv.RateStatus) {
+	fmt.Printf("rate global:        %s\n", formatRate(status.Current.Global))
+	fmt.Printf("rate perConnection: %s\n", formatRate(status.Current.PerConnection))
+	fmt.Printf("rate perClient:     %s\n", formatRate(status.Current.PerClient))
+	if status.WindowActive {
+		fmt.Printf("scheduled window active, outside of it: global %s, perConnection %s, perClient %s\n",
+			formatRate(status.Base.Global), formatRate(status.Base.PerConnection), formatRate(status.Base.PerClient),
+		)
+	}
+}
+
+// formatRate
+//	Format a rate in bytes per second as MB per second.
+func formatRate(rate int64) string {
+	if rate == 0 { return "unlimited" }
+	return strconv.FormatFloat(float64(rate) / BYTES_PER_MB, 'f', -1, 64) + "MB/s"
+}
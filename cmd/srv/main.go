@@ -1,62 +1,167 @@
 package main
 
 import ( 
-	"crypto/tls"
+	"context"
 	"flag"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/sirgallo/quicfiletransfer/srv"
-
-	customtls "github.com/sirgallo/quicfiletransfer/common/tls"
 )
 
 
-const HOST = "0.0.0.0"
-const PORT = 1234
-const ORG = "test"
+const ADMIN_COMMAND = "admin"
+const METRICS_READ_HEADER_TIMEOUT = 5 * time.Second
 
 
 func main() {
-	var host, org, certPath, keyPath string
-	var port int
-	var enableTracer bool
-
-	flag.StringVar(&host, "host", HOST, "the host IP/domain for the quic server")
-	flag.IntVar(&port, "port", PORT, "the port tot listen on")
-	flag.StringVar(&org, "org", ORG, "the organization for self signed certs")
-	flag.StringVar(&certPath, "certPath", "", "the path to the cert. If not provided will generate self signed")
-	flag.StringVar(&keyPath, "keyPath", "", "the path the private key. If not provided will generate self signed")
-	flag.BoolVar(&enableTracer, "enableTracer", false, "enable the tracer. This creates a log file in the working directory")
-
-	flag.Parse()
-
-	var cert *tls.Certificate
-	switch {
-		case certPath == "" || keyPath == "":
-			srvSelfSigned, genSrvCertErr := customtls.GenerateTLSCert(ORG)
-			if genSrvCertErr != nil { log.Fatal(genSrvCertErr) }
-	
-			cert = srvSelfSigned
-		default:
-			fCert, readCertErr := os.ReadFile(certPath)
-			if readCertErr != nil { log.Fatalf("Failed to read certificate file: %v", readCertErr) }
-		
-			fKey, readKeyErr := os.ReadFile(keyPath)
-			if readKeyErr != nil { log.Fatalf("Failed to read private key file: %v", readKeyErr) }
-
-			tlsCert, getCertErr := tls.X509KeyPair(fCert, fKey)
-			if getCertErr != nil { log.Fatalf("Failed to load certificate: %v", getCertErr) }
-
-			cert = &tlsCert
+	if len(os.Args) > 1 && os.Args[1] == ADMIN_COMMAND {
+		runAdmin(os.Args[2:])
+		return
 	}
 
-	srvOpts := &srv.QuicServerOpts{ Host: host, Port: port, TlsCert: cert, EnableTracer: enableTracer }
+	cfg, loadErr := loadConfig(flag.CommandLine, os.Args[1:])
+	if loadErr != nil { log.Fatal(loadErr) }
+
+	srvOpts, optsErr := cfg.ServerOpts()
+	if optsErr != nil { log.Fatal(optsErr) }
+
 	server, newSrvErr := srv.NewQuicServer(srvOpts)
 	if newSrvErr != nil { log.Fatal(newSrvErr) }
 
+	if cfg.Metrics.Listen != "" {
+		metricsServer := serveMetrics(server, cfg.Metrics)
+		defer metricsServer.Close()
+	}
+
+	if cfg.Admin.Socket != "" || cfg.Admin.Listen != "" {
+		adminServer := serveAdmin(server, cfg.Admin, func() error { return reloadConfig(server) })
+		defer adminServer.Close()
+	}
+
+	shutdownDone := make(chan struct{})
+	go handleSignals(server, time.Duration(cfg.ShutdownTimeout), shutdownDone)
+
 	err := server.Listen()
-	if err != nil { log.Fatal(err) }
+	if err != srv.ErrServerClosed { log.Fatal(err) }
+
+	<-shutdownDone
+}
+
+// loadConfig
+//	Build the configuration from the defaults, the config file given with -config, and the flags on the command line, which override the file.
+//	Flags are parsed before the file is loaded, to find it, then again after, to set them over it.
+func loadConfig(fs *flag.FlagSet, args []string) (*srv.Config, error) {
+	var configPath string
+	cfg := srv.DefaultConfig()
+	bindFlags(fs, cfg, &configPath)
+
+	parseErr := fs.Parse(args)
+	if parseErr != nil { return nil, parseErr }
+
+	if configPath != "" {
+		loadErr := cfg.Load(configPath)
+		if loadErr != nil { return nil, loadErr }
+
+		fs.Parse(args)
+	}
+
+	validateErr := cfg.Validate()
+	if validateErr != nil { return nil, validateErr }
+
+	return cfg, nil
+}
+
+// bindFlags
+//	Register a flag for every configuration field that can be set on the command line, defaulting to its current value.
+func bindFlags(fs *flag.FlagSet, cfg *srv.Config, configPath *string) {
+	fs.StringVar(configPath, "config", "", "the path to a JSON config file. Flags given on the command line override it")
+	fs.StringVar(&cfg.Listen.Host, "host", cfg.Listen.Host, "the host IP/domain for the quic server")
+	fs.IntVar(&cfg.Listen.Port, "port", cfg.Listen.Port, "the port tot listen on")
+	fs.StringVar(&cfg.TLS.Org, "org", cfg.TLS.Org, "the organization for self signed certs")
+	fs.StringVar(&cfg.TLS.CertPath, "certPath", cfg.TLS.CertPath, "the path to the cert. If not provided will generate self signed")
+	fs.StringVar(&cfg.TLS.KeyPath, "keyPath", cfg.TLS.KeyPath, "the path the private key. If not provided will generate self signed")
+	fs.StringVar(&cfg.TLS.ClientCAPath, "clientCAPath", cfg.TLS.ClientCAPath, "the path to the certificate authorities client certificates are verified against")
+	fs.BoolVar(&cfg.TLS.RequireClientCert, "requireClientCert", cfg.TLS.RequireClientCert, "refuse clients without a verified certificate")
+	fs.BoolVar(&cfg.Log.Tracer, "enableTracer", cfg.Log.Tracer, "enable the tracer. This creates a log file in the working directory")
+	fs.IntVar(&cfg.Limits.MaxStreamsPerConnection, "maxStreamsPerConnection", cfg.Limits.MaxStreamsPerConnection, "the most data streams open at once across all transfers on a connection")
+	fs.IntVar(&cfg.Limits.MaxStreamsPerRequest, "maxStreamsPerRequest", cfg.Limits.MaxStreamsPerRequest, "the most data streams open at once for a single transfer")
+	fs.Float64Var(&cfg.Rates.MaxRate, "maxRate", cfg.Rates.MaxRate, "the most MB per second sent across all connections. 0 is unlimited")
+	fs.Float64Var(&cfg.Rates.MaxRatePerConnection, "maxRatePerConnection", cfg.Rates.MaxRatePerConnection, "the most MB per second sent on a single connection. 0 is unlimited")
+	fs.Float64Var(&cfg.Rates.MaxRatePerClient, "maxRatePerClient", cfg.Rates.MaxRatePerClient, "the most MB per second sent across all connections from a single client. 0 is unlimited")
+	fs.StringVar(&cfg.Rates.Schedule, "rateSchedule", cfg.Rates.Schedule, "daily windows with their own global rate limit, like \"mon-fri 09:00-17:00 100; 22:00-06:00 0\". Outside every window, -maxRate applies")
+	fs.StringVar(&cfg.Quic.Preset, "quicPreset", cfg.Quic.Preset, "the quic transport tuning preset (default, wan). Tuning set in the config file overrides it")
+	fs.DurationVar((*time.Duration)(&cfg.Quic.MaxIdleTimeout), "maxIdleTimeout", time.Duration(cfg.Quic.MaxIdleTimeout), "how long a connection may go without network activity before it is closed. 0 keeps the preset")
+	fs.DurationVar((*time.Duration)(&cfg.Quic.HandshakeTimeout), "handshakeTimeout", time.Duration(cfg.Quic.HandshakeTimeout), "how long a handshake may go without progress before it fails. 0 keeps the preset")
+	fs.DurationVar((*time.Duration)(&cfg.ShutdownTimeout), "shutdownTimeout", time.Duration(cfg.ShutdownTimeout), "how long to wait for in flight transfers to finish on SIGINT or SIGTERM before closing connections")
+	fs.StringVar(&cfg.Log.Level, "logLevel", cfg.Log.Level, "the minimum log level to output (debug, info, warn, error, silent)")
+	fs.StringVar(&cfg.Log.Path, "logPath", cfg.Log.Path, "a file to append logs to instead of stderr")
+	fs.StringVar(&cfg.Admin.Socket, "adminSocket", cfg.Admin.Socket, "the path of a unix socket to serve the admin api on, for the admin subcommand. If not provided, the admin api is not served")
+	fs.StringVar(&cfg.Admin.Listen, "adminListen", cfg.Admin.Listen, "the host:port to serve the admin api on over http instead of a unix socket. Requests are not authenticated, so keep it local")
+	fs.StringVar(&cfg.Metrics.Listen, "metricsListen", cfg.Metrics.Listen, "the host:port to serve prometheus metrics on over http, like 127.0.0.1:9100. If not provided, metrics are not served")
+	fs.StringVar(&cfg.Audit.Path, "auditPath", cfg.Audit.Path, "a file to append a JSON audit record of every request to. If not provided, requests are not audited")
+	fs.IntVar(&cfg.Audit.MaxSizeMB, "auditMaxSize", cfg.Audit.MaxSizeMB, "the size in MB the audit log grows to before it is rotated")
+	fs.IntVar(&cfg.Audit.MaxFiles, "auditMaxFiles", cfg.Audit.MaxFiles, "the most rotated audit logs to keep, removing the oldest. 0 keeps every rotated log")
+
+}
+
+// reloadConfig
+//	Build the configuration again from the config file and the original command line, and apply what can change while the server runs.
+func reloadConfig(server *srv.QuicServer) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	cfg, loadErr := loadConfig(fs, os.Args[1:])
+	if loadErr != nil { return loadErr }
+
+	return server.ApplyConfig(cfg)
+}
+
+// serveMetrics
+//	Serve the server's metrics over http in the background. The listener is meant to be local, or reachable only by the scraper, since metrics are served without auth.
+func serveMetrics(server *srv.QuicServer, metricsCfg srv.MetricsConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(metricsCfg.Path, server.Metrics().Handler())
+
+	metricsServer := &http.Server{ Addr: metricsCfg.Listen, Handler: mux, ReadHeaderTimeout: METRICS_READ_HEADER_TIMEOUT }
+	go func() {
+		listenErr := metricsServer.ListenAndServe()
+		if listenErr != http.ErrServerClosed { log.Fatal(listenErr) }
+	}()
+
+	log.Printf("serving metrics on http://%s%s\n", metricsCfg.Listen, metricsCfg.Path)
+	return metricsServer
+}
+
+// handleSignals
+//	Gracefully shut down the server on SIGINT or SIGTERM, waiting up to the timeout for in flight transfers.
+//	A second signal closes every connection immediately.
+func handleSignals(server *srv.QuicServer, timeout time.Duration, done chan struct{}) {
+	defer close(done)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-signals
+	log.Printf("received %s, shutting down\n", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go func() {
+		select {
+			case <-signals:
+				log.Println("received second signal, closing connections")
+				cancel()
+			case <-ctx.Done():
+		}
+	}()
 
-	select{}
+	shutdownErr := server.Shutdown(ctx)
+	if shutdownErr != nil { log.Printf("shutdown incomplete: %v\n", shutdownErr) }
 }
\ No newline at end of file
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/srv"
+)
+
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	writeErr := os.WriteFile(configPath, []byte(`{ "listen": { "port": 2000 }, "log": { "level": "debug" }, "rates": { "maxRate": 50 } }`), 0644)
+	if writeErr != nil { t.Fatal(writeErr) }
+
+	tests := []struct {
+		name string
+		args []string
+		port int
+		level string
+		maxRate float64
+		host string
+	}{
+		{ "defaults", nil, srv.DEFAULT_PORT, srv.DEFAULT_LOG_LEVEL, 0, srv.DEFAULT_HOST },
+		{ "flags over defaults", []string{ "-port", "3000" }, 3000, srv.DEFAULT_LOG_LEVEL, 0, srv.DEFAULT_HOST },
+		{ "file over defaults", []string{ "-config", configPath }, 2000, "debug", 50, srv.DEFAULT_HOST },
+		{ "flags over file", []string{ "-config", configPath, "-port", "3000", "-maxRate", "10" }, 3000, "debug", 10, srv.DEFAULT_HOST },
+		{ "flags before the config flag still win", []string{ "-port", "3000", "-config", configPath }, 3000, "debug", 50, srv.DEFAULT_HOST },
+		{ "flag set to the default still overrides the file", []string{ "-config", configPath, "-logLevel", srv.DEFAULT_LOG_LEVEL }, 2000, srv.DEFAULT_LOG_LEVEL, 50, srv.DEFAULT_HOST },
+		{ "flags the file does not set", []string{ "-config", configPath, "-host", "127.0.0.1" }, 2000, "debug", 50, "127.0.0.1" },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+
+			cfg, loadErr := loadConfig(fs, test.args)
+			if loadErr != nil { t.Fatal(loadErr) }
+
+			if cfg.Listen.Port != test.port { t.Errorf("expected port %d, got %d", test.port, cfg.Listen.Port) }
+			if cfg.Log.Level != test.level { t.Errorf("expected log level %q, got %q", test.level, cfg.Log.Level) }
+			if cfg.Rates.MaxRate != test.maxRate { t.Errorf("expected max rate %v, got %v", test.maxRate, cfg.Rates.MaxRate) }
+			if cfg.Listen.Host != test.host { t.Errorf("expected host %q, got %q", test.host, cfg.Listen.Host) }
+			if time.Duration(cfg.ShutdownTimeout) != srv.DEFAULT_SHUTDOWN_TIMEOUT { t.Errorf("expected the default shutdown timeout, got %v", cfg.ShutdownTimeout) }
+		})
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{ "unknown flag", []string{ "-prot", "3000" } },
+		{ "missing config file", []string{ "-config", filepath.Join(t.TempDir(), "missing.json") } },
+		{ "invalid after flags", []string{ "-port", "0" } },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+
+			_, loadErr := loadConfig(fs, test.args)
+			if loadErr == nil { t.Error("expected an error") }
+		})
+	}
+}
@@ -3,15 +3,16 @@ package common
 
 const FTRANSFER_PROTO = "quic-file-transfer"
 const DEFAULT_HANDSHAKE_TIME = 3
-const MAX_FILENAME_LENGTH = 1024
-const CLIENT_PAYLOAD_MAX_LENGTH = MAX_FILENAME_LENGTH + 1
-const FILE_META_PAYLOAD_MAX_LENGTH = 24
-const CHUNK_META_PAYLOAD_MAX_LENGTH = 16
 const NET_PROTOCOL = "udp4"
+const MD5_SUFFIX = ".md5"
 
 const (
 	NO_ERROR = 0x0
 	INTERNAL_ERROR = 0x1
 	CONNECTION_ERROR = 0x2
 	TRANSPORT_ERROR = 0x3
-)
\ No newline at end of file
+	SHUTDOWN_ERROR = 0x4
+	ACCESS_DENIED_ERROR = 0x5
+	CANCELED_ERROR = 0x6
+	PROTOCOL_ERROR = 0x7
+)
@@ -0,0 +1,146 @@
+package attrs
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Attrs
+
+
+// ParseMask
+//	Parse a comma separated list of attribute names, as passed on the command line.
+func ParseMask(spec string) (protocol.AttrMask, error) {
+	var mask protocol.AttrMask
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+			case "", NONE:
+			case MODE:
+				mask |= protocol.ATTR_MODE
+			case TIMES:
+				mask |= protocol.ATTR_TIMES
+			case OWNER:
+				mask |= protocol.ATTR_OWNER
+			case XATTRS:
+				mask |= protocol.ATTR_XATTRS
+			case ALL:
+				mask |= protocol.ATTR_ALL
+			default:
+				return 0, ErrUnknownAttr
+		}
+	}
+
+	return mask, nil
+}
+
+// Read
+//	Read the requested attributes of a file. Reading is best effort: attributes that cannot be read are left out of the mask,
+//	and the errors they failed with are returned alongside everything that was read.
+//	Access times, ownership, and extended attributes are only read on linux.
+func Read(path string, mask protocol.AttrMask) (*protocol.FileAttrs, error) {
+	info, statErr := os.Stat(path)
+	if statErr != nil { return nil, statErr }
+
+	modTime := info.ModTime().UnixNano()
+	fileAttrs := &protocol.FileAttrs{ 
+		Mask: mask & (protocol.ATTR_MODE | protocol.ATTR_TIMES), 
+		Mode: uint32(info.Mode()), 
+		ModTime: modTime, 
+		AccessTime: modTime,
+	}
+
+	var readErrs []error
+	if mask & protocol.ATTR_TIMES != 0 { readAccessTime(info, fileAttrs) }
+
+	if mask & protocol.ATTR_OWNER != 0 {
+		ownerErr := readOwner(info, fileAttrs)
+		if ownerErr != nil { readErrs = append(readErrs, ownerErr) }
+	}
+
+	if mask & protocol.ATTR_XATTRS != 0 {
+		xattrs, xattrsErr := readXattrs(path)
+		if xattrsErr != nil { readErrs = append(readErrs, xattrsErr) }
+		if xattrsErr == nil {
+			fileAttrs.Xattrs = xattrs
+			fileAttrs.Mask |= protocol.ATTR_XATTRS
+		}
+	}
+
+	return fileAttrs, errors.Join(readErrs...)
+}
+
+// Apply
+//	Apply the attributes in mask, that are present in the attributes, to a file.
+//	Ownership is resolved by user and group name where they exist locally, otherwise the numeric ids are used.
+//	Ownership is applied before the mode, since changing it can clear setuid and setgid, and times are applied last.
+//	Every attribute is attempted, and the errors of any that failed are returned together.
+func Apply(path string, fileAttrs *protocol.FileAttrs, mask protocol.AttrMask) error {
+	mask &= fileAttrs.Mask
+	var applyErrs []error
+
+	if mask & protocol.ATTR_OWNER != 0 {
+		uid, gid := resolveOwner(fileAttrs)
+		chownErr := os.Chown(path, uid, gid)
+		if chownErr != nil { applyErrs = append(applyErrs, chownErr) }
+	}
+
+	if mask & protocol.ATTR_MODE != 0 {
+		chmodErr := os.Chmod(path, os.FileMode(fileAttrs.Mode) & MODE_BITS)
+		if chmodErr != nil { applyErrs = append(applyErrs, chmodErr) }
+	}
+
+	if mask & protocol.ATTR_XATTRS != 0 {
+		for _, xattr := range fileAttrs.Xattrs {
+			setErr := writeXattr(path, xattr)
+			if setErr != nil { applyErrs = append(applyErrs, setErr) }
+		}
+	}
+
+	if mask & protocol.ATTR_TIMES != 0 {
+		chtimesErr := os.Chtimes(path, time.Unix(0, fileAttrs.AccessTime), time.Unix(0, fileAttrs.ModTime))
+		if chtimesErr != nil { applyErrs = append(applyErrs, chtimesErr) }
+	}
+
+	return errors.Join(applyErrs...)
+}
+
+// lookupNames
+//	Look up the names of the owning user and group. An id without a name is left as just the id.
+func lookupNames(fileAttrs *protocol.FileAttrs) {
+	owner, lookupUserErr := user.LookupId(strconv.FormatUint(uint64(fileAttrs.Uid), 10))
+	if lookupUserErr == nil { fileAttrs.User = owner.Username }
+
+	group, lookupGroupErr := user.LookupGroupId(strconv.FormatUint(uint64(fileAttrs.Gid), 10))
+	if lookupGroupErr == nil { fileAttrs.Group = group.Name }
+}
+
+// resolveOwner
+//	Map the owner of a file to local ids, by name where the name exists locally and otherwise by the numeric id.
+func resolveOwner(fileAttrs *protocol.FileAttrs) (int, int) {
+	uid, gid := int(fileAttrs.Uid), int(fileAttrs.Gid)
+
+	if fileAttrs.User != "" {
+		owner, lookupUserErr := user.Lookup(fileAttrs.User)
+		if lookupUserErr == nil {
+			localUid, parseErr := strconv.Atoi(owner.Uid)
+			if parseErr == nil { uid = localUid }
+		}
+	}
+
+	if fileAttrs.Group != "" {
+		group, lookupGroupErr := user.LookupGroup(fileAttrs.Group)
+		if lookupGroupErr == nil {
+			localGid, parseErr := strconv.Atoi(group.Gid)
+			if parseErr == nil { gid = localGid }
+		}
+	}
+
+	return uid, gid
+}
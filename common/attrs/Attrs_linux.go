@@ -0,0 +1,70 @@
+//go:build linux
+
+package attrs
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+// readAccessTime
+//	Read the access time from the underlying stat.
+func readAccessTime(info os.FileInfo, fileAttrs *protocol.FileAttrs) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if ! ok { return }
+
+	fileAttrs.AccessTime = stat.Atim.Nano()
+}
+
+// readOwner
+//	Read the owning uid and gid from the underlying stat, along with their names.
+func readOwner(info os.FileInfo, fileAttrs *protocol.FileAttrs) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if ! ok { return errAttrUnsupported }
+
+	fileAttrs.Uid, fileAttrs.Gid = stat.Uid, stat.Gid
+	fileAttrs.Mask |= protocol.ATTR_OWNER
+	lookupNames(fileAttrs)
+	return nil
+}
+
+// readXattrs
+//	Read every extended attribute of a file. The list of names is requested with an empty buffer first to size it.
+func readXattrs(path string) ([]protocol.Xattr, error) {
+	listSize, sizeErr := unix.Listxattr(path, nil)
+	if sizeErr != nil { return nil, sizeErr }
+	if listSize == 0 { return nil, nil }
+
+	names := make([]byte, listSize)
+	listSize, listErr := unix.Listxattr(path, names)
+	if listErr != nil { return nil, listErr }
+
+	var xattrs []protocol.Xattr
+	for _, name := range bytes.Split(names[:listSize], []byte{ 0 }) {
+		if len(name) == 0 { continue }
+
+		valueSize, valueSizeErr := unix.Getxattr(path, string(name), nil)
+		if valueSizeErr != nil { return nil, valueSizeErr }
+		if valueSize > protocol.MAX_XATTR_VALUE_LENGTH { continue }
+
+		value := make([]byte, valueSize)
+		valueSize, getErr := unix.Getxattr(path, string(name), value)
+		if getErr != nil { return nil, getErr }
+
+		xattrs = append(xattrs, protocol.Xattr{ Name: string(name), Value: value[:valueSize] })
+	}
+
+	return xattrs, nil
+}
+
+// writeXattr
+//	Set a single extended attribute on a file, replacing any existing value.
+func writeXattr(path string, xattr protocol.Xattr) error {
+	return unix.Setxattr(path, xattr.Name, xattr.Value, 0)
+}
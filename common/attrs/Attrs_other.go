@@ -0,0 +1,32 @@
+//go:build !linux
+
+package attrs
+
+import (
+	"os"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+// readAccessTime
+//	Access times are only read on linux. Elsewhere the modification time is used.
+func readAccessTime(info os.FileInfo, fileAttrs *protocol.FileAttrs) {}
+
+// readOwner
+//	Ownership is only read on linux.
+func readOwner(info os.FileInfo, fileAttrs *protocol.FileAttrs) error {
+	return errAttrUnsupported
+}
+
+// readXattrs
+//	Extended attributes are only read on linux.
+func readXattrs(path string) ([]protocol.Xattr, error) {
+	return nil, errAttrUnsupported
+}
+
+// writeXattr
+//	Extended attributes are only written on linux.
+func writeXattr(path string, xattr protocol.Xattr) error {
+	return errAttrUnsupported
+}
@@ -0,0 +1,20 @@
+package attrs
+
+import (
+	"errors"
+	"os"
+)
+
+
+const MODE = "mode"
+const TIMES = "times"
+const OWNER = "owner"
+const XATTRS = "xattrs"
+const ALL = "all"
+const NONE = "none"
+
+const MODE_BITS = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+
+var ErrUnknownAttr = errors.New("unknown attribute, expected mode, times, owner, xattrs, all, or none")
+var errAttrUnsupported = errors.New("attribute not supported on this platform")
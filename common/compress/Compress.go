@@ -0,0 +1,133 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Compress
+
+
+// ParseCodec
+//	Parse a codec from its name: none, gzip, zstd, or auto.
+func ParseCodec(name string) (protocol.Codec, error) {
+	switch name {
+		case NONE:
+			return protocol.CODEC_NONE, nil
+		case GZIP:
+			return protocol.CODEC_GZIP, nil
+		case ZSTD:
+			return protocol.CODEC_ZSTD, nil
+		case AUTO:
+			return protocol.CODEC_AUTO, nil
+		default:
+			return protocol.CODEC_NONE, protocol.ErrUnknownCodec
+	}
+}
+
+// CodecName
+//	The name of a codec, as accepted by ParseCodec.
+func CodecName(codec protocol.Codec) string {
+	switch codec {
+		case protocol.CODEC_GZIP:
+			return GZIP
+		case protocol.CODEC_ZSTD:
+			return ZSTD
+		case protocol.CODEC_AUTO:
+			return AUTO
+		default:
+			return NONE
+	}
+}
+
+// NewEncoder
+//	Create an encoder for the codec.
+//	Encoders favor speed over ratio, since compression competes with the network for time on every chunk.
+//	The zstd window is kept small so decoders on the client hold little memory per stream.
+func NewEncoder(codec protocol.Codec) (Encoder, error) {
+	switch codec {
+		case protocol.CODEC_GZIP:
+			return gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		case protocol.CODEC_ZSTD:
+			return zstd.NewWriter(nil, 
+				zstd.WithEncoderLevel(zstd.SpeedFastest), 
+				zstd.WithEncoderConcurrency(1), 
+				zstd.WithWindowSize(ZSTD_WINDOW_SIZE),
+			)
+		default:
+			return nil, ErrUnsupportedCodec
+	}
+}
+
+// NewDecoder
+//	Create a decoder for the codec. Decoders are reused across chunks with Reset.
+func NewDecoder(codec protocol.Codec) (Decoder, error) {
+	switch codec {
+		case protocol.CODEC_GZIP:
+			return &gzipDecoder{}, nil
+		case protocol.CODEC_ZSTD:
+			return zstd.NewReader(nil, 
+				zstd.WithDecoderConcurrency(1), 
+				zstd.WithDecoderLowmem(true), 
+				zstd.WithDecoderMaxWindow(ZSTD_WINDOW_SIZE),
+			)
+		default:
+			return nil, ErrUnsupportedCodec
+	}
+}
+
+// Ratio
+//	Compress a sample of data, returning the compressed size as a fraction of the original.
+//	A ratio near 1 means the data is incompressible.
+func Ratio(codec protocol.Codec, sample []byte) (float64, error) {
+	if len(sample) == 0 { return 1, nil }
+
+	encoder, newEncoderErr := NewEncoder(codec)
+	if newEncoderErr != nil { return 0, newEncoderErr }
+
+	var encoded bytes.Buffer
+	encoder.Reset(&encoded)
+	
+	_, writeErr := encoder.Write(sample)
+	if writeErr != nil { return 0, writeErr }
+
+	closeErr := encoder.Close()
+	if closeErr != nil { return 0, closeErr }
+
+	return float64(encoded.Len()) / float64(len(sample)), nil
+}
+
+// Reset
+//	Start decoding a new gzip frame.
+func (d *gzipDecoder) Reset(r io.Reader) error {
+	if d.reader == nil {
+		reader, newReaderErr := gzip.NewReader(r)
+		if newReaderErr != nil { return newReaderErr }
+		
+		d.reader = reader
+	} else {
+		resetErr := d.reader.Reset(r)
+		if resetErr != nil { return resetErr }
+	}
+
+	d.reader.Multistream(false)
+	return nil
+}
+
+// Read
+//	Read decompressed bytes from the current frame.
+func (d *gzipDecoder) Read(p []byte) (int, error) {
+	return d.reader.Read(p)
+}
+
+// Close
+//	Release the decoder.
+func (d *gzipDecoder) Close() {
+	if d.reader != nil { d.reader.Close() }
+}
@@ -0,0 +1,37 @@
+package compress
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+
+// Encoder: compresses a single frame written to it. Reset starts a new frame, Close flushes the frame
+type Encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// Decoder: decompresses a single frame read from the reader it was last reset with
+type Decoder interface {
+	io.Reader
+	Reset(r io.Reader) error
+	Close()
+}
+
+// gzipDecoder: gzip.NewReader reads the header on creation, so the reader is only created once the first frame is available
+type gzipDecoder struct {
+	reader *gzip.Reader
+}
+
+
+const NONE = "none"
+const GZIP = "gzip"
+const ZSTD = "zstd"
+const AUTO = "auto"
+
+const ZSTD_WINDOW_SIZE = 1024 * 1024 * 2 // 2MiB
+
+
+var ErrUnsupportedCodec = errors.New("codec cannot be used for compression")
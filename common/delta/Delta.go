@@ -0,0 +1,190 @@
+package delta
+
+import (
+	"crypto/md5"
+	"io"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Delta
+
+
+// BlockSizeFor
+//	Choose the block size for signing a file.
+//	Blocks are at least MIN_BLOCK_SIZE, and grow with the file so the signatures never exceed MAX_BLOCKS, up to MAX_BLOCK_SIZE.
+func BlockSizeFor(size uint64) uint32 {
+	blockSize := uint64(MIN_BLOCK_SIZE)
+	if perBlock := (size + MAX_BLOCKS - 1) / MAX_BLOCKS; perBlock > blockSize { blockSize = perBlock }
+	
+	blockSize = (blockSize + BLOCK_ALIGNMENT - 1) / BLOCK_ALIGNMENT * BLOCK_ALIGNMENT
+	if blockSize > MAX_BLOCK_SIZE { blockSize = MAX_BLOCK_SIZE }
+
+	return uint32(blockSize)
+}
+
+// ValidateSignatures
+//	Check the block size and number of signatures sent by a client before scanning for them, since both decide how much memory the scan uses.
+func ValidateSignatures(blockSize uint32, blocks int) error {
+	if blockSize < MIN_BLOCK_SIZE || blockSize > MAX_BLOCK_SIZE || blockSize % BLOCK_ALIGNMENT != 0 { return ErrInvalidBlockSize }
+	if blocks > MAX_BLOCKS { return ErrTooManyBlocks }
+
+	return nil
+}
+
+// ComputeSignatures
+//	Sign every full block of the reader. A trailing partial block is not signed, so it is always transferred.
+//	At most MAX_BLOCKS blocks are signed, so the end of a file too large to cover with MAX_BLOCK_SIZE blocks is transferred in full.
+func ComputeSignatures(r io.Reader, blockSize uint32) ([]protocol.BlockSignature, error) {
+	var signatures []protocol.BlockSignature
+	block := make([]byte, blockSize)
+
+	for len(signatures) < MAX_BLOCKS {
+		_, readErr := io.ReadFull(r, block)
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF { return signatures, nil }
+		if readErr != nil { return nil, readErr }
+
+		signatures = append(signatures, protocol.BlockSignature{ Weak: newRollingChecksum(block).sum(), Strong: md5.Sum(block) })
+	}
+
+	return signatures, nil
+}
+
+// ComputeCopies
+//	Scan the file for blocks matching the client's signatures at any byte offset, as rsync does.
+//	At each offset, the weak checksum of the window is checked first, and the strong hash is only computed when the weak checksum matches a block.
+//	On a match, the scan jumps ahead a full block. Otherwise, the window rolls forward one byte.
+//	Adjacent matches of adjacent blocks are merged, so an unchanged file becomes a single copy.
+func ComputeCopies(r io.ReaderAt, size uint64, blockSize uint32, signatures []protocol.BlockSignature) ([]protocol.BlockCopy, error) {
+	bs := uint64(blockSize)
+	if bs == 0 || len(signatures) == 0 || size < bs { return nil, nil }
+
+	index := newSignatureIndex(signatures)
+	
+	bufferSize := SCAN_BUFFER_SIZE
+	if int(bs) * 4 > bufferSize { bufferSize = int(bs) * 4 }
+	w := &window{ r: r, buf: make([]byte, bufferSize) }
+
+	var copies []protocol.BlockCopy
+	var checksum *rollingChecksum
+
+	for pos := uint64(0); pos + bs <= size; {
+		want := bs
+		if pos + bs < size { want++ }
+
+		view, viewErr := w.view(pos, want)
+		if viewErr != nil { return nil, viewErr }
+		
+		block := view[:bs]
+		if checksum == nil { checksum = newRollingChecksum(block) }
+
+		if idx, ok := index.match(checksum.sum(), block, signatures); ok {
+			copies = appendCopy(copies, protocol.BlockCopy{ Offset: pos, BasisOffset: uint64(idx) * bs, Length: bs })
+			pos += bs
+			checksum = nil
+			continue
+		}
+
+		if want == bs { break }
+		checksum.roll(view[0], view[bs])
+		pos++
+	}
+
+	return copies, nil
+}
+
+// newRollingChecksum
+//	Compute the weak checksum of a block.
+func newRollingChecksum(block []byte) *rollingChecksum {
+	var a, b uint32
+	size := uint32(len(block))
+	for idx, c := range block {
+		a += uint32(c)
+		b += (size - uint32(idx)) * uint32(c)
+	}
+
+	return &rollingChecksum{ a: a & 0xffff, b: b & 0xffff, size: size }
+}
+
+// roll
+//	Slide the window forward one byte, removing out from the front and adding in at the back.
+func (rc *rollingChecksum) roll(out, in byte) {
+	rc.a = (rc.a - uint32(out) + uint32(in)) & 0xffff
+	rc.b = (rc.b - rc.size * uint32(out) + rc.a) & 0xffff
+}
+
+// sum
+//	The weak checksum of the current window.
+func (rc *rollingChecksum) sum() uint32 {
+	return rc.a | rc.b << 16
+}
+
+// newSignatureIndex
+//	Index the client's blocks by weak checksum.
+func newSignatureIndex(signatures []protocol.BlockSignature) *signatureIndex {
+	index := &signatureIndex{ blocks: make(map[uint32][]int), filter: make([]uint64, (1 << FILTER_BITS) / 64) }
+	for idx, sig := range signatures {
+		index.blocks[sig.Weak] = append(index.blocks[sig.Weak], idx)
+		
+		bit := filterBit(sig.Weak)
+		index.filter[bit / 64] |= 1 << (bit % 64)
+	}
+
+	return index
+}
+
+// match
+//	Find a block with the same weak checksum and strong hash as the window, preferring the lowest block index.
+func (index *signatureIndex) match(weak uint32, block []byte, signatures []protocol.BlockSignature) (int, bool) {
+	bit := filterBit(weak)
+	if index.filter[bit / 64] & (1 << (bit % 64)) == 0 { return 0, false }
+
+	candidates, ok := index.blocks[weak]
+	if ! ok { return 0, false }
+
+	strong := md5.Sum(block)
+	for _, idx := range candidates {
+		if signatures[idx].Strong == strong { return idx, true }
+	}
+
+	return 0, false
+}
+
+// filterBit
+//	Spread the weak checksum over the filter.
+func filterBit(weak uint32) uint32 {
+	return (weak * 2654435761) >> (32 - FILTER_BITS)
+}
+
+// appendCopy
+//	Add a copy, merging it into the previous one if both the new file and the client's copy are contiguous.
+func appendCopy(copies []protocol.BlockCopy, next protocol.BlockCopy) []protocol.BlockCopy {
+	if len(copies) > 0 {
+		last := &copies[len(copies) - 1]
+		if last.Offset + last.Length == next.Offset && last.BasisOffset + last.Length == next.BasisOffset {
+			last.Length += next.Length
+			return copies
+		}
+	}
+
+	return append(copies, next)
+}
+
+// view
+//	Return the bytes of the file from pos, at least length long, refilling the buffer from pos if they are not all buffered.
+func (w *window) view(pos uint64, length uint64) ([]byte, error) {
+	if pos < w.start || pos + length > w.start + uint64(w.length) {
+		nRead, readErr := w.r.ReadAt(w.buf, int64(pos))
+		if uint64(nRead) < length {
+			if readErr == nil || readErr == io.EOF { return nil, io.ErrUnexpectedEOF }
+			return nil, readErr
+		}
+
+		w.start = pos
+		w.length = nRead
+	}
+
+	offset := pos - w.start
+	return w.buf[offset:offset + length], nil
+}
@@ -0,0 +1,59 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+
+func TestValidateSignatures(t *testing.T) {
+	tests := []struct {
+		name string
+		blockSize uint32
+		blocks int
+		err error
+	}{
+		{ "min block size", MIN_BLOCK_SIZE, 1, nil },
+		{ "max block size", MAX_BLOCK_SIZE, MAX_BLOCKS, nil },
+		{ "no blocks", MIN_BLOCK_SIZE, 0, nil },
+		{ "zero block size", 0, 1, ErrInvalidBlockSize },
+		{ "below min block size", MIN_BLOCK_SIZE - BLOCK_ALIGNMENT, 1, ErrInvalidBlockSize },
+		{ "above max block size", MAX_BLOCK_SIZE + BLOCK_ALIGNMENT, 1, ErrInvalidBlockSize },
+		{ "huge block size", 1 << 31, 1, ErrInvalidBlockSize },
+		{ "unaligned block size", MIN_BLOCK_SIZE + 1, 1, ErrInvalidBlockSize },
+		{ "too many blocks", MIN_BLOCK_SIZE, MAX_BLOCKS + 1, ErrTooManyBlocks },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validateErr := ValidateSignatures(test.blockSize, test.blocks)
+			if ! errors.Is(validateErr, test.err) { t.Errorf("ValidateSignatures(%d, %d) = %v, want %v", test.blockSize, test.blocks, validateErr, test.err) }
+		})
+	}
+}
+
+func TestBlockSizeFor(t *testing.T) {
+	for _, size := range []uint64{ 0, 1, MIN_BLOCK_SIZE * MAX_BLOCKS, MIN_BLOCK_SIZE * MAX_BLOCKS + 1, 1 << 40, 1 << 43, 1 << 50 } {
+		blockSize := BlockSizeFor(size)
+		if validateErr := ValidateSignatures(blockSize, 0); validateErr != nil { t.Errorf("BlockSizeFor(%d) = %d, not accepted by the server: %v", size, blockSize, validateErr) }
+		if size <= uint64(MAX_BLOCK_SIZE) * MAX_BLOCKS && uint64(blockSize) * MAX_BLOCKS < size { t.Errorf("BlockSizeFor(%d) = %d, needs more than MAX_BLOCKS blocks", size, blockSize) }
+	}
+}
+
+func TestComputeCopies(t *testing.T) {
+	basis := make([]byte, MIN_BLOCK_SIZE * 4)
+	for idx := range basis { basis[idx] = byte(idx * 7 % 251) }
+
+	signatures, signErr := ComputeSignatures(bytes.NewReader(basis), MIN_BLOCK_SIZE)
+	if signErr != nil { t.Fatal(signErr) }
+	if len(signatures) != 4 { t.Fatalf("signed %d blocks, want 4", len(signatures)) }
+
+	shifted := append([]byte("inserted"), basis...)
+	copies, computeErr := ComputeCopies(bytes.NewReader(shifted), uint64(len(shifted)), MIN_BLOCK_SIZE, signatures)
+	if computeErr != nil { t.Fatal(computeErr) }
+
+	if len(copies) != 1 || copies[0].Offset != 8 || copies[0].BasisOffset != 0 || copies[0].Length != uint64(len(basis)) {
+		t.Errorf("ComputeCopies = %+v, want a single copy of the whole basis at offset 8", copies)
+	}
+}
@@ -0,0 +1,40 @@
+package delta
+
+import (
+	"errors"
+	"io"
+)
+
+
+// rollingChecksum: the rsync weak checksum over a window of bytes, updated in constant time as the window slides forward one byte
+type rollingChecksum struct {
+	a uint32
+	b uint32
+	size uint32
+}
+
+// signatureIndex: the client's block signatures indexed by weak checksum, with a bit filter to quickly rule out most offsets
+type signatureIndex struct {
+	blocks map[uint32][]int
+	filter []uint64
+}
+
+// window: a buffered view over a file that follows the scan position, so the file is read sequentially in large slices
+type window struct {
+	r io.ReaderAt
+	buf []byte
+	start uint64
+	length int
+}
+
+
+const MIN_BLOCK_SIZE = 1024 * 64 // 64KiB
+const MAX_BLOCK_SIZE = 1024 * 1024 * 32 // 32MiB, enough for MAX_BLOCKS to cover 8TiB
+const MAX_BLOCKS = 1024 * 256
+const BLOCK_ALIGNMENT = 1024 * 4 // 4KiB
+const SCAN_BUFFER_SIZE = 1024 * 1024 * 8 // 8MiB
+const FILTER_BITS = 24
+
+
+var ErrTooManyBlocks = errors.New("too many block signatures")
+var ErrInvalidBlockSize = errors.New("block size must be an aligned size between the min and max block size")
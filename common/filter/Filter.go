@@ -0,0 +1,296 @@
+package filter
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+//============================================= Filter
+
+
+// New
+//	Create a filter from a list of rules, applied from the root of the tree. Each rule is one of:
+//		pattern: a gitignore-style pattern, excluding matching files and directories. A trailing slash only matches directories,
+//			a slash anywhere else anchors the pattern to the root, * and ? match within a name, and ** matches any number of directories.
+//			A trailing ** matches everything inside a directory but not the directory itself
+//		size>N or size<N: excludes files larger or smaller than N bytes, with an optional K, M, G, or T suffix
+//		age>D or age<D: excludes files last modified longer or shorter than D ago, as a go duration or a number of days (d) or weeks (w)
+//	Any rule prefixed with ! re-includes what it matches instead. Blank lines and lines starting with # are ignored.
+//	Excluding a directory excludes everything below it, which cannot be re-included.
+func New(rules []string) (*Filter, error) {
+	parsed, parseErr := parseRules(rules, "")
+	if parseErr != nil { return nil, parseErr }
+
+	return &Filter{ rules: parsed, now: time.Now() }, nil
+}
+
+// WithIgnoreFile
+//	Return a filter for a directory that additionally applies the rules read from an ignore file in it.
+//	dir is the slash separated path of the directory relative to the root of the tree. The original filter is unchanged.
+func (f *Filter) WithIgnoreFile(dir string, r io.Reader) (*Filter, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() { lines = append(lines, scanner.Text()) }
+	if scanErr := scanner.Err(); scanErr != nil { return nil, scanErr }
+
+	base := ""
+	if dir != "." { base = dir }
+
+	parsed, parseErr := parseRules(lines, base)
+	if parseErr != nil { return nil, parseErr }
+	if len(parsed) == 0 { return f, nil }
+
+	fileRules := make([]rule, 0, len(f.fileRules) + len(parsed))
+	fileRules = append(fileRules, f.fileRules...)
+	fileRules = append(fileRules, parsed...)
+
+	return &Filter{ fileRules: fileRules, rules: f.rules, now: f.now }, nil
+}
+
+// Excluded
+//	Check whether a path, slash separated and relative to the root of the tree, is excluded.
+func (f *Filter) Excluded(relPath string, info fs.FileInfo) bool {
+	excluded := false
+	for _, rules := range [][]rule{ f.fileRules, f.rules } {
+		for idx := range rules {
+			if rules[idx].matches(relPath, info, f.now) { excluded = ! rules[idx].negate }
+		}
+	}
+
+	return excluded
+}
+
+// Walk
+//	Walk a tree in lexical order, calling fn for every file and directory that is not excluded, but not the root itself.
+//	Ignore files are loaded from each directory as it is reached and apply to everything below it. Excluded directories are not descended into.
+//	fn is passed the slash separated path relative to root. Returning fs.SkipDir from fn skips a directory.
+func Walk(root string, f *Filter, fn func(relPath string, info fs.FileInfo) error) error {
+	filters := make(map[string]*Filter)
+
+	return filepath.WalkDir(root, func(entryPath string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil { return walkErr }
+
+		relPath, relErr := filepath.Rel(root, entryPath)
+		if relErr != nil { return relErr }
+		relPath = filepath.ToSlash(relPath)
+
+		if relPath == "." {
+			rootFilter, loadErr := loadIgnoreFile(entryPath, relPath, f)
+			if loadErr != nil { return loadErr }
+
+			filters[relPath] = rootFilter
+			return nil
+		}
+
+		info, infoErr := entry.Info()
+		if infoErr != nil { return infoErr }
+
+		parentFilter := filters[path.Dir(relPath)]
+		if parentFilter.Excluded(relPath, info) {
+			if entry.IsDir() { return fs.SkipDir }
+			return nil
+		}
+
+		if entry.IsDir() {
+			dirFilter, loadErr := loadIgnoreFile(entryPath, relPath, parentFilter)
+			if loadErr != nil { return loadErr }
+
+			filters[relPath] = dirFilter
+		}
+
+		return fn(relPath, info)
+	})
+}
+
+// loadIgnoreFile
+//	Extend a filter with the ignore file in a directory, if there is one.
+func loadIgnoreFile(dirPath, relPath string, f *Filter) (*Filter, error) {
+	ignoreFile, openErr := os.Open(filepath.Join(dirPath, IGNORE_FILE))
+	if os.IsNotExist(openErr) { return f, nil }
+	if openErr != nil { return nil, openErr }
+	defer ignoreFile.Close()
+
+	return f.WithIgnoreFile(relPath, ignoreFile)
+}
+
+// parseRules
+//	Parse a list of rules that apply within base.
+func parseRules(lines []string, base string) ([]rule, error) {
+	var rules []rule
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") { continue }
+
+		parsed, parseErr := parseRule(line, base)
+		if parseErr != nil { return nil, parseErr }
+
+		rules = append(rules, *parsed)
+	}
+
+	return rules, nil
+}
+
+// parseRule
+//	Parse a single rule. A leading backslash escapes a pattern that begins with # or !.
+func parseRule(line, base string) (*rule, error) {
+	r := &rule{ base: base }
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasPrefix(line, "\\") { line = line[1:] }
+
+	pred, isPredicate, predicateErr := parsePredicate(line)
+	if predicateErr != nil { return nil, predicateErr }
+	if isPredicate {
+		r.predicate = pred
+		return r, nil
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+
+	if line == "" { return nil, ErrInvalidRule }
+
+	r.segments = strings.Split(line, "/")
+	for _, segment := range r.segments {
+		if segment == DOUBLE_STAR { continue }
+		if _, matchErr := path.Match(segment, ""); matchErr != nil { return nil, ErrInvalidRule }
+	}
+
+	return r, nil
+}
+
+// parsePredicate
+//	Parse a size or age predicate, reporting whether the rule was one.
+func parsePredicate(line string) (*predicate, bool, error) {
+	var kind predicateKind
+	var rest string
+
+	switch {
+		case strings.HasPrefix(line, SIZE_PREFIX + ">") || strings.HasPrefix(line, SIZE_PREFIX + "<"):
+			kind, rest = SIZE_PREDICATE, line[len(SIZE_PREFIX):]
+		case strings.HasPrefix(line, AGE_PREFIX + ">") || strings.HasPrefix(line, AGE_PREFIX + "<"):
+			kind, rest = AGE_PREDICATE, line[len(AGE_PREFIX):]
+		default:
+			return nil, false, nil
+	}
+
+	pred := &predicate{ kind: kind, greater: rest[0] == '>' }
+	value := strings.TrimSpace(rest[1:])
+
+	var parseErr error
+	if kind == SIZE_PREDICATE { pred.size, parseErr = parseSize(value) }
+	if kind == AGE_PREDICATE { pred.age, parseErr = parseAge(value) }
+
+	if parseErr != nil { return nil, true, ErrInvalidRule }
+	return pred, true, nil
+}
+
+// parseSize
+//	Parse a size in bytes, with an optional K, M, G, or T suffix in powers of 1024. A trailing B is allowed.
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(value), "B")
+
+	multiplier := int64(1)
+	if value != "" {
+		if shift := strings.Index("KMGT", value[len(value) - 1:]); shift >= 0 {
+			multiplier = int64(1) << (10 * (shift + 1))
+			value = value[:len(value) - 1]
+		}
+	}
+
+	size, parseErr := strconv.ParseFloat(value, 64)
+	if parseErr != nil { return 0, parseErr }
+	if size < 0 { return 0, ErrInvalidRule }
+
+	return int64(size * float64(multiplier)), nil
+}
+
+// parseAge
+//	Parse an age as a go duration, or as a whole number of days or weeks.
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{ "d": DAY, "w": WEEK } {
+		if ! strings.HasSuffix(value, suffix) { continue }
+
+		count, parseErr := strconv.Atoi(strings.TrimSuffix(value, suffix))
+		if parseErr != nil { return 0, parseErr }
+		return time.Duration(count) * unit, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// matches
+//	Check whether the rule matches a path, ignoring whether it is negated.
+func (r *rule) matches(relPath string, info fs.FileInfo, now time.Time) bool {
+	if r.base != "" {
+		if ! strings.HasPrefix(relPath, r.base + "/") { return false }
+		relPath = relPath[len(r.base) + 1:]
+	}
+
+	if r.predicate != nil { return r.predicate.matches(info, now) }
+	if r.dirOnly && ! info.IsDir() { return false }
+	if r.anchored { return matchSegments(r.segments, strings.Split(relPath, "/")) }
+
+	matched, _ := path.Match(r.segments[0], path.Base(relPath))
+	return matched
+}
+
+// matches
+//	Check whether a file satisfies the predicate.
+func (pred *predicate) matches(info fs.FileInfo, now time.Time) bool {
+	if info.IsDir() { return false }
+
+	switch pred.kind {
+		case SIZE_PREDICATE:
+			if pred.greater { return info.Size() > pred.size }
+			return info.Size() < pred.size
+		default:
+			age := now.Sub(info.ModTime())
+			if pred.greater { return age > pred.age }
+			return age < pred.age
+	}
+}
+
+// matchSegments
+//	Match the segments of a path against the segments of a pattern, where ** matches zero or more segments.
+//	As in gitignore, a trailing ** matches at least one segment, so foo/** matches everything inside foo but not foo itself, and what is inside can still be re-included.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == DOUBLE_STAR {
+			if len(pattern) == 1 { return len(segments) > 0 }
+
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(pattern[1:], segments[skip:]) { return true }
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 { return false }
+
+		matched, _ := path.Match(pattern[0], segments[0])
+		if ! matched { return false }
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
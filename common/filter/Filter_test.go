@@ -0,0 +1,216 @@
+package filter
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+
+// fakeInfo: the file info of a path that does not exist on disk
+type fakeInfo struct {
+	name string
+	dir bool
+	size int64
+	modTime time.Time
+}
+
+func (info fakeInfo) Name() string { return info.name }
+func (info fakeInfo) Size() int64 { return info.size }
+func (info fakeInfo) ModTime() time.Time { return info.modTime }
+func (info fakeInfo) IsDir() bool { return info.dir }
+func (info fakeInfo) Sys() interface{} { return nil }
+func (info fakeInfo) Mode() fs.FileMode {
+	if info.dir { return fs.ModeDir | 0755 }
+	return 0644
+}
+
+func file(size int64, age time.Duration) fakeInfo { return fakeInfo{ size: size, modTime: time.Now().Add(-age) } }
+func dir() fakeInfo { return fakeInfo{ dir: true, modTime: time.Now() } }
+
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		name string
+		rules []string
+		path string
+		info fakeInfo
+		excluded bool
+	}{
+		{ "unanchored matches name at any depth", []string{ "*.log" }, "a/b/x.log", file(1, 0), true },
+		{ "unanchored does not match other names", []string{ "*.log" }, "a/x.txt", file(1, 0), false },
+		{ "leading slash anchors to root", []string{ "/build" }, "build", dir(), true },
+		{ "anchored does not match below root", []string{ "/build" }, "src/build", dir(), false },
+		{ "inner slash anchors", []string{ "docs/*.md" }, "docs/a.md", file(1, 0), true },
+		{ "inner slash anchored at root only", []string{ "docs/*.md" }, "x/docs/a.md", file(1, 0), false },
+		{ "star does not cross directories", []string{ "docs/*.md" }, "docs/sub/a.md", file(1, 0), false },
+		{ "question mark matches one character", []string{ "file?.txt" }, "file1.txt", file(1, 0), true },
+		{ "dir only matches directories", []string{ "tmp/" }, "a/tmp", dir(), true },
+		{ "dir only skips files", []string{ "tmp/" }, "a/tmp", file(1, 0), false },
+		{ "leading double star at root", []string{ "**/cache" }, "cache", dir(), true },
+		{ "leading double star at depth", []string{ "**/cache" }, "a/b/cache", dir(), true },
+		{ "inner double star matches zero segments", []string{ "a/**/b" }, "a/b", file(1, 0), true },
+		{ "inner double star matches many segments", []string{ "a/**/b" }, "a/x/y/b", file(1, 0), true },
+		{ "inner double star needs the tail", []string{ "a/**/b" }, "a/x", file(1, 0), false },
+		{ "trailing double star skips the directory itself", []string{ "foo/**" }, "foo", dir(), false },
+		{ "trailing double star matches children", []string{ "foo/**" }, "foo/x", file(1, 0), true },
+		{ "trailing double star matches descendants", []string{ "foo/**" }, "foo/x/y", file(1, 0), true },
+		{ "negation after exclude re-includes", []string{ "*.log", "!keep.log" }, "keep.log", file(1, 0), false },
+		{ "exclude after negation wins", []string{ "!keep.log", "*.log" }, "keep.log", file(1, 0), true },
+		{ "negation of trailing double star", []string{ "foo/**", "!foo/keep" }, "foo/keep", file(1, 0), false },
+		{ "escaped hash", []string{ "\\#notes" }, "#notes", file(1, 0), true },
+		{ "escaped bang", []string{ "\\!important" }, "!important", file(1, 0), true },
+		{ "comments and blank lines ignored", []string{ "# *.txt", "", "  " }, "a.txt", file(1, 0), false },
+		{ "size greater", []string{ "size>1M" }, "big", file(2 << 20, 0), true },
+		{ "size greater is strict", []string{ "size>1M" }, "exact", file(1 << 20, 0), false },
+		{ "size less", []string{ "size<1K" }, "small", file(100, 0), true },
+		{ "size skips directories", []string{ "size<1K" }, "d", dir(), false },
+		{ "negated size", []string{ "*", "!size<1K" }, "small", file(100, 0), false },
+		{ "age greater in days", []string{ "age>7d" }, "old", file(1, 8 * DAY), true },
+		{ "age greater in weeks", []string{ "age>2w" }, "recent", file(1, WEEK), false },
+		{ "age less as duration", []string{ "age<1h" }, "new", file(1, 30 * time.Minute), true },
+		{ "age skips directories", []string{ "age<1h" }, "d", dir(), false },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, newErr := New(test.rules)
+			if newErr != nil { t.Fatalf("New(%q): %v", test.rules, newErr) }
+
+			excluded := f.Excluded(test.path, test.info)
+			if excluded != test.excluded { t.Errorf("Excluded(%q) with %q = %v, want %v", test.path, test.rules, excluded, test.excluded) }
+		})
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, line := range []string{ "/", "!", "[", "a/[b", "size>", "size>abc", "size>-1", "age>", "age>xyz", "age<3x" } {
+		t.Run(line, func(t *testing.T) {
+			_, newErr := New([]string{ line })
+			if ! errors.Is(newErr, ErrInvalidRule) { t.Errorf("New(%q) = %v, want ErrInvalidRule", line, newErr) }
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		size int64
+	}{
+		{ "10", 10 },
+		{ "1K", 1 << 10 },
+		{ "1.5M", 3 << 19 },
+		{ "2GB", 2 << 30 },
+		{ "1T", 1 << 40 },
+		{ "4kb", 4 << 10 },
+	}
+
+	for _, test := range tests {
+		size, parseErr := parseSize(test.value)
+		if parseErr != nil || size != test.size { t.Errorf("parseSize(%q) = %d, %v, want %d", test.value, size, parseErr, test.size) }
+	}
+
+	for _, value := range []string{ "", "B", "K", "abc", "-1" } {
+		_, parseErr := parseSize(value)
+		if parseErr == nil { t.Errorf("parseSize(%q) succeeded, want an error", value) }
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value string
+		age time.Duration
+	}{
+		{ "3d", 3 * DAY },
+		{ "2w", 2 * WEEK },
+		{ "90m", 90 * time.Minute },
+		{ "1h30m", 90 * time.Minute },
+	}
+
+	for _, test := range tests {
+		age, parseErr := parseAge(test.value)
+		if parseErr != nil || age != test.age { t.Errorf("parseAge(%q) = %v, %v, want %v", test.value, age, parseErr, test.age) }
+	}
+
+	for _, value := range []string{ "", "d", "1.5d", "soon" } {
+		_, parseErr := parseAge(value)
+		if parseErr == nil { t.Errorf("parseAge(%q) succeeded, want an error", value) }
+	}
+}
+
+func TestWithIgnoreFile(t *testing.T) {
+	tests := []struct {
+		name string
+		rules []string
+		files map[string]string
+		path string
+		excluded bool
+	}{
+		{ "applies below its directory", nil, map[string]string{ "sub": "*.tmp" }, "sub/a.tmp", true },
+		{ "does not apply above its directory", nil, map[string]string{ "sub": "*.tmp" }, "a.tmp", false },
+		{ "applies at depth below its directory", nil, map[string]string{ "sub": "*.tmp" }, "sub/x/a.tmp", true },
+		{ "anchors to its directory", nil, map[string]string{ "sub": "/only" }, "sub/only", true },
+		{ "anchored does not match deeper", nil, map[string]string{ "sub": "/only" }, "sub/x/only", false },
+		{ "anchored does not match at root", nil, map[string]string{ "sub": "/only" }, "only", false },
+		{ "root file applies everywhere", nil, map[string]string{ ".": "*.tmp" }, "a/b/c.tmp", true },
+		{ "filter rules override ignore files", []string{ "!sub/keep.tmp" }, map[string]string{ "sub": "*.tmp" }, "sub/keep.tmp", false },
+		{ "deeper files override shallower", nil, map[string]string{ ".": "*.tmp", "sub": "!keep.tmp" }, "sub/keep.tmp", false },
+		{ "deeper files leave other paths alone", nil, map[string]string{ ".": "*.tmp", "sub": "!keep.tmp" }, "sub/other.tmp", true },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, newErr := New(test.rules)
+			if newErr != nil { t.Fatalf("New(%q): %v", test.rules, newErr) }
+
+			for _, dir := range []string{ ".", "sub" } {
+				content, ok := test.files[dir]
+				if ! ok { continue }
+
+				var loadErr error
+				f, loadErr = f.WithIgnoreFile(dir, strings.NewReader(content))
+				if loadErr != nil { t.Fatalf("WithIgnoreFile(%q): %v", dir, loadErr) }
+			}
+
+			excluded := f.Excluded(test.path, file(1, 0))
+			if excluded != test.excluded { t.Errorf("Excluded(%q) = %v, want %v", test.path, excluded, test.excluded) }
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.log": "",
+		"build/out": "",
+		"foo/drop": "",
+		"foo/keep": "",
+		"sub/.quicignore": "*.tmp\n",
+		"sub/a.tmp": "",
+		"sub/b.txt": "",
+		"c.tmp": "",
+	} {
+		fullPath := filepath.Join(root, filepath.FromSlash(name))
+		if mkdirErr := os.MkdirAll(filepath.Dir(fullPath), 0755); mkdirErr != nil { t.Fatal(mkdirErr) }
+		if writeErr := os.WriteFile(fullPath, []byte(content), 0644); writeErr != nil { t.Fatal(writeErr) }
+	}
+
+	f, newErr := New([]string{ "*.log", "build/", "foo/**", "!foo/keep" })
+	if newErr != nil { t.Fatal(newErr) }
+
+	var walked []string
+	walkErr := Walk(root, f, func(relPath string, info fs.FileInfo) error {
+		walked = append(walked, relPath)
+		return nil
+	})
+
+	if walkErr != nil { t.Fatal(walkErr) }
+
+	expected := []string{ "c.tmp", "foo", "foo/keep", "sub", "sub/.quicignore", "sub/b.txt" }
+	if ! reflect.DeepEqual(walked, expected) { t.Errorf("Walk = %q, want %q", walked, expected) }
+}
@@ -0,0 +1,57 @@
+package filter
+
+import (
+	"errors"
+	"time"
+)
+
+
+// Filter: an ordered set of exclude and include rules for the paths in a directory tree.
+//	The last rule to match a path decides whether it is excluded. Rules from ignore files are checked before the rules the filter was created with,
+//	so the filter's own rules take precedence, and rules from deeper ignore files take precedence over those above them.
+type Filter struct {
+	fileRules []rule
+	rules []rule
+	now time.Time
+}
+
+// rule: a single parsed rule, either a gitignore-style pattern or a size or age predicate
+type rule struct {
+	// negate: the rule re-includes matching paths instead of excluding them
+	negate bool
+	// dirOnly: the pattern ends in a slash and only matches directories
+	dirOnly bool
+	// anchored: the pattern contains a slash and is matched against the whole path relative to base, rather than just the name
+	anchored bool
+	// base: the slash separated directory the rule applies within, relative to the root of the tree
+	base string
+	segments []string
+	predicate *predicate
+}
+
+// predicate: a condition on the size or age of a file. Directories never match
+type predicate struct {
+	kind predicateKind
+	greater bool
+	size int64
+	age time.Duration
+}
+
+// predicateKind: the property of a file a predicate checks
+type predicateKind uint8
+
+const (
+	SIZE_PREDICATE predicateKind = iota
+	AGE_PREDICATE
+)
+
+
+const IGNORE_FILE = ".quicignore"
+const SIZE_PREFIX = "size"
+const AGE_PREFIX = "age"
+const DOUBLE_STAR = "**"
+const DAY = 24 * time.Hour
+const WEEK = 7 * DAY
+
+
+var ErrInvalidRule = errors.New("invalid filter rule")
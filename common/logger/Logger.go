@@ -0,0 +1,173 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+
+//============================================= Logger
+
+
+// Logger
+//	The logging interface used by both the client and the server.
+//	Messages carry a level and a set of structured fields (conn id, remote addr, path, stream index, etc.).
+//	Library users can provide their own implementation to route logs into their existing logging stack.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	// With: returns a child logger that attaches the provided fields to every message
+	With(fields ...Field) Logger
+}
+
+// Field: a single structured key/value pair attached to a log message
+type Field struct {
+	Key string
+	Value interface{}
+}
+
+// Level: the minimum severity a logger will emit
+type Level int
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+	SILENT
+)
+
+// common field keys, used so both the client and server emit consistent structured logs
+const (
+	CONN_ID_KEY = "conn"
+	REMOTE_ADDR_KEY = "remote"
+	PATH_KEY = "path"
+	STREAM_KEY = "stream"
+	TRANSFER_ID_KEY = "transfer"
+	ERROR_KEY = "err"
+)
+
+
+// F
+//	Shorthand for creating a structured field.
+func F(key string, value interface{}) Field {
+	return Field{ Key: key, Value: value }
+}
+
+// Err
+//	Shorthand for attaching an error to a log message.
+func Err(err error) Field {
+	return Field{ Key: ERROR_KEY, Value: err }
+}
+
+// ParseLevel
+//	Transform a level name (debug, info, warn, error, silent) into a Level.
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToLower(level) {
+		case "debug":
+			return DEBUG, nil
+		case "info":
+			return INFO, nil
+		case "warn", "warning":
+			return WARN, nil
+		case "error":
+			return ERROR, nil
+		case "silent", "none", "off":
+			return SILENT, nil
+		default:
+			return SILENT, errors.New("unknown log level: " + level)
+	}
+}
+
+func (level Level) String() string {
+	switch level {
+		case DEBUG:
+			return "debug"
+		case INFO:
+			return "info"
+		case WARN:
+			return "warn"
+		case ERROR:
+			return "error"
+		default:
+			return "silent"
+	}
+}
+
+
+//============================================= Nop Logger
+
+
+type nopLogger struct {}
+
+// NewNopLogger
+//	A logger that discards everything.
+//	This is the default for both the client and server when used as a library.
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (l nopLogger) Debug(msg string, fields ...Field) {}
+func (l nopLogger) Info(msg string, fields ...Field) {}
+func (l nopLogger) Warn(msg string, fields ...Field) {}
+func (l nopLogger) Error(msg string, fields ...Field) {}
+func (l nopLogger) With(fields ...Field) Logger { return l }
+
+
+//============================================= Std Logger
+
+
+type stdLogger struct {
+	out *log.Logger
+	level Level
+	fields []Field
+}
+
+// NewStdLogger
+//	A leveled logger built on the standard library log package.
+//	Messages are written as logfmt style key=value pairs, for example:
+//		2024/01/01 00:00:00 level=info msg="transfer complete" conn=1 path=/data/file
+func NewStdLogger(out io.Writer, level Level) Logger {
+	return &stdLogger{ out: log.New(out, "", log.LstdFlags), level: level }
+}
+
+func (l *stdLogger) Debug(msg string, fields ...Field) { l.write(DEBUG, msg, fields) }
+func (l *stdLogger) Info(msg string, fields ...Field) { l.write(INFO, msg, fields) }
+func (l *stdLogger) Warn(msg string, fields ...Field) { l.write(WARN, msg, fields) }
+func (l *stdLogger) Error(msg string, fields ...Field) { l.write(ERROR, msg, fields) }
+
+func (l *stdLogger) With(fields ...Field) Logger {
+	merged := make([]Field, 0, len(l.fields) + len(fields))
+	merged = append(merged, l.fields...)
+	merged = append(merged, fields...)
+
+	return &stdLogger{ out: l.out, level: l.level, fields: merged }
+}
+
+// write
+//	Format the message and fields and write them to the underlying logger if the level is enabled.
+func (l *stdLogger) write(level Level, msg string, fields []Field) {
+	if level < l.level || l.level == SILENT { return }
+
+	var line strings.Builder
+	line.WriteString("level=" + level.String())
+	line.WriteString(" msg=" + formatValue(msg))
+
+	for _, field := range l.fields { line.WriteString(" " + field.Key + "=" + formatValue(field.Value)) }
+	for _, field := range fields { line.WriteString(" " + field.Key + "=" + formatValue(field.Value)) }
+
+	l.out.Println(line.String())
+}
+
+// formatValue
+//	Quote values containing whitespace or quotes so lines remain parseable.
+func formatValue(value interface{}) string {
+	str := fmt.Sprint(value)
+	if str == "" || strings.ContainsAny(str, " \t\n\"=") { return fmt.Sprintf("%q", str) }
+	return str
+}
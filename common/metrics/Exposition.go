@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+
+//============================================= Exposition
+
+
+// Handler
+//	Serve the registry in the prometheus text exposition format, for scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		r.WriteText(w)
+	})
+}
+
+// WriteText
+//	Write every family in the prometheus text exposition format, in the order they were registered.
+//	Within a family, metrics are sorted by their label values so the output is stable between scrapes.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, f := range families { f.write(buf) }
+
+	return buf.Flush()
+}
+
+// write
+//	Write the help and type lines for the family, followed by every metric in it.
+func (f *family) write(buf *bufio.Writer) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series { keys = append(keys, key) }
+	sort.Strings(keys)
+
+	all := make([]*series, len(keys))
+	for idx, key := range keys { all[idx] = f.series[key] }
+	f.mu.Unlock()
+
+	buf.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	buf.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+
+	for _, s := range all {
+		switch metric := s.metric.(type) {
+			case *Counter:
+				writeSample(buf, f.name, f.labels, s.values, "", strconv.FormatUint(metric.Value(), 10))
+			case *Gauge:
+				writeSample(buf, f.name, f.labels, s.values, "", strconv.FormatInt(metric.Value(), 10))
+			case *Histogram:
+				metric.write(buf, f.name, f.labels, s.values)
+		}
+	}
+}
+
+// write
+//	Write the cumulative buckets of the histogram, ending with +Inf, then its sum and count.
+func (h *Histogram) write(buf *bufio.Writer, name string, labels, values []string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum := h.sum
+	count := h.count
+	h.mu.Unlock()
+
+	bucketLabels := append(append([]string(nil), labels...), "le")
+	cumulative := uint64(0)
+	for idx, bound := range h.bounds {
+		cumulative += counts[idx]
+		writeSample(buf, name + "_bucket", bucketLabels, append(append([]string(nil), values...), formatFloat(bound)), "", strconv.FormatUint(cumulative, 10))
+	}
+
+	writeSample(buf, name + "_bucket", bucketLabels, append(append([]string(nil), values...), "+Inf"), "", strconv.FormatUint(count, 10))
+	writeSample(buf, name, labels, values, "_sum", formatFloat(sum))
+	writeSample(buf, name, labels, values, "_count", strconv.FormatUint(count, 10))
+}
+
+// writeSample
+//	Write a single line, like name_suffix{label="value"} 1.
+func writeSample(buf *bufio.Writer, name string, labels, values []string, suffix, value string) {
+	buf.WriteString(name + suffix)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for idx, label := range labels {
+			if idx > 0 { buf.WriteByte(',') }
+			buf.WriteString(label + "=\"" + escapeLabelValue(values[idx]) + "\"")
+		}
+
+		buf.WriteByte('}')
+	}
+
+	buf.WriteString(" " + value + "\n")
+}
+
+// formatFloat
+//	Format a value the way prometheus expects, including +Inf and -Inf.
+func formatFloat(value float64) string {
+	switch {
+		case math.IsInf(value, 1):
+			return "+Inf"
+		case math.IsInf(value, -1):
+			return "-Inf"
+		default:
+			return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// escapeHelp
+//	Escape backslashes and newlines in help text.
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// escapeLabelValue
+//	Escape backslashes, newlines and double quotes in a label value.
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+var labelValueEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
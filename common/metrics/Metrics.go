@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+
+//============================================= Registry
+
+
+// NewRegistry
+//	Create an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{ names: make(map[string]bool) }
+}
+
+// NewCounter
+//	Register a counter family with the given label names.
+//	Registering the same name twice is a programming error and panics, like a duplicate flag.
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{ family: r.register(name, help, COUNTER, nil, labels) }
+}
+
+// NewGauge
+//	Register a gauge family with the given label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{ family: r.register(name, help, GAUGE, nil, labels) }
+}
+
+// NewHistogram
+//	Register a histogram family with the given bucket upper bounds, in increasing order, and label names.
+//	Observations above the last bound are only counted in the implicit +Inf bucket.
+func (r *Registry) NewHistogram(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{ family: r.register(name, help, HISTOGRAM, bounds, labels) }
+}
+
+// ExponentialBuckets
+//	count bucket bounds, starting at start and growing by factor.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for idx := range bounds {
+		bounds[idx] = start
+		start *= factor
+	}
+
+	return bounds
+}
+
+// register
+//	Add a family to the registry. Families without labels have their single metric created up front, so they are written even before they are used.
+func (r *Registry) register(name, help, kind string, bounds []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] { panic(ErrDuplicateMetric.Error() + ": " + name) }
+	r.names[name] = true
+
+	f := &family{ name: name, help: help, kind: kind, labels: labels, bounds: bounds, series: make(map[string]*series) }
+	if len(labels) == 0 { f.with(nil) }
+
+	r.families = append(r.families, f)
+	return f
+}
+
+
+//============================================= Metrics
+
+
+// With
+//	The counter for the label values, in the order of the family's label names. It is created on first use.
+func (vec *CounterVec) With(values ...string) *Counter {
+	return vec.family.with(values).(*Counter)
+}
+
+// With
+//	The gauge for the label values, in the order of the family's label names. It is created on first use.
+func (vec *GaugeVec) With(values ...string) *Gauge {
+	return vec.family.with(values).(*Gauge)
+}
+
+// With
+//	The histogram for the label values, in the order of the family's label names. It is created on first use.
+func (vec *HistogramVec) With(values ...string) *Histogram {
+	return vec.family.with(values).(*Histogram)
+}
+
+// Inc
+//	Add one to the counter.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add
+//	Add n to the counter.
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Value
+//	The current value of the counter.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Inc
+//	Add one to the gauge.
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+// Dec
+//	Subtract one from the gauge.
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+// Set
+//	Replace the value of the gauge.
+func (g *Gauge) Set(value int64) {
+	g.value.Store(value)
+}
+
+// Value
+//	The current value of the gauge.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// Observe
+//	Count a value into the first bucket whose upper bound it does not exceed.
+func (h *Histogram) Observe(value float64) {
+	if math.IsNaN(value) { return }
+
+	idx := sort.SearchFloat64s(h.bounds, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if idx < len(h.counts) { h.counts[idx]++ }
+	h.sum += value
+	h.count++
+}
+
+// with
+//	Look up the metric for the label values, creating it if this is the first time they are seen.
+//	Passing the wrong number of values is a programming error and panics.
+func (f *family) with(values []string) interface{} {
+	if len(values) != len(f.labels) { panic(ErrLabelCount.Error() + ": " + f.name) }
+
+	key := strings.Join(values, LABEL_SEPARATOR)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if ok { return s.metric }
+
+	s = &series{ values: append([]string(nil), values...) }
+	switch f.kind {
+		case COUNTER:
+			s.metric = &Counter{}
+		case GAUGE:
+			s.metric = &Gauge{}
+		case HISTOGRAM:
+			s.metric = &Histogram{ bounds: f.bounds, counts: make([]uint64, len(f.bounds)) }
+	}
+
+	f.series[key] = s
+	return s.metric
+}
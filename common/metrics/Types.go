@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+
+// Registry: a set of metric families, written out in the prometheus text exposition format
+type Registry struct {
+	mu sync.Mutex
+	families []*family
+	names map[string]bool
+}
+
+// CounterVec: a counter family, with one counter for every combination of label values
+type CounterVec struct {
+	family *family
+}
+
+// GaugeVec: a gauge family, with one gauge for every combination of label values
+type GaugeVec struct {
+	family *family
+}
+
+// HistogramVec: a histogram family, with one histogram for every combination of label values
+type HistogramVec struct {
+	family *family
+}
+
+// Counter: a value that only goes up, like the number of bytes sent
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Gauge: a value that goes up and down, like the number of open connections
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Histogram: counts observations into cumulative buckets by their upper bound, along with their sum and count
+type Histogram struct {
+	mu sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum float64
+	count uint64
+}
+
+// family: the metrics sharing a name, help, type and label names
+type family struct {
+	name string
+	help string
+	kind string
+	labels []string
+	bounds []float64
+	mu sync.Mutex
+	series map[string]*series
+}
+
+// series: a single metric in a family along with its label values
+type series struct {
+	values []string
+	metric interface{}
+}
+
+
+const COUNTER = "counter"
+const GAUGE = "gauge"
+const HISTOGRAM = "histogram"
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+const LABEL_SEPARATOR = "\xff"
+
+
+var ErrDuplicateMetric = errors.New("metric already registered")
+var ErrLabelCount = errors.New("label values do not match the label names of the metric")
@@ -0,0 +1,102 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"unsafe"
+)
+
+
+//============================================= Buffer Pool
+
+
+// BufferPool: a pool of fixed size byte buffers reused across streams
+type BufferPool struct {
+	pool sync.Pool
+	bufferSize int
+	slots chan struct{}
+}
+
+
+// NewBufferPool
+//	Create a pool of buffers of the given size.
+//	Buffers are reused across streams and transfers instead of being allocated per stream.
+func NewBufferPool(bufferSize int) *BufferPool {
+	bp := &BufferPool{ bufferSize: bufferSize }
+	bp.pool.New = func() interface{} {
+		buf := make([]byte, bufferSize)
+		return &buf
+	}
+
+	return bp
+}
+
+// NewBoundedBufferPool
+//	Create a pool of buffers where the total size of buffers checked out at once never exceeds maxBytes.
+//	When the budget is exhausted, Get blocks until another buffer is returned.
+//	At least one buffer is always allowed, even if maxBytes is smaller than a single buffer.
+func NewBoundedBufferPool(bufferSize int, maxBytes int64) *BufferPool {
+	maxBuffers := maxBytes / int64(bufferSize)
+	if maxBuffers < 1 { maxBuffers = 1 }
+
+	bp := NewBufferPool(bufferSize)
+	bp.slots = make(chan struct{}, maxBuffers)
+
+	return bp
+}
+
+// NewAlignedBufferPool
+//	Create a bounded pool where the start of every buffer is aligned in memory to the given alignment, as required for O_DIRECT io.
+//	The buffer size should be a multiple of the alignment.
+func NewAlignedBufferPool(bufferSize, alignment int, maxBytes int64) *BufferPool {
+	bp := NewBoundedBufferPool(bufferSize, maxBytes)
+	bp.pool.New = func() interface{} {
+		raw := make([]byte, bufferSize + alignment)
+
+		offset := 0
+		if rem := int(uintptr(unsafe.Pointer(&raw[0])) % uintptr(alignment)); rem != 0 { offset = alignment - rem }
+
+		buf := raw[offset:offset + bufferSize:offset + bufferSize]
+		return &buf
+	}
+
+	return bp
+}
+
+// Get
+//	Take a buffer from the pool, allocating a new one if none are free.
+//	For bounded pools, this blocks until the buffer fits in the budget.
+func (bp *BufferPool) Get() []byte {
+	if bp.slots != nil { bp.slots <- struct{}{} }
+	return *(bp.pool.Get().(*[]byte))
+}
+
+// GetContext
+//	Take a buffer from the pool, returning early if the context is cancelled while waiting on the budget.
+func (bp *BufferPool) GetContext(ctx context.Context) ([]byte, error) {
+	if bp.slots != nil {
+		select {
+			case bp.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+		}
+	}
+
+	return *(bp.pool.Get().(*[]byte)), nil
+}
+
+// Put
+//	Return a buffer to the pool, releasing its share of the budget. Buffers of the wrong size are dropped.
+func (bp *BufferPool) Put(buf []byte) {
+	if bp.slots != nil { <-bp.slots }
+	if cap(buf) != bp.bufferSize { return }
+	
+	buf = buf[:bp.bufferSize]
+	bp.pool.Put(&buf)
+}
+
+// BufferSize
+//	The size of the buffers in the pool.
+func (bp *BufferPool) BufferSize() int {
+	return bp.bufferSize
+}
@@ -0,0 +1,107 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+
+// exhausted: whether GetContext would block on the pool's budget
+func exhausted(bp *BufferPool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+
+	buf, getErr := bp.GetContext(ctx)
+	if getErr != nil { return true }
+
+	bp.Put(buf)
+	return false
+}
+
+
+func TestBoundedBufferPool(t *testing.T) {
+	tests := []struct {
+		name string
+		bufferSize int
+		maxBytes int64
+		buffers int
+	}{
+		{ "budget in whole buffers", 1024, 4096, 4 },
+		{ "partial buffer rounds down", 1024, 4095, 3 },
+		{ "at least one buffer", 1024, 10, 1 },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bp := NewBoundedBufferPool(test.bufferSize, test.maxBytes)
+
+			var held [][]byte
+			for idx := 0; idx < test.buffers; idx++ {
+				buf := bp.Get()
+				if len(buf) != test.bufferSize { t.Fatalf("expected a buffer of %d bytes, got %d", test.bufferSize, len(buf)) }
+				held = append(held, buf)
+			}
+
+			if ! exhausted(bp) { t.Fatalf("expected the budget to be exhausted after %d buffers", test.buffers) }
+
+			bp.Put(held[0])
+			if exhausted(bp) { t.Error("expected a returned buffer to free its share of the budget") }
+		})
+	}
+}
+
+func TestBufferPoolGetContextCanceled(t *testing.T) {
+	bp := NewBoundedBufferPool(16, 16)
+	bp.Get()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, getErr := bp.GetContext(ctx)
+	if getErr != context.Canceled { t.Errorf("expected %v, got %v", context.Canceled, getErr) }
+}
+
+func TestBufferPoolPut(t *testing.T) {
+	bp := NewBoundedBufferPool(16, 16)
+
+	bp.Get()
+	bp.Put(make([]byte, 8))
+	if exhausted(bp) { t.Fatal("expected a dropped buffer to still release its share of the budget") }
+
+	buf := bp.Get()
+	bp.Put(buf[:4])
+	if reused := bp.Get(); len(reused) != 16 { t.Errorf("expected a resliced buffer to be restored to 16 bytes, got %d", len(reused)) }
+
+	unbounded := NewBufferPool(16)
+	for idx := 0; idx < 4; idx++ { unbounded.Get() }
+	if exhausted(unbounded) { t.Error("expected an unbounded pool to never block") }
+}
+
+func TestAlignedBufferPool(t *testing.T) {
+	tests := []struct {
+		name string
+		bufferSize int
+		alignment int
+	}{
+		{ "sector", 4096, 512 },
+		{ "page", 8192, 4096 },
+		{ "large alignment", 4096, 1 << 16 },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bp := NewAlignedBufferPool(test.bufferSize, test.alignment, int64(test.bufferSize) * 4)
+			for idx := 0; idx < 4; idx++ {
+				buf := bp.Get()
+				if len(buf) != test.bufferSize || cap(buf) != test.bufferSize { t.Fatalf("expected len and cap of %d, got %d and %d", test.bufferSize, len(buf), cap(buf)) }
+				if addr := uintptr(unsafe.Pointer(&buf[0])); addr % uintptr(test.alignment) != 0 { t.Errorf("buffer at %#x is not aligned to %d", addr, test.alignment) }
+
+				bp.Put(buf)
+			}
+
+			if exhausted(bp) { t.Error("expected every aligned buffer to be returned to the budget") }
+		})
+	}
+}
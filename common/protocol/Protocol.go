@@ -0,0 +1,652 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+
+	"github.com/sirgallo/quicfiletransfer/common/serialize"
+)
+
+
+//============================================= Protocol
+
+
+// Messages on the bidirectional comm stream are framed so that both sides can read exact payloads off of the stream.
+//	Format:
+//		byte 0: the message type
+//		bytes 1-4: uint32 representing the length of the payload
+//		bytes 5-n: the payload
+
+
+// WriteMessage
+//	Frame a payload and write it to the stream in a single write.
+//	Writing the header and payload together ensures concurrent writers do not interleave partial messages.
+func WriteMessage(w io.Writer, msgType MessageType, payload []byte) error {
+	if len(payload) > MAX_MESSAGE_LENGTH { return ErrMessageTooLarge }
+
+	msg := make([]byte, MESSAGE_HEADER_LENGTH + len(payload))
+	msg[0] = byte(msgType)
+	copy(msg[1:MESSAGE_HEADER_LENGTH], serialize.SerializeUint32(uint32(len(payload))))
+	copy(msg[MESSAGE_HEADER_LENGTH:], payload)
+
+	_, writeErr := w.Write(msg)
+	return writeErr
+}
+
+// ReadMessage
+//	Read a single framed message from the stream.
+//	io.EOF is only returned if the stream ended cleanly on a message boundary.
+func ReadMessage(r io.Reader) (MessageType, []byte, error) {
+	return NewMessageReader(r).Read()
+}
+
+// ExpectMessage
+//	Read a single message and ensure it is of the expected type.
+func ExpectMessage(r io.Reader, expected MessageType) ([]byte, error) {
+	msgType, payload, readErr := ReadMessage(r)
+	if readErr != nil { return nil, readErr }
+	if msgType != expected { return nil, ErrUnexpectedMessage }
+
+	return payload, nil
+}
+
+
+//============================================= Payloads
+
+
+// SerializeFileRequest
+//	The file request sent by the client on the comm stream.
+//	Format:
+//		bytes 0-1: uint16 representing the total number of streams to open
+//		byte 2: the requested compression codec
+//		byte 3: the mask of attributes to preserve
+//		bytes 4-7: uint32 representing the length of the path
+//		bytes 8-m: the path of the file on the remote system
+//		bytes m-(m+4): uint32 representing the total number of requested ranges
+//		bytes (m+4)-n: ranges, each as a uint64 offset followed by a uint64 length
+//	If no ranges are provided, the server sends the entire file.
+func SerializeFileRequest(req *FileRequest) []byte {
+	payload := serialize.SerializeUint16(req.Streams)
+	payload = append(payload, byte(req.Compression), byte(req.Preserve))
+	payload = append(payload, serialize.SerializeUint32(uint32(len(req.Path)))...)
+	payload = append(payload, []byte(req.Path)...)
+	payload = append(payload, SerializeRanges(req.Ranges)...)
+
+	return payload
+}
+
+// DeserializeFileRequest
+//	Transform the request payload back into a file request.
+func DeserializeFileRequest(payload []byte) (*FileRequest, error) {
+	if len(payload) < 8 { return nil, ErrInvalidPayload }
+
+	streams, desStreamsErr := serialize.DeserializeUint16(payload[:2])
+	if desStreamsErr != nil { return nil, desStreamsErr }
+
+	compression := Codec(payload[2])
+	if compression > CODEC_AUTO { return nil, ErrUnknownCodec }
+
+	preserve := AttrMask(payload[3]) & ATTR_ALL
+
+	pathLength, desPathLengthErr := serialize.DeserializeUint32(payload[4:8])
+	if desPathLengthErr != nil { return nil, desPathLengthErr }
+	if pathLength > MAX_PATH_LENGTH || uint64(len(payload)) < 8 + uint64(pathLength) { return nil, ErrInvalidPayload }
+
+	pathEnd := 8 + int(pathLength)
+	ranges, desRangesErr := DeserializeRanges(payload[pathEnd:])
+	if desRangesErr != nil { return nil, desRangesErr }
+
+	return &FileRequest{ Streams: streams, Compression: compression, Preserve: preserve, Path: string(payload[8:pathEnd]), Ranges: ranges }, nil
+}
+
+// SerializeFileMeta
+//	The metadata sent by the server in response to a file request.
+//	Format:
+//		bytes 0-7: uint64 representing the size of the file
+//		bytes 8-23: md5 in byte format
+//		bytes 24-25: uint16 representing the number of data streams granted for the request
+//		bytes 26-27: uint16 representing the maximum number of data streams allowed for the request
+//		byte 28: the compression codec chosen for the transfer
+//		byte 29: whether the file is sparse
+//		bytes 30-33: uint32 representing the total number of data extents
+//		bytes 34-m: extents, each as a uint64 offset followed by a uint64 length
+//		bytes m-n: the attributes of the file, only if any were requested
+func SerializeFileMeta(meta *FileMeta) []byte {
+	payload := make([]byte, FILE_META_LENGTH)
+	copy(payload[:8], serialize.SerializeUint64(meta.Size))
+	copy(payload[8:24], meta.Md5)
+	copy(payload[24:26], serialize.SerializeUint16(meta.Streams))
+	copy(payload[26:28], serialize.SerializeUint16(meta.MaxStreams))
+	payload[28] = byte(meta.Compression)
+	payload[29] = serialize.SerializeBool(meta.Sparse)
+	copy(payload[30:34], serialize.SerializeUint32(uint32(len(meta.Extents))))
+	for _, extent := range meta.Extents {
+		payload = append(payload, serialize.SerializeUint64(extent.Offset)...)
+		payload = append(payload, serialize.SerializeUint64(extent.Length)...)
+	}
+
+	if meta.Attrs != nil { payload = append(payload, SerializeFileAttrs(meta.Attrs)...) }
+
+	return payload
+}
+
+// DeserializeFileMeta
+//	Transform the metadata payload back into file metadata.
+func DeserializeFileMeta(payload []byte) (*FileMeta, error) {
+	if len(payload) < FILE_META_LENGTH { return nil, ErrInvalidPayload }
+
+	size, desSizeErr := serialize.DeserializeUint64(payload[:8])
+	if desSizeErr != nil { return nil, desSizeErr }
+
+	streams, desStreamsErr := serialize.DeserializeUint16(payload[24:26])
+	if desStreamsErr != nil { return nil, desStreamsErr }
+
+	maxStreams, desMaxStreamsErr := serialize.DeserializeUint16(payload[26:28])
+	if desMaxStreamsErr != nil { return nil, desMaxStreamsErr }
+
+	compression := Codec(payload[28])
+	if compression >= CODEC_AUTO { return nil, ErrUnknownCodec }
+
+	sparse := serialize.DeserializeBool(payload[29])
+
+	totalExtents, desTotalErr := serialize.DeserializeUint32(payload[30:34])
+	if desTotalErr != nil { return nil, desTotalErr }
+
+	extentsEnd := FILE_META_LENGTH + uint64(totalExtents) * RANGE_LENGTH
+	if uint64(len(payload)) < extentsEnd { return nil, ErrInvalidPayload }
+
+	extents := make([]Range, totalExtents)
+	for idx := range extents {
+		start := FILE_META_LENGTH + idx * RANGE_LENGTH
+
+		offset, desOffsetErr := serialize.DeserializeUint64(payload[start:start + 8])
+		if desOffsetErr != nil { return nil, desOffsetErr }
+
+		length, desLengthErr := serialize.DeserializeUint64(payload[start + 8:start + RANGE_LENGTH])
+		if desLengthErr != nil { return nil, desLengthErr }
+
+		previousEnd := uint64(0)
+		if idx > 0 { previousEnd = extents[idx - 1].Offset + extents[idx - 1].Length }
+		if offset < previousEnd || offset > size || length > size - offset { return nil, ErrInvalidPayload }
+
+		extents[idx] = Range{ Offset: offset, Length: length }
+	}
+
+	meta := &FileMeta{ 
+		Size: size, 
+		Md5: payload[8:24], 
+		Streams: streams, 
+		MaxStreams: maxStreams, 
+		Compression: compression, 
+		Sparse: sparse, 
+		Extents: extents,
+	}
+
+	if uint64(len(payload)) == extentsEnd { return meta, nil }
+
+	attrs, desAttrsErr := DeserializeFileAttrs(payload[extentsEnd:])
+	if desAttrsErr != nil { return nil, desAttrsErr }
+
+	meta.Attrs = attrs
+	return meta, nil
+}
+
+// SerializeRanges
+//	Format:
+//		bytes 0-3: uint32 representing the total number of ranges
+//		bytes 4-n: ranges, each as a uint64 offset followed by a uint64 length
+func SerializeRanges(ranges []Range) []byte {
+	payload := serialize.SerializeUint32(uint32(len(ranges)))
+	for _, r := range ranges {
+		payload = append(payload, serialize.SerializeUint64(r.Offset)...)
+		payload = append(payload, serialize.SerializeUint64(r.Length)...)
+	}
+
+	return payload
+}
+
+// DeserializeRanges
+//	Transform a list of serialized ranges back into ranges.
+func DeserializeRanges(payload []byte) ([]Range, error) {
+	if len(payload) < 4 { return nil, ErrInvalidPayload }
+
+	totalRanges, desTotalErr := serialize.DeserializeUint32(payload[:4])
+	if desTotalErr != nil { return nil, desTotalErr }
+	if uint64(len(payload) - 4) != uint64(totalRanges) * RANGE_LENGTH { return nil, ErrInvalidPayload }
+
+	ranges := make([]Range, totalRanges)
+	for idx := range ranges {
+		start := 4 + idx * RANGE_LENGTH
+
+		offset, desOffsetErr := serialize.DeserializeUint64(payload[start:start + 8])
+		if desOffsetErr != nil { return nil, desOffsetErr }
+
+		length, desLengthErr := serialize.DeserializeUint64(payload[start + 8:start + RANGE_LENGTH])
+		if desLengthErr != nil { return nil, desLengthErr }
+
+		ranges[idx] = Range{ Offset: offset, Length: length }
+	}
+
+	return ranges, nil
+}
+
+// SerializeChunkHeader
+//	The header written to a data stream before each chunk of file data.
+//	Format:
+//		bytes 0-7: uint64 representing the offset in the file where the chunk begins
+//		bytes 8-15: uint64 representing the size of the chunk once decoded
+//		bytes 16-23: uint64 representing the size of the chunk on the stream
+//		byte 24: the compression codec applied to the chunk
+func SerializeChunkHeader(header *ChunkHeader) []byte {
+	payload := make([]byte, CHUNK_HEADER_LENGTH)
+	copy(payload[:8], serialize.SerializeUint64(header.Offset))
+	copy(payload[8:16], serialize.SerializeUint64(header.Size))
+	copy(payload[16:24], serialize.SerializeUint64(header.EncodedSize))
+	payload[24] = byte(header.Codec)
+
+	return payload
+}
+
+// DeserializeChunkHeader
+//	Transform the bytes preceding a chunk back into its header.
+//	Uncompressed chunks must have the same size on the stream as on disk.
+func DeserializeChunkHeader(payload []byte) (*ChunkHeader, error) {
+	if len(payload) != CHUNK_HEADER_LENGTH { return nil, ErrInvalidPayload }
+
+	offset, desOffsetErr := serialize.DeserializeUint64(payload[:8])
+	if desOffsetErr != nil { return nil, desOffsetErr }
+
+	size, desSizeErr := serialize.DeserializeUint64(payload[8:16])
+	if desSizeErr != nil { return nil, desSizeErr }
+
+	encodedSize, desEncodedSizeErr := serialize.DeserializeUint64(payload[16:24])
+	if desEncodedSizeErr != nil { return nil, desEncodedSizeErr }
+
+	codec := Codec(payload[24])
+	if codec >= CODEC_AUTO { return nil, ErrUnknownCodec }
+	if codec == CODEC_NONE && encodedSize != size { return nil, ErrInvalidPayload }
+
+	return &ChunkHeader{ Offset: offset, Size: size, EncodedSize: encodedSize, Codec: codec }, nil
+}
+
+// SerializeDeltaRequest
+//	The delta request sent by the client on a comm stream.
+//	Format:
+//		bytes 0-3: uint32 representing the length of the path
+//		bytes 4-m: the path of the file on the remote system
+//		bytes m-(m+4): uint32 representing the block size
+//		byte m+4: the mask of attributes to preserve
+//		bytes (m+5)-(m+9): uint32 representing the total number of blocks
+//		bytes (m+9)-n: blocks, each as a uint32 weak checksum followed by a 16 byte strong hash
+func SerializeDeltaRequest(req *DeltaRequest) []byte {
+	payload := serialize.SerializeUint32(uint32(len(req.Path)))
+	payload = append(payload, []byte(req.Path)...)
+	payload = append(payload, serialize.SerializeUint32(req.BlockSize)...)
+	payload = append(payload, byte(req.Preserve))
+	payload = append(payload, serialize.SerializeUint32(uint32(len(req.Blocks)))...)
+	for _, block := range req.Blocks {
+		payload = append(payload, serialize.SerializeUint32(block.Weak)...)
+		payload = append(payload, block.Strong[:]...)
+	}
+
+	return payload
+}
+
+// DeserializeDeltaRequest
+//	Transform the delta request payload back into a delta request.
+func DeserializeDeltaRequest(payload []byte) (*DeltaRequest, error) {
+	if len(payload) < 4 { return nil, ErrInvalidPayload }
+
+	pathLength, desPathLengthErr := serialize.DeserializeUint32(payload[:4])
+	if desPathLengthErr != nil { return nil, desPathLengthErr }
+	if pathLength > MAX_PATH_LENGTH || uint64(len(payload)) < 13 + uint64(pathLength) { return nil, ErrInvalidPayload }
+
+	pathEnd := 4 + int(pathLength)
+	blockSize, desBlockSizeErr := serialize.DeserializeUint32(payload[pathEnd:pathEnd + 4])
+	if desBlockSizeErr != nil { return nil, desBlockSizeErr }
+
+	preserve := AttrMask(payload[pathEnd + 4]) & ATTR_ALL
+
+	totalBlocks, desTotalErr := serialize.DeserializeUint32(payload[pathEnd + 5:pathEnd + 9])
+	if desTotalErr != nil { return nil, desTotalErr }
+	
+	blocksStart := pathEnd + 9
+	if uint64(len(payload) - blocksStart) != uint64(totalBlocks) * BLOCK_SIGNATURE_LENGTH { return nil, ErrInvalidPayload }
+
+	blocks := make([]BlockSignature, totalBlocks)
+	for idx := range blocks {
+		start := blocksStart + idx * BLOCK_SIGNATURE_LENGTH
+
+		weak, desWeakErr := serialize.DeserializeUint32(payload[start:start + 4])
+		if desWeakErr != nil { return nil, desWeakErr }
+
+		blocks[idx].Weak = weak
+		copy(blocks[idx].Strong[:], payload[start + 4:start + BLOCK_SIGNATURE_LENGTH])
+	}
+
+	return &DeltaRequest{ Path: string(payload[4:pathEnd]), BlockSize: blockSize, Preserve: preserve, Blocks: blocks }, nil
+}
+
+// SerializeDeltaMeta
+//	The response sent by the server for a delta request.
+//	Format:
+//		bytes 0-7: uint64 representing the size of the file
+//		bytes 8-23: md5 in byte format
+//		bytes 24-27: uint32 representing the total number of copies
+//		bytes 28-m: copies, each as a uint64 offset, a uint64 offset in the client's copy, and a uint64 length
+//		bytes m-n: the attributes of the file, only if any were requested
+func SerializeDeltaMeta(meta *DeltaMeta) []byte {
+	payload := make([]byte, 24, 28 + len(meta.Copies) * BLOCK_COPY_LENGTH)
+	copy(payload[:8], serialize.SerializeUint64(meta.Size))
+	copy(payload[8:24], meta.Md5)
+	payload = append(payload, serialize.SerializeUint32(uint32(len(meta.Copies)))...)
+	for _, c := range meta.Copies {
+		payload = append(payload, serialize.SerializeUint64(c.Offset)...)
+		payload = append(payload, serialize.SerializeUint64(c.BasisOffset)...)
+		payload = append(payload, serialize.SerializeUint64(c.Length)...)
+	}
+
+	if meta.Attrs != nil { payload = append(payload, SerializeFileAttrs(meta.Attrs)...) }
+	return payload
+}
+
+// DeserializeDeltaMeta
+//	Transform the delta response payload back into delta metadata.
+func DeserializeDeltaMeta(payload []byte) (*DeltaMeta, error) {
+	if len(payload) < 28 { return nil, ErrInvalidPayload }
+
+	size, desSizeErr := serialize.DeserializeUint64(payload[:8])
+	if desSizeErr != nil { return nil, desSizeErr }
+
+	totalCopies, desTotalErr := serialize.DeserializeUint32(payload[24:28])
+	if desTotalErr != nil { return nil, desTotalErr }
+	copiesEnd := 28 + uint64(totalCopies) * BLOCK_COPY_LENGTH
+	if uint64(len(payload)) < copiesEnd { return nil, ErrInvalidPayload }
+
+	copies := make([]BlockCopy, totalCopies)
+	for idx := range copies {
+		start := 28 + idx * BLOCK_COPY_LENGTH
+
+		offset, desOffsetErr := serialize.DeserializeUint64(payload[start:start + 8])
+		if desOffsetErr != nil { return nil, desOffsetErr }
+
+		basisOffset, desBasisOffsetErr := serialize.DeserializeUint64(payload[start + 8:start + 16])
+		if desBasisOffsetErr != nil { return nil, desBasisOffsetErr }
+
+		length, desLengthErr := serialize.DeserializeUint64(payload[start + 16:start + BLOCK_COPY_LENGTH])
+		if desLengthErr != nil { return nil, desLengthErr }
+
+		copies[idx] = BlockCopy{ Offset: offset, BasisOffset: basisOffset, Length: length }
+	}
+
+	meta := &DeltaMeta{ Size: size, Md5: payload[8:24], Copies: copies }
+	if uint64(len(payload)) == copiesEnd { return meta, nil }
+
+	attrs, desAttrsErr := DeserializeFileAttrs(payload[copiesEnd:])
+	if desAttrsErr != nil { return nil, desAttrsErr }
+
+	meta.Attrs = attrs
+	return meta, nil
+}
+
+// SerializeFileAttrs
+//	The attributes of a file, sent along with its metadata.
+//	Format:
+//		byte 0: the mask of attributes that are set
+//		bytes 1-4: uint32 representing the file mode
+//		bytes 5-12: uint64 modification time in nanoseconds since the unix epoch
+//		bytes 13-20: uint64 access time in nanoseconds since the unix epoch
+//		bytes 21-24: uint32 uid
+//		bytes 25-28: uint32 gid
+//		bytes 29-32: uint16 representing the length of the user name, followed by uint16 representing the length of the group name
+//		bytes 33-m: the user name followed by the group name
+//		bytes m-(m+2): uint16 representing the total number of extended attributes
+//		bytes (m+2)-n: extended attributes, each as a uint16 length and name followed by a uint32 length and value
+func SerializeFileAttrs(attrs *FileAttrs) []byte {
+	payload := []byte{ byte(attrs.Mask) }
+	payload = append(payload, serialize.SerializeUint32(attrs.Mode)...)
+	payload = append(payload, serialize.SerializeUint64(uint64(attrs.ModTime))...)
+	payload = append(payload, serialize.SerializeUint64(uint64(attrs.AccessTime))...)
+	payload = append(payload, serialize.SerializeUint32(attrs.Uid)...)
+	payload = append(payload, serialize.SerializeUint32(attrs.Gid)...)
+	payload = append(payload, serialize.SerializeUint16(uint16(len(attrs.User)))...)
+	payload = append(payload, serialize.SerializeUint16(uint16(len(attrs.Group)))...)
+	payload = append(payload, []byte(attrs.User)...)
+	payload = append(payload, []byte(attrs.Group)...)
+	payload = append(payload, serialize.SerializeUint16(uint16(len(attrs.Xattrs)))...)
+	for _, xattr := range attrs.Xattrs {
+		payload = append(payload, serialize.SerializeUint16(uint16(len(xattr.Name)))...)
+		payload = append(payload, []byte(xattr.Name)...)
+		payload = append(payload, serialize.SerializeUint32(uint32(len(xattr.Value)))...)
+		payload = append(payload, xattr.Value...)
+	}
+
+	return payload
+}
+
+// DeserializeFileAttrs
+//	Transform the attributes payload back into file attributes. The payload is copied, so it may be reused afterwards.
+func DeserializeFileAttrs(payload []byte) (*FileAttrs, error) {
+	if len(payload) < FILE_ATTRS_LENGTH + 2 { return nil, ErrInvalidPayload }
+
+	mode, desModeErr := serialize.DeserializeUint32(payload[1:5])
+	if desModeErr != nil { return nil, desModeErr }
+
+	modTime, desModTimeErr := serialize.DeserializeUint64(payload[5:13])
+	if desModTimeErr != nil { return nil, desModTimeErr }
+
+	accessTime, desAccessTimeErr := serialize.DeserializeUint64(payload[13:21])
+	if desAccessTimeErr != nil { return nil, desAccessTimeErr }
+
+	uid, desUidErr := serialize.DeserializeUint32(payload[21:25])
+	if desUidErr != nil { return nil, desUidErr }
+
+	gid, desGidErr := serialize.DeserializeUint32(payload[25:29])
+	if desGidErr != nil { return nil, desGidErr }
+
+	attrs := &FileAttrs{ 
+		Mask: AttrMask(payload[0]) & ATTR_ALL, 
+		Mode: mode, 
+		ModTime: int64(modTime), 
+		AccessTime: int64(accessTime), 
+		Uid: uid, 
+		Gid: gid,
+	}
+
+	userLength, desUserLengthErr := serialize.DeserializeUint16(payload[29:31])
+	if desUserLengthErr != nil { return nil, desUserLengthErr }
+
+	groupLength, desGroupLengthErr := serialize.DeserializeUint16(payload[31:33])
+	if desGroupLengthErr != nil { return nil, desGroupLengthErr }
+
+	namesEnd := FILE_ATTRS_LENGTH + int(userLength) + int(groupLength)
+	if len(payload) < namesEnd + 2 { return nil, ErrInvalidPayload }
+
+	attrs.User = string(payload[FILE_ATTRS_LENGTH:FILE_ATTRS_LENGTH + int(userLength)])
+	attrs.Group = string(payload[FILE_ATTRS_LENGTH + int(userLength):namesEnd])
+
+	totalXattrs, desTotalErr := serialize.DeserializeUint16(payload[namesEnd:namesEnd + 2])
+	if desTotalErr != nil { return nil, desTotalErr }
+
+	attrs.Xattrs = make([]Xattr, totalXattrs)
+	start := namesEnd + 2
+	for idx := range attrs.Xattrs {
+		if len(payload) - start < 2 { return nil, ErrInvalidPayload }
+
+		nameLength, desNameLengthErr := serialize.DeserializeUint16(payload[start:start + 2])
+		if desNameLengthErr != nil { return nil, desNameLengthErr }
+
+		nameEnd := start + 2 + int(nameLength)
+		if len(payload) < nameEnd + 4 { return nil, ErrInvalidPayload }
+
+		valueLength, desValueLengthErr := serialize.DeserializeUint32(payload[nameEnd:nameEnd + 4])
+		if desValueLengthErr != nil { return nil, desValueLengthErr }
+		if valueLength > MAX_XATTR_VALUE_LENGTH || uint64(len(payload) - nameEnd - 4) < uint64(valueLength) { return nil, ErrInvalidPayload }
+
+		valueEnd := nameEnd + 4 + int(valueLength)
+		attrs.Xattrs[idx] = Xattr{ Name: string(payload[start + 2:nameEnd]), Value: append([]byte(nil), payload[nameEnd + 4:valueEnd]...) }
+		start = valueEnd
+	}
+
+	if start != len(payload) { return nil, ErrInvalidPayload }
+	return attrs, nil
+}
+
+
+// SerializeListRequest
+//	The list request sent by the client on a comm stream.
+//	Format:
+//		bytes 0-3: uint32 representing the length of the path
+//		bytes 4-m: the path of the directory on the remote system
+//		bytes m-(m+4): uint32 representing the total number of filter rules
+//		bytes (m+4)-n: rules, each as a uint32 length followed by the rule
+func SerializeListRequest(req *ListRequest) []byte {
+	payload := serialize.SerializeUint32(uint32(len(req.Path)))
+	payload = append(payload, []byte(req.Path)...)
+	payload = append(payload, serialize.SerializeUint32(uint32(len(req.Rules)))...)
+	for _, rule := range req.Rules {
+		payload = append(payload, serialize.SerializeUint32(uint32(len(rule)))...)
+		payload = append(payload, []byte(rule)...)
+	}
+
+	return payload
+}
+
+// DeserializeListRequest
+//	Transform the list request payload back into a list request.
+func DeserializeListRequest(payload []byte) (*ListRequest, error) {
+	if len(payload) < 8 { return nil, ErrInvalidPayload }
+
+	pathLength, desPathLengthErr := serialize.DeserializeUint32(payload[:4])
+	if desPathLengthErr != nil { return nil, desPathLengthErr }
+	if pathLength > MAX_PATH_LENGTH || uint64(len(payload)) < 8 + uint64(pathLength) { return nil, ErrInvalidPayload }
+
+	pathEnd := 4 + int(pathLength)
+	totalRules, desTotalErr := serialize.DeserializeUint32(payload[pathEnd:pathEnd + 4])
+	if desTotalErr != nil { return nil, desTotalErr }
+	if uint64(totalRules) * 4 > uint64(len(payload) - pathEnd - 4) { return nil, ErrInvalidPayload }
+
+	rules := make([]string, totalRules)
+	start := pathEnd + 4
+	for idx := range rules {
+		if len(payload) - start < 4 { return nil, ErrInvalidPayload }
+
+		ruleLength, desRuleLengthErr := serialize.DeserializeUint32(payload[start:start + 4])
+		if desRuleLengthErr != nil { return nil, desRuleLengthErr }
+		if ruleLength > MAX_PATH_LENGTH || uint64(len(payload) - start - 4) < uint64(ruleLength) { return nil, ErrInvalidPayload }
+
+		rules[idx] = string(payload[start + 4:start + 4 + int(ruleLength)])
+		start += 4 + int(ruleLength)
+	}
+
+	if start != len(payload) { return nil, ErrInvalidPayload }
+	return &ListRequest{ Path: string(payload[4:pathEnd]), Rules: rules }, nil
+}
+
+// SerializeManifest
+//	A batch of manifest entries sent by the server in response to a list request.
+//	Format:
+//		bytes 0-3: uint32 representing the total number of entries
+//		bytes 4-n: entries, each as:
+//			uint32 representing the length of the path, followed by the path
+//			uint64 size
+//			uint64 modification time in nanoseconds since the unix epoch
+//			uint32 file mode
+//			16 byte md5, zeroed for directories
+func SerializeManifest(entries []ManifestEntry) []byte {
+	payload := serialize.SerializeUint32(uint32(len(entries)))
+	for _, entry := range entries {
+		md5 := make([]byte, 16)
+		copy(md5, entry.Md5)
+
+		payload = append(payload, serialize.SerializeUint32(uint32(len(entry.Path)))...)
+		payload = append(payload, []byte(entry.Path)...)
+		payload = append(payload, serialize.SerializeUint64(entry.Size)...)
+		payload = append(payload, serialize.SerializeUint64(uint64(entry.ModTime))...)
+		payload = append(payload, serialize.SerializeUint32(entry.Mode)...)
+		payload = append(payload, md5...)
+	}
+
+	return payload
+}
+
+// DeserializeManifest
+//	Transform a manifest payload back into its entries.
+func DeserializeManifest(payload []byte) ([]ManifestEntry, error) {
+	if len(payload) < 4 { return nil, ErrInvalidPayload }
+
+	totalEntries, desTotalErr := serialize.DeserializeUint32(payload[:4])
+	if desTotalErr != nil { return nil, desTotalErr }
+	if uint64(totalEntries) * (4 + MANIFEST_ENTRY_LENGTH) > uint64(len(payload)) { return nil, ErrInvalidPayload }
+
+	entries := make([]ManifestEntry, totalEntries)
+	start := 4
+	for idx := range entries {
+		if len(payload) - start < 4 { return nil, ErrInvalidPayload }
+
+		pathLength, desPathLengthErr := serialize.DeserializeUint32(payload[start:start + 4])
+		if desPathLengthErr != nil { return nil, desPathLengthErr }
+		if pathLength > MAX_PATH_LENGTH || uint64(len(payload) - start) < 4 + uint64(pathLength) + MANIFEST_ENTRY_LENGTH { return nil, ErrInvalidPayload }
+
+		pathEnd := start + 4 + int(pathLength)
+		size, desSizeErr := serialize.DeserializeUint64(payload[pathEnd:pathEnd + 8])
+		if desSizeErr != nil { return nil, desSizeErr }
+
+		modTime, desModTimeErr := serialize.DeserializeUint64(payload[pathEnd + 8:pathEnd + 16])
+		if desModTimeErr != nil { return nil, desModTimeErr }
+
+		mode, desModeErr := serialize.DeserializeUint32(payload[pathEnd + 16:pathEnd + 20])
+		if desModeErr != nil { return nil, desModeErr }
+
+		entries[idx] = ManifestEntry{ 
+			Path: string(payload[start + 4:pathEnd]), 
+			Size: size, 
+			ModTime: int64(modTime), 
+			Mode: mode, 
+			Md5: append([]byte(nil), payload[pathEnd + 20:pathEnd + MANIFEST_ENTRY_LENGTH]...),
+		}
+
+		start = pathEnd + MANIFEST_ENTRY_LENGTH
+	}
+
+	if start != len(payload) { return nil, ErrInvalidPayload }
+	return entries, nil
+}
+
+
+var ErrMessageTooLarge = errors.New("message exceeds max message length")
+var ErrUnexpectedMessage = errors.New("unexpected message type")
+var ErrInvalidPayload = errors.New("payload incorrect length")
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+
+//============================================= Message Reader
+
+
+// NewMessageReader
+//	Create a reader for a stream carrying many messages.
+//	The header and payload buffers are reused between messages, so a payload is only valid until the next call to Read.
+func NewMessageReader(r io.Reader) *MessageReader {
+	return &MessageReader{ r: r, header: make([]byte, MESSAGE_HEADER_LENGTH) }
+}
+
+// Read
+//	Read the next framed message from the stream.
+//	io.EOF is only returned if the stream ended cleanly on a message boundary.
+func (mr *MessageReader) Read() (MessageType, []byte, error) {
+	_, readHeaderErr := io.ReadFull(mr.r, mr.header)
+	if readHeaderErr != nil { return 0, nil, readHeaderErr }
+
+	payloadLength, desLengthErr := serialize.DeserializeUint32(mr.header[1:])
+	if desLengthErr != nil { return 0, nil, desLengthErr }
+	if payloadLength > MAX_MESSAGE_LENGTH { return 0, nil, ErrMessageTooLarge }
+
+	if uint32(cap(mr.payload)) < payloadLength { mr.payload = make([]byte, payloadLength) }
+	payload := mr.payload[:payloadLength]
+
+	_, readPayloadErr := io.ReadFull(mr.r, payload)
+	if readPayloadErr == io.EOF { return 0, nil, io.ErrUnexpectedEOF }
+	if readPayloadErr != nil { return 0, nil, readPayloadErr }
+
+	return MessageType(mr.header[0]), payload, nil
+}
@@ -0,0 +1,229 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+
+var md5Sum = []byte{ 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15 }
+
+var attrs = &FileAttrs{
+	Mask: ATTR_ALL,
+	Mode: 0o4755,
+	ModTime: 1700000000123456789,
+	AccessTime: -1,
+	Uid: 1000,
+	Gid: 100,
+	User: "alice",
+	Group: "users",
+	Xattrs: []Xattr{{ Name: "user.tag", Value: []byte("blue") }, { Name: "user.empty" }},
+}
+
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		payload []byte
+		deserialize func([]byte) (interface{}, error)
+		expected interface{}
+		// prefix: the length of a shorter payload that is also valid, when the message ends in optional fields
+		prefix int
+	}{
+		{
+			"file request, whole file",
+			SerializeFileRequest(&FileRequest{ Streams: 8, Compression: CODEC_AUTO, Preserve: ATTR_MODE | ATTR_TIMES, Path: "/data/file", Ranges: []Range{} }),
+			func(p []byte) (interface{}, error) { return DeserializeFileRequest(p) },
+			&FileRequest{ Streams: 8, Compression: CODEC_AUTO, Preserve: ATTR_MODE | ATTR_TIMES, Path: "/data/file", Ranges: []Range{} },
+			0,
+		},
+		{
+			"file request, ranges",
+			SerializeFileRequest(&FileRequest{ Streams: 65535, Path: "f", Ranges: []Range{{ Offset: 0, Length: 10 }, { Offset: 1 << 40, Length: 1 }} }),
+			func(p []byte) (interface{}, error) { return DeserializeFileRequest(p) },
+			&FileRequest{ Streams: 65535, Path: "f", Ranges: []Range{{ Offset: 0, Length: 10 }, { Offset: 1 << 40, Length: 1 }} },
+			0,
+		},
+		{
+			"file meta",
+			SerializeFileMeta(&FileMeta{ Size: 1 << 33, Md5: md5Sum, Streams: 4, MaxStreams: 32, Compression: CODEC_ZSTD, Extents: []Range{} }),
+			func(p []byte) (interface{}, error) { return DeserializeFileMeta(p) },
+			&FileMeta{ Size: 1 << 33, Md5: md5Sum, Streams: 4, MaxStreams: 32, Compression: CODEC_ZSTD, Extents: []Range{} },
+			0,
+		},
+		{
+			"file meta, sparse with attributes",
+			SerializeFileMeta(&FileMeta{ Size: 100, Md5: md5Sum, Streams: 1, MaxStreams: 1, Sparse: true, Extents: []Range{{ Offset: 0, Length: 10 }, { Offset: 50, Length: 50 }}, Attrs: attrs }),
+			func(p []byte) (interface{}, error) { return DeserializeFileMeta(p) },
+			&FileMeta{ Size: 100, Md5: md5Sum, Streams: 1, MaxStreams: 1, Sparse: true, Extents: []Range{{ Offset: 0, Length: 10 }, { Offset: 50, Length: 50 }}, Attrs: attrs },
+			FILE_META_LENGTH + 2 * RANGE_LENGTH,
+		},
+		{
+			"ranges",
+			SerializeRanges([]Range{{ Offset: 5, Length: 6 }}),
+			func(p []byte) (interface{}, error) { return DeserializeRanges(p) },
+			[]Range{{ Offset: 5, Length: 6 }},
+			0,
+		},
+		{
+			"chunk header",
+			SerializeChunkHeader(&ChunkHeader{ Offset: 1 << 50, Size: 1 << 21, EncodedSize: 1000, Codec: CODEC_GZIP }),
+			func(p []byte) (interface{}, error) { return DeserializeChunkHeader(p) },
+			&ChunkHeader{ Offset: 1 << 50, Size: 1 << 21, EncodedSize: 1000, Codec: CODEC_GZIP },
+			0,
+		},
+		{
+			"delta request",
+			SerializeDeltaRequest(&DeltaRequest{ Path: "/data/file", BlockSize: 4096, Preserve: ATTR_OWNER, Blocks: []BlockSignature{{ Weak: 1 }, { Weak: 0xffffffff, Strong: [16]byte{ 15: 1 } }} }),
+			func(p []byte) (interface{}, error) { return DeserializeDeltaRequest(p) },
+			&DeltaRequest{ Path: "/data/file", BlockSize: 4096, Preserve: ATTR_OWNER, Blocks: []BlockSignature{{ Weak: 1 }, { Weak: 0xffffffff, Strong: [16]byte{ 15: 1 } }} },
+			0,
+		},
+		{
+			"delta meta",
+			SerializeDeltaMeta(&DeltaMeta{ Size: 8192, Md5: md5Sum, Copies: []BlockCopy{{ Offset: 4096, BasisOffset: 0, Length: 4096 }} }),
+			func(p []byte) (interface{}, error) { return DeserializeDeltaMeta(p) },
+			&DeltaMeta{ Size: 8192, Md5: md5Sum, Copies: []BlockCopy{{ Offset: 4096, BasisOffset: 0, Length: 4096 }} },
+			0,
+		},
+		{
+			"delta meta with attributes",
+			SerializeDeltaMeta(&DeltaMeta{ Size: 0, Md5: md5Sum, Copies: []BlockCopy{}, Attrs: attrs }),
+			func(p []byte) (interface{}, error) { return DeserializeDeltaMeta(p) },
+			&DeltaMeta{ Size: 0, Md5: md5Sum, Copies: []BlockCopy{}, Attrs: attrs },
+			28,
+		},
+		{
+			"file attributes without names",
+			SerializeFileAttrs(&FileAttrs{ Mask: ATTR_MODE, Mode: 0o644, Xattrs: []Xattr{} }),
+			func(p []byte) (interface{}, error) { return DeserializeFileAttrs(p) },
+			&FileAttrs{ Mask: ATTR_MODE, Mode: 0o644, Xattrs: []Xattr{} },
+			0,
+		},
+		{
+			"list request",
+			SerializeListRequest(&ListRequest{ Path: "/data", Rules: []string{ "*.log", "!keep.log", "" } }),
+			func(p []byte) (interface{}, error) { return DeserializeListRequest(p) },
+			&ListRequest{ Path: "/data", Rules: []string{ "*.log", "!keep.log", "" } },
+			0,
+		},
+		{
+			"manifest",
+			SerializeManifest([]ManifestEntry{{ Path: "dir", Mode: 0x80000000 | 0o755, Md5: make([]byte, 16) }, { Path: "dir/file", Size: 3, ModTime: 42, Mode: 0o644, Md5: md5Sum }}),
+			func(p []byte) (interface{}, error) { return DeserializeManifest(p) },
+			[]ManifestEntry{{ Path: "dir", Mode: 0x80000000 | 0o755, Md5: make([]byte, 16) }, { Path: "dir/file", Size: 3, ModTime: 42, Mode: 0o644, Md5: md5Sum }},
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, desErr := test.deserialize(test.payload)
+			if desErr != nil { t.Fatal(desErr) }
+			if ! reflect.DeepEqual(decoded, test.expected) { t.Errorf("expected %+v, got %+v", test.expected, decoded) }
+
+			for length := 0; length < len(test.payload); length++ {
+				_, truncatedErr := test.deserialize(test.payload[:length])
+				if truncatedErr == nil && length != test.prefix { t.Errorf("expected an error for the payload truncated to %d of %d bytes", length, len(test.payload)) }
+			}
+		})
+	}
+}
+
+func TestDeserializeInvalid(t *testing.T) {
+	validHeader := SerializeChunkHeader(&ChunkHeader{ Offset: 0, Size: 10, EncodedSize: 10 })
+	mismatchedHeader := SerializeChunkHeader(&ChunkHeader{ Offset: 0, Size: 10, EncodedSize: 5 })
+	autoHeader := append(validHeader[:CHUNK_HEADER_LENGTH - 1:CHUNK_HEADER_LENGTH - 1], byte(CODEC_AUTO))
+
+	tests := []struct {
+		name string
+		deserialize func() error
+		err error
+	}{
+		{ "uncompressed chunk with a different encoded size", func() error { _, err := DeserializeChunkHeader(mismatchedHeader); return err }, ErrInvalidPayload },
+		{ "chunk compressed with auto", func() error { _, err := DeserializeChunkHeader(autoHeader); return err }, ErrUnknownCodec },
+		{ "request with an unknown codec", func() error {
+			_, err := DeserializeFileRequest(SerializeFileRequest(&FileRequest{ Compression: CODEC_AUTO + 1 }))
+			return err
+		}, ErrUnknownCodec },
+		{ "meta choosing auto", func() error {
+			_, err := DeserializeFileMeta(SerializeFileMeta(&FileMeta{ Md5: md5Sum, Compression: CODEC_AUTO }))
+			return err
+		}, ErrUnknownCodec },
+		{ "overlapping extents", func() error {
+			_, err := DeserializeFileMeta(SerializeFileMeta(&FileMeta{ Size: 100, Md5: md5Sum, Extents: []Range{{ Offset: 0, Length: 20 }, { Offset: 10, Length: 5 }} }))
+			return err
+		}, ErrInvalidPayload },
+		{ "extent past the end of the file", func() error {
+			_, err := DeserializeFileMeta(SerializeFileMeta(&FileMeta{ Size: 100, Md5: md5Sum, Extents: []Range{{ Offset: 90, Length: 1 << 63 }} }))
+			return err
+		}, ErrInvalidPayload },
+		{ "path too long", func() error {
+			_, err := DeserializeListRequest(SerializeListRequest(&ListRequest{ Path: string(make([]byte, MAX_PATH_LENGTH + 1)) }))
+			return err
+		}, ErrInvalidPayload },
+		{ "trailing bytes after the ranges", func() error {
+			_, err := DeserializeRanges(append(SerializeRanges([]Range{{ Offset: 1, Length: 1 }}), 0))
+			return err
+		}, ErrInvalidPayload },
+		{ "trailing bytes after the manifest", func() error {
+			_, err := DeserializeManifest(append(SerializeManifest([]ManifestEntry{{ Path: "a" }}), 0))
+			return err
+		}, ErrInvalidPayload },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.deserialize()
+			if ! errors.Is(err, test.err) { t.Errorf("expected %v, got %v", test.err, err) }
+		})
+	}
+}
+
+func TestMessageFraming(t *testing.T) {
+	var stream bytes.Buffer
+	messages := []struct {
+		msgType MessageType
+		payload []byte
+	}{
+		{ FILE_REQUEST, SerializeFileRequest(&FileRequest{ Streams: 2, Path: "f" }) },
+		{ PROGRESS, []byte{ 1, 2, 3, 4, 5, 6, 7, 8 } },
+		{ TRANSFER_DONE, []byte{} },
+		{ MANIFEST, SerializeManifest(nil) },
+	}
+
+	for _, msg := range messages {
+		writeErr := WriteMessage(&stream, msg.msgType, msg.payload)
+		if writeErr != nil { t.Fatal(writeErr) }
+	}
+
+	reader := NewMessageReader(&stream)
+	for _, msg := range messages {
+		msgType, payload, readErr := reader.Read()
+		if readErr != nil { t.Fatal(readErr) }
+		if msgType != msg.msgType || ! bytes.Equal(payload, msg.payload) { t.Errorf("expected %d %v, got %d %v", msg.msgType, msg.payload, msgType, payload) }
+	}
+
+	_, _, eofErr := reader.Read()
+	if eofErr != io.EOF { t.Errorf("expected io.EOF at a message boundary, got %v", eofErr) }
+
+	WriteMessage(&stream, PROGRESS, []byte{ 1, 2, 3 })
+	stream.Truncate(stream.Len() - 1)
+	_, _, truncatedErr := ReadMessage(&stream)
+	if truncatedErr != io.ErrUnexpectedEOF { t.Errorf("expected io.ErrUnexpectedEOF for a truncated payload, got %v", truncatedErr) }
+
+	_, expectErr := ExpectMessage(bytes.NewReader(frame(PROGRESS)), FILE_META)
+	if expectErr != ErrUnexpectedMessage { t.Errorf("expected %v, got %v", ErrUnexpectedMessage, expectErr) }
+
+	tooLargeErr := WriteMessage(io.Discard, PROGRESS, make([]byte, MAX_MESSAGE_LENGTH + 1))
+	if tooLargeErr != ErrMessageTooLarge { t.Errorf("expected %v, got %v", ErrMessageTooLarge, tooLargeErr) }
+}
+
+func frame(msgType MessageType) []byte {
+	var buf bytes.Buffer
+	WriteMessage(&buf, msgType, nil)
+	return buf.Bytes()
+}
@@ -0,0 +1,209 @@
+package protocol
+
+import "io"
+
+
+// MessageType: identifies the payload of a framed message on the comm stream
+type MessageType uint8
+
+const (
+	// FILE_REQUEST: client -> server, requests a file (or ranges of a file)
+	FILE_REQUEST MessageType = iota + 1
+	// FILE_META: server -> client, the size and md5 of the requested file
+	FILE_META
+	// PROGRESS: server -> client, the number of bytes written to a data stream
+	PROGRESS
+	// ADD_STREAMS: client -> server, open additional data streams for the transfer (uint16 count)
+	ADD_STREAMS
+	// RETIRE_STREAMS: client -> server, close data streams once they finish their current work unit (uint16 count)
+	RETIRE_STREAMS
+	// TRANSFER_DONE: server -> client, all work units were sent, with the total number of data streams opened
+	TRANSFER_DONE
+	// DELTA_REQUEST: client -> server, the block signatures of the client's existing copy of a file
+	DELTA_REQUEST
+	// DELTA_META: server -> client, the size and md5 of the file, with the blocks of the client's copy to reuse
+	DELTA_META
+	// LIST_REQUEST: client -> server, requests a manifest of every file and directory under a path
+	LIST_REQUEST
+	// MANIFEST: server -> client, a batch of manifest entries. The server closes the stream after the last batch
+	MANIFEST
+)
+
+// Codec: the compression applied to the data of a chunk
+type Codec uint8
+
+const (
+	CODEC_NONE Codec = iota
+	CODEC_GZIP
+	CODEC_ZSTD
+	// CODEC_AUTO: only valid in a request, the server samples the file and picks zstd or none
+	CODEC_AUTO
+)
+
+// AttrMask: the file attributes a client asks to preserve, and that are present in a set of attributes
+type AttrMask uint8
+
+const (
+	// ATTR_MODE: the permission bits, along with setuid, setgid, and sticky
+	ATTR_MODE AttrMask = 1 << iota
+	// ATTR_TIMES: the modification and access times
+	ATTR_TIMES
+	// ATTR_OWNER: the owning user and group, by name with the numeric ids as a fallback
+	ATTR_OWNER
+	// ATTR_XATTRS: extended attributes
+	ATTR_XATTRS
+
+	ATTR_ALL = ATTR_MODE | ATTR_TIMES | ATTR_OWNER | ATTR_XATTRS
+)
+
+// Range: a contiguous byte range within a file
+type Range struct {
+	Offset uint64
+	Length uint64
+}
+
+// FileRequest: the request a client sends to initiate a transfer
+type FileRequest struct {
+	// Streams: the total number of data streams the server should open
+	Streams uint16
+	// Compression: the codec the client asks the server to compress chunks with
+	Compression Codec
+	// Preserve: the attributes of the file the server should send with its metadata
+	Preserve AttrMask
+	// Path: the path of the file on the remote system
+	Path string
+	// Ranges: the byte ranges of the file to send. If empty, the entire file is sent
+	Ranges []Range
+}
+
+// FileMeta: the metadata the server responds with for a requested file
+type FileMeta struct {
+	Size uint64
+	Md5 []byte
+	// Streams: the number of data streams the server granted for the request
+	Streams uint16
+	// MaxStreams: the most data streams the server will open for the request if more are added mid-transfer
+	MaxStreams uint16
+	// Compression: the codec the server chose for the transfer. Chunks that do not compress are still sent uncompressed
+	Compression Codec
+	// Sparse: the file has holes. Only the data in Extents is sent, and everything outside them reads as zeros
+	Sparse bool
+	// Extents: for sparse files, the data extents of the file in order
+	Extents []Range
+	// Attrs: the attributes of the file, if any were requested
+	Attrs *FileAttrs
+}
+
+// FileAttrs: the attributes of a file to apply to the destination once it is transferred
+type FileAttrs struct {
+	// Mask: the attributes that are set. Attributes the server cannot read on its platform are left out
+	Mask AttrMask
+	// Mode: the file mode, as os.FileMode bits
+	Mode uint32
+	// ModTime: the modification time in nanoseconds since the unix epoch
+	ModTime int64
+	// AccessTime: the access time in nanoseconds since the unix epoch
+	AccessTime int64
+	Uid uint32
+	Gid uint32
+	// User: the name of the owning user, empty if the uid has no name on the server
+	User string
+	// Group: the name of the owning group, empty if the gid has no name on the server
+	Group string
+	Xattrs []Xattr
+}
+
+// Xattr: a single extended attribute
+type Xattr struct {
+	Name string
+	Value []byte
+}
+
+// ChunkHeader: written to a data stream before each chunk of file data
+type ChunkHeader struct {
+	// Offset: the offset in the file where the chunk begins
+	Offset uint64
+	// Size: the size of the chunk once decoded
+	Size uint64
+	// EncodedSize: the number of bytes that follow the header on the stream
+	EncodedSize uint64
+	// Codec: the compression applied to the chunk
+	Codec Codec
+}
+
+// BlockSignature: the weak rolling checksum and strong hash of a block of a file
+type BlockSignature struct {
+	Weak uint32
+	Strong [16]byte
+}
+
+// DeltaRequest: the request a client sends to synchronize an existing copy of a file
+type DeltaRequest struct {
+	// Path: the path of the file on the remote system
+	Path string
+	// BlockSize: the size of each signed block in the client's copy
+	BlockSize uint32
+	// Preserve: the attributes of the file the server should send with its response
+	Preserve AttrMask
+	// Blocks: the signature of each full block in the client's copy, in order
+	Blocks []BlockSignature
+}
+
+// BlockCopy: an instruction to copy a range of the client's existing copy into the new file
+type BlockCopy struct {
+	// Offset: the offset in the new file
+	Offset uint64
+	// BasisOffset: the offset in the client's existing copy
+	BasisOffset uint64
+	Length uint64
+}
+
+// DeltaMeta: the server's response to a delta request. Any range of the file not covered by a copy must be transferred
+type DeltaMeta struct {
+	Size uint64
+	Md5 []byte
+	Copies []BlockCopy
+	// Attrs: the attributes of the file, if any were requested
+	Attrs *FileAttrs
+}
+
+// ListRequest: the request a client sends for a manifest of a directory tree
+type ListRequest struct {
+	// Path: the path of the directory on the remote system
+	Path string
+	// Rules: filter rules applied by the server while walking the directory, after the rules of any ignore files in it
+	Rules []string
+}
+
+// ManifestEntry: a single file or directory in a manifest
+type ManifestEntry struct {
+	// Path: the path relative to the listed directory, slash separated
+	Path string
+	Size uint64
+	// ModTime: the modification time in nanoseconds since the unix epoch
+	ModTime int64
+	// Mode: the file mode, as os.FileMode bits
+	Mode uint32
+	// Md5: the md5 of a file, empty for directories
+	Md5 []byte
+}
+
+// MessageReader: reads framed messages from a stream, reusing its buffers between messages
+type MessageReader struct {
+	r io.Reader
+	header []byte
+	payload []byte
+}
+
+
+const MESSAGE_HEADER_LENGTH = 5
+const MAX_MESSAGE_LENGTH = 1024 * 1024 * 16 // 16MB
+const MAX_PATH_LENGTH = 1024 * 4
+const FILE_META_LENGTH = 34 // excluding extents and attributes
+const FILE_ATTRS_LENGTH = 33 // excluding names and extended attributes
+const MAX_XATTR_VALUE_LENGTH = 1024 * 64 // 64KiB
+const RANGE_LENGTH = 16
+const CHUNK_HEADER_LENGTH = 25
+const BLOCK_SIGNATURE_LENGTH = 20
+const BLOCK_COPY_LENGTH = 24
+const MANIFEST_ENTRY_LENGTH = 36 // excluding the path
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+
+//============================================= Rate Limit
+
+
+// NewLimiter
+//	Create a token bucket that allows rate bytes per second. A rate of 0 or less is unlimited.
+func NewLimiter(rate int64) *Limiter {
+	l := &Limiter{ last: time.Now() }
+	l.SetRate(rate)
+
+	return l
+}
+
+// SetRate
+//	Change the rate of the limiter. Callers already waiting keep their current reservation,
+//	but since writes are limited in small slices the new rate applies almost immediately.
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if rate <= 0 {
+		l.rate, l.burst, l.tokens = 0, 0, 0
+		return
+	}
+
+	wasUnlimited := l.rate == 0
+	l.rate = float64(rate)
+	l.burst = l.rate * BURST_DURATION.Seconds()
+	if l.burst < MAX_SLICE_SIZE { l.burst = MAX_SLICE_SIZE }
+	if wasUnlimited || l.tokens > l.burst { l.tokens = l.burst }
+}
+
+// Rate
+//	The current rate in bytes per second, 0 if unlimited.
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int64(l.rate)
+}
+
+// WaitN
+//	Take n bytes from the bucket, blocking until they are available or the context is cancelled.
+//	The bucket can go into debt, so a large n waits for as long as the bytes take at the current rate,
+//	and later callers queue behind it.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 { return nil }
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+	}
+}
+
+// reserve
+//	Take n tokens, returning how long the caller must wait for the bucket to come out of debt.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == 0 { return 0 }
+
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 { return 0 }
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// refill
+//	Add the tokens accumulated since the last refill, up to the burst.
+func (l *Limiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if l.rate == 0 { return }
+
+	l.tokens += elapsed * l.rate
+	if l.tokens > l.burst { l.tokens = l.burst }
+}
+
+// WaitAll
+//	Wait on each limiter in turn for n bytes. Nil limiters are skipped.
+func WaitAll(ctx context.Context, n int, limiters ...*Limiter) error {
+	for _, l := range limiters {
+		if l == nil { continue }
+
+		waitErr := l.WaitN(ctx, n)
+		if waitErr != nil { return waitErr }
+	}
+
+	return nil
+}
+
+// NewWriter
+//	Wrap a writer so every write waits on the limiters.
+//	Writes are split into slices of at most MAX_SLICE_SIZE, so a rate change applies within a slice rather than after a large write.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*Limiter) io.Writer {
+	return &limitedWriter{ ctx: ctx, w: w, limiters: limiters }
+}
+
+// Write
+//	Write p in slices, waiting on the limiters before each. If none of the limiters currently limit, p is written as is.
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if ! anyLimited(lw.limiters) { return lw.w.Write(p) }
+
+	total := 0
+	for len(p) > total {
+		end := total + MAX_SLICE_SIZE
+		if end > len(p) { end = len(p) }
+
+		waitErr := WaitAll(lw.ctx, end - total, lw.limiters...)
+		if waitErr != nil { return total, waitErr }
+
+		nWritten, writeErr := lw.w.Write(p[total:end])
+		total += nWritten
+		if writeErr != nil { return total, writeErr }
+	}
+
+	return total, nil
+}
+
+// anyLimited
+//	Whether any of the limiters has a rate set.
+func anyLimited(limiters []*Limiter) bool {
+	for _, l := range limiters {
+		if l != nil && l.Rate() > 0 { return true }
+	}
+
+	return false
+}
+
+// NewReader
+//	Wrap a reader so every read waits on the limiters for the bytes it returned.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	return &limitedReader{ ctx: ctx, r: r, limiters: limiters }
+}
+
+// Read
+//	Read from the underlying reader, then wait on the limiters for the bytes read.
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > MAX_SLICE_SIZE && anyLimited(lr.limiters) { p = p[:MAX_SLICE_SIZE] }
+
+	nRead, readErr := lr.r.Read(p)
+	if nRead > 0 {
+		waitErr := WaitAll(lr.ctx, nRead, lr.limiters...)
+		if waitErr != nil { return nRead, waitErr }
+	}
+
+	return nRead, readErr
+}
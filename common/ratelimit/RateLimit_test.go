@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+
+// recordingWriter: records the size of every write it receives
+type recordingWriter struct {
+	sizes []int
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.sizes = append(rw.sizes, len(p))
+	return len(p), nil
+}
+
+func near(actual, expected, tolerance time.Duration) bool {
+	return actual >= expected - tolerance && actual <= expected + tolerance
+}
+
+
+func TestSetRate(t *testing.T) {
+	tests := []struct {
+		name string
+		rate int64
+		expectedRate int64
+		burst float64
+	}{
+		{ "unlimited", 0, 0, 0 },
+		{ "negative is unlimited", -5, 0, 0 },
+		{ "burst is a tenth of a second", 10 * 1024 * 1024, 10 * 1024 * 1024, 1024 * 1024 },
+		{ "burst is at least a slice", 1024, 1024, MAX_SLICE_SIZE },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := NewLimiter(test.rate)
+			if l.Rate() != test.expectedRate { t.Errorf("expected rate %d, got %d", test.expectedRate, l.Rate()) }
+			if math.Abs(l.burst - test.burst) > 1 { t.Errorf("expected burst %.0f, got %.0f", test.burst, l.burst) }
+			if l.tokens != l.burst { t.Errorf("expected a new bucket to start full at %.0f, got %.0f", l.burst, l.tokens) }
+		})
+	}
+}
+
+func TestSetRateKeepsTokens(t *testing.T) {
+	l := NewLimiter(10 * 1024 * 1024)
+	l.reserve(int(l.burst))
+
+	l.SetRate(20 * 1024 * 1024)
+	if l.tokens > 1024 { t.Errorf("expected raising the rate to keep the drained bucket, got %.0f tokens", l.tokens) }
+
+	l = NewLimiter(10 * 1024 * 1024)
+	l.SetRate(MAX_SLICE_SIZE)
+	if l.tokens != l.burst { t.Errorf("expected lowering the rate to cap tokens at the new burst %.0f, got %.0f", l.burst, l.tokens) }
+
+	l.SetRate(0)
+	l.SetRate(1024 * 1024)
+	if l.tokens != l.burst { t.Errorf("expected a limit set after unlimited to start full, got %.0f", l.tokens) }
+}
+
+func TestRefill(t *testing.T) {
+	tests := []struct {
+		name string
+		tokens float64
+		elapsed time.Duration
+		expected float64
+	}{
+		{ "accumulates at the rate", 0, 50 * time.Millisecond, 50000 },
+		{ "pays off debt", -200000, 100 * time.Millisecond, -100000 },
+		{ "capped at the burst", 0, time.Hour, 100000 },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := NewLimiter(1000000)
+			start := time.Now()
+			l.tokens, l.last = test.tokens, start
+
+			l.refill(start.Add(test.elapsed))
+			if math.Abs(l.tokens - test.expected) > 1 { t.Errorf("expected %.0f tokens, got %.0f", test.expected, l.tokens) }
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	l := NewLimiter(1000000)
+	if delay := l.reserve(int(l.burst)); delay != 0 { t.Errorf("expected the burst to be free, got a delay of %v", delay) }
+	if delay := l.reserve(500000); ! near(delay, 500 * time.Millisecond, 10 * time.Millisecond) { t.Errorf("expected a delay near 500ms, got %v", delay) }
+	if delay := l.reserve(250000); ! near(delay, 750 * time.Millisecond, 10 * time.Millisecond) { t.Errorf("expected later callers to queue behind, got %v", delay) }
+
+	unlimited := NewLimiter(0)
+	if delay := unlimited.reserve(1 << 30); delay != 0 { t.Errorf("expected no delay when unlimited, got %v", delay) }
+}
+
+func TestWaitNCanceled(t *testing.T) {
+	l := NewLimiter(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	waitErr := l.WaitN(ctx, 1000000)
+	if waitErr != context.Canceled { t.Errorf("expected %v, got %v", context.Canceled, waitErr) }
+	if waitErr = WaitAll(ctx, 10, nil, NewLimiter(0)); waitErr != nil { t.Errorf("expected nil and unlimited limiters to never wait, got %v", waitErr) }
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		limiters []*Limiter
+		size int
+		writes []int
+	}{
+		{ "unlimited writes through", []*Limiter{ NewLimiter(0), nil }, 3 * MAX_SLICE_SIZE, []int{ 3 * MAX_SLICE_SIZE } },
+		{ "limited writes in slices", []*Limiter{ NewLimiter(0), NewLimiter(1 << 30) }, 2 * MAX_SLICE_SIZE + 10, []int{ MAX_SLICE_SIZE, MAX_SLICE_SIZE, 10 } },
+		{ "small writes stay whole", []*Limiter{ NewLimiter(1 << 30) }, 100, []int{ 100 } },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &recordingWriter{}
+			nWritten, writeErr := NewWriter(context.Background(), recorder, test.limiters...).Write(make([]byte, test.size))
+			if writeErr != nil || nWritten != test.size { t.Fatalf("expected %d bytes written, got %d, %v", test.size, nWritten, writeErr) }
+
+			if len(recorder.sizes) != len(test.writes) { t.Fatalf("expected writes %v, got %v", test.writes, recorder.sizes) }
+			for idx := range test.writes {
+				if recorder.sizes[idx] != test.writes[idx] { t.Errorf("expected writes %v, got %v", test.writes, recorder.sizes) }
+			}
+		})
+	}
+}
+
+func TestWriterRate(t *testing.T) {
+	const rate = 1024 * 1024
+	l := NewLimiter(rate)
+	burst := int(l.burst)
+
+	start := time.Now()
+	NewWriter(context.Background(), io.Discard, l).Write(make([]byte, burst + rate / 4))
+	if elapsed := time.Since(start); elapsed < 200 * time.Millisecond || elapsed > time.Second { t.Errorf("expected writing past the burst to take about 250ms, took %v", elapsed) }
+}
+
+func TestReader(t *testing.T) {
+	data := make([]byte, 3 * MAX_SLICE_SIZE)
+	reader := NewReader(context.Background(), bytes.NewReader(data), NewLimiter(1 << 30))
+
+	nRead, _ := reader.Read(make([]byte, len(data)))
+	if nRead != MAX_SLICE_SIZE { t.Errorf("expected a limited read to return at most a slice, got %d", nRead) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	limited := NewReader(ctx, bytes.NewReader(data), NewLimiter(1000))
+	if _, burstErr := limited.Read(make([]byte, MAX_SLICE_SIZE)); burstErr != nil { t.Errorf("expected a read within the burst to not wait, got %v", burstErr) }
+	if _, readErr := limited.Read(make([]byte, MAX_SLICE_SIZE)); readErr != context.Canceled { t.Errorf("expected %v once the bucket is in debt, got %v", context.Canceled, readErr) }
+}
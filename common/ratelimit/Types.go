@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+
+// Limiter: a token bucket limiting the rate of bytes across everything that shares it. A rate of 0 is unlimited
+type Limiter struct {
+	mu sync.Mutex
+	rate float64
+	burst float64
+	tokens float64
+	last time.Time
+}
+
+// limitedWriter: a writer that waits on every limiter before each slice is written
+type limitedWriter struct {
+	ctx context.Context
+	w io.Writer
+	limiters []*Limiter
+}
+
+// limitedReader: a reader that waits on every limiter for the bytes returned by each read
+type limitedReader struct {
+	ctx context.Context
+	r io.Reader
+	limiters []*Limiter
+}
+
+
+const BURST_DURATION = 100 * time.Millisecond
+const MAX_SLICE_SIZE = 1024 * 64 // 64KiB
@@ -0,0 +1,135 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+
+//============================================= Rotate
+
+
+// NewWriter
+//	Open the file at path for appending, creating it if needed.
+//	Once a write would grow the file past maxSize bytes, the file is renamed with the utc time it was rotated at, like audit.log.20261019T120000.000000000Z, and a new one is started.
+//	Only the newest maxFiles rotated files are kept. If maxFiles is 0, every rotated file is kept.
+func NewWriter(path string, maxSize int64, maxFiles int) (*Writer, error) {
+	if maxSize <= 0 { return nil, ErrInvalidMaxSize }
+	if maxFiles < 0 { return nil, ErrInvalidMaxFiles }
+
+	w := &Writer{ path: path, maxSize: maxSize, maxFiles: maxFiles }
+	openErr := w.open()
+	if openErr != nil { return nil, openErr }
+
+	return w, nil
+}
+
+// Write
+//	Append p to the file, rotating first if it would grow the file past the max size.
+//	A single write is never split across files, so a write larger than the max size gets a file of its own.
+//	If rotating fails but a file is still open, p is written anyway so nothing is lost, and the rotate error is returned.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil { return 0, ErrClosed }
+
+	var rotateErr error
+	if w.size > 0 && w.size + int64(len(p)) > w.maxSize {
+		rotateErr = w.rotate()
+		if w.file == nil { return 0, rotateErr }
+	}
+
+	n, writeErr := w.file.Write(p)
+	w.size += int64(n)
+	if writeErr != nil { return n, writeErr }
+
+	return n, rotateErr
+}
+
+// Sync
+//	Commit the contents of the current file to stable storage.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil { return ErrClosed }
+	return w.file.Sync()
+}
+
+// Close
+//	Close the current file. Writes after Close return ErrClosed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil { return nil }
+
+	closeErr := w.file.Close()
+	w.file = nil
+	return closeErr
+}
+
+// open
+//	Open the file for appending, picking up its current size so a restarted process rotates at the same point.
+func (w *Writer) open() error {
+	file, openErr := os.OpenFile(w.path, os.O_CREATE | os.O_WRONLY | os.O_APPEND, FILE_MODE)
+	if openErr != nil { return openErr }
+
+	info, statErr := file.Stat()
+	if statErr != nil {
+		file.Close()
+		return statErr
+	}
+
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// rotate
+//	Sync and close the current file, rename it with the time it was rotated at, then start a new file and remove the oldest rotated files.
+//	If the rename fails, the current file is opened again and keeps growing.
+func (w *Writer) rotate() error {
+	syncErr := w.file.Sync()
+	if syncErr != nil { return syncErr }
+
+	closeErr := w.file.Close()
+	w.file = nil
+	renameErr := os.Rename(w.path, w.path + "." + time.Now().UTC().Format(ROTATED_LAYOUT))
+
+	openErr := w.open()
+	if openErr != nil { return openErr }
+	if closeErr != nil { return closeErr }
+	if renameErr != nil { return renameErr }
+
+	return w.prune()
+}
+
+// prune
+//	Remove the oldest rotated files beyond max files. Files next to the log that do not carry a rotation time are left alone.
+func (w *Writer) prune() error {
+	if w.maxFiles == 0 { return nil }
+
+	matches, globErr := filepath.Glob(w.path + ".*")
+	if globErr != nil { return globErr }
+
+	var rotated []string
+	for _, match := range matches {
+		_, parseErr := time.Parse(ROTATED_LAYOUT, strings.TrimPrefix(match, w.path + "."))
+		if parseErr == nil { rotated = append(rotated, match) }
+	}
+
+	if len(rotated) <= w.maxFiles { return nil }
+
+	sort.Strings(rotated)
+	for _, old := range rotated[:len(rotated) - w.maxFiles] {
+		removeErr := os.Remove(old)
+		if removeErr != nil && ! os.IsNotExist(removeErr) { return removeErr }
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+
+// rotated
+//	The contents of every rotated file next to path, oldest first.
+func rotated(t *testing.T, path string) []string {
+	matches, globErr := filepath.Glob(path + ".*")
+	if globErr != nil { t.Fatal(globErr) }
+
+	sort.Strings(matches)
+	var contents []string
+	for _, match := range matches {
+		data, readErr := os.ReadFile(match)
+		if readErr != nil { t.Fatal(readErr) }
+		contents = append(contents, string(data))
+	}
+
+	return contents
+}
+
+func current(t *testing.T, path string) string {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil { t.Fatal(readErr) }
+
+	return string(data)
+}
+
+
+func TestNewWriterInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	tests := []struct {
+		name string
+		maxSize int64
+		maxFiles int
+		err error
+	}{
+		{ "zero max size", 0, 1, ErrInvalidMaxSize },
+		{ "negative max size", -1, 1, ErrInvalidMaxSize },
+		{ "negative max files", 10, -1, ErrInvalidMaxFiles },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, newErr := NewWriter(path, test.maxSize, test.maxFiles)
+			if newErr != test.err { t.Errorf("expected %v, got %v", test.err, newErr) }
+		})
+	}
+
+	_, missingDirErr := NewWriter(filepath.Join(t.TempDir(), "missing", "audit.log"), 10, 0)
+	if ! os.IsNotExist(missingDirErr) { t.Errorf("expected a missing directory to fail, got %v", missingDirErr) }
+}
+
+func TestRotateBySize(t *testing.T) {
+	tests := []struct {
+		name string
+		existing string
+		maxSize int64
+		writes []string
+		current string
+		rotated []string
+	}{
+		{ "under the max", "", 10, []string{ "abc", "def" }, "abcdef", nil },
+		{ "exactly the max", "", 6, []string{ "abc", "def" }, "abcdef", nil },
+		{ "past the max", "", 5, []string{ "abc", "def" }, "def", []string{ "abc" } },
+		{ "writes are never split", "", 4, []string{ "abc", "defgh", "i" }, "i", []string{ "abc", "defgh" } },
+		{ "oversized first write gets its own file", "", 2, []string{ "abcdef", "g" }, "g", []string{ "abcdef" } },
+		{ "existing size counts toward the max", "12345678", 10, []string{ "abc" }, "abc", []string{ "12345678" } },
+		{ "appends to an existing file", "12", 10, []string{ "abc" }, "12abc", nil },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			if test.existing != "" { os.WriteFile(path, []byte(test.existing), FILE_MODE) }
+
+			w, newErr := NewWriter(path, test.maxSize, 0)
+			if newErr != nil { t.Fatal(newErr) }
+			defer w.Close()
+
+			for _, write := range test.writes {
+				n, writeErr := w.Write([]byte(write))
+				if writeErr != nil || n != len(write) { t.Fatalf("expected %d bytes written, got %d, %v", len(write), n, writeErr) }
+			}
+
+			if contents := current(t, path); contents != test.current { t.Errorf("expected current file %q, got %q", test.current, contents) }
+			if contents := rotated(t, path); ! reflect.DeepEqual(contents, test.rotated) { t.Errorf("expected rotated files %q, got %q", test.rotated, contents) }
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name string
+		maxFiles int
+		rotated []string
+	}{
+		{ "keeps every file", 0, []string{ "0", "1", "2", "3" } },
+		{ "keeps the newest", 2, []string{ "2", "3" } },
+		{ "keeps one", 1, []string{ "3" } },
+		{ "fewer than max", 10, []string{ "0", "1", "2", "3" } },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "audit.log")
+			unrelated := filepath.Join(dir, "audit.log.bak")
+			os.WriteFile(unrelated, []byte("keep"), 0644)
+
+			w, newErr := NewWriter(path, 1, test.maxFiles)
+			if newErr != nil { t.Fatal(newErr) }
+			defer w.Close()
+
+			for _, write := range []string{ "0", "1", "2", "3", "4" } {
+				_, writeErr := w.Write([]byte(write))
+				if writeErr != nil { t.Fatal(writeErr) }
+			}
+
+			if contents := current(t, path); contents != "4" { t.Errorf("expected current file %q, got %q", "4", contents) }
+
+			os.Remove(unrelated)
+			if contents := rotated(t, path); ! reflect.DeepEqual(contents, test.rotated) { t.Errorf("expected rotated files %q, got %q", test.rotated, contents) }
+		})
+	}
+}
+
+func TestPruneLeavesOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	others := []string{ path + ".bak", path + ".20260101", filepath.Join(dir, "other.log.20260101T000000.000000000Z") }
+	for _, other := range others { os.WriteFile(other, nil, 0644) }
+
+	w, newErr := NewWriter(path, 1, 1)
+	if newErr != nil { t.Fatal(newErr) }
+	defer w.Close()
+
+	for idx := 0; idx < 3; idx++ { w.Write([]byte("x")) }
+
+	for _, other := range others {
+		if _, statErr := os.Stat(other); statErr != nil { t.Errorf("expected %s to be left alone, got %v", filepath.Base(other), statErr) }
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	w, newErr := NewWriter(path, 1, 0)
+	if newErr != nil { t.Fatal(newErr) }
+	defer w.Close()
+
+	w.Write([]byte("a"))
+	w.Write([]byte("b"))
+
+	matches, _ := filepath.Glob(path + "*")
+	for _, match := range matches {
+		info, statErr := os.Stat(match)
+		if statErr != nil { t.Fatal(statErr) }
+		if info.Mode().Perm() != FILE_MODE { t.Errorf("expected %s to have mode %o, got %o", filepath.Base(match), FILE_MODE, info.Mode().Perm()) }
+	}
+}
+
+func TestClosed(t *testing.T) {
+	w, newErr := NewWriter(filepath.Join(t.TempDir(), "audit.log"), 10, 0)
+	if newErr != nil { t.Fatal(newErr) }
+
+	if syncErr := w.Sync(); syncErr != nil { t.Errorf("expected sync to succeed, got %v", syncErr) }
+	if closeErr := w.Close(); closeErr != nil { t.Fatal(closeErr) }
+	if closeErr := w.Close(); closeErr != nil { t.Errorf("expected a second close to succeed, got %v", closeErr) }
+
+	if _, writeErr := w.Write([]byte("a")); writeErr != ErrClosed { t.Errorf("expected %v, got %v", ErrClosed, writeErr) }
+	if syncErr := w.Sync(); syncErr != ErrClosed { t.Errorf("expected %v, got %v", ErrClosed, syncErr) }
+}
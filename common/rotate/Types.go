@@ -0,0 +1,27 @@
+package rotate
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+
+// Writer: an append only file that is rotated once it grows past a maximum size. Safe for concurrent use
+type Writer struct {
+	mu sync.Mutex
+	path string
+	maxSize int64
+	maxFiles int
+	file *os.File
+	size int64
+}
+
+
+const FILE_MODE = 0600
+const ROTATED_LAYOUT = "20060102T150405.000000000Z" // sorts in the order files were rotated
+
+
+var ErrInvalidMaxSize = errors.New("max size must be greater than 0")
+var ErrInvalidMaxFiles = errors.New("max files cannot be negative")
+var ErrClosed = errors.New("writer closed")
@@ -0,0 +1,87 @@
+package tuning
+
+import (
+	"github.com/quic-go/quic-go"
+)
+
+
+//============================================= Tuning
+
+
+// Preset
+//	The tuning for a named preset.
+//	default keeps the defaults of the client and server. wan is for high bandwidth, high latency links, where the bandwidth delay product is far beyond the default flow control windows:
+//	windows start large and may grow to 64MiB per stream and 256MiB per connection, and timeouts are longer to ride out loss and long round trips.
+func Preset(name string) (Options, error) {
+	switch name {
+		case "", DEFAULT_PRESET:
+			return Options{}, nil
+		case WAN_PRESET:
+			return HighBandwidthWAN(), nil
+		default:
+			return Options{}, ErrUnknownPreset
+	}
+}
+
+// HighBandwidthWAN
+//	The tuning for high bandwidth, high latency links.
+func HighBandwidthWAN() Options {
+	return Options{
+		KeepAlivePeriod: WAN_KEEP_ALIVE_PERIOD,
+		MaxIdleTimeout: WAN_MAX_IDLE_TIMEOUT,
+		HandshakeTimeout: WAN_HANDSHAKE_TIMEOUT,
+		InitialStreamReceiveWindow: WAN_INITIAL_STREAM_RECEIVE_WINDOW,
+		MaxStreamReceiveWindow: WAN_MAX_STREAM_RECEIVE_WINDOW,
+		InitialConnectionReceiveWindow: WAN_INITIAL_CONNECTION_RECEIVE_WINDOW,
+		MaxConnectionReceiveWindow: WAN_MAX_CONNECTION_RECEIVE_WINDOW,
+	}
+}
+
+// Merge
+//	Layer options over these, with every value set in over taking precedence. Used to adjust a preset.
+func (opts Options) Merge(over Options) Options {
+	if over.KeepAlivePeriod > 0 { opts.KeepAlivePeriod = over.KeepAlivePeriod }
+	if over.MaxIdleTimeout > 0 { opts.MaxIdleTimeout = over.MaxIdleTimeout }
+	if over.InitialStreamReceiveWindow > 0 { opts.InitialStreamReceiveWindow = over.InitialStreamReceiveWindow }
+	if over.MaxStreamReceiveWindow > 0 { opts.MaxStreamReceiveWindow = over.MaxStreamReceiveWindow }
+	if over.InitialConnectionReceiveWindow > 0 { opts.InitialConnectionReceiveWindow = over.InitialConnectionReceiveWindow }
+	if over.MaxConnectionReceiveWindow > 0 { opts.MaxConnectionReceiveWindow = over.MaxConnectionReceiveWindow }
+	if over.MaxIncomingUniStreams > 0 { opts.MaxIncomingUniStreams = over.MaxIncomingUniStreams }
+	if over.HandshakeTimeout > 0 { opts.HandshakeTimeout = over.HandshakeTimeout }
+
+	return opts
+}
+
+// Apply
+//	Set the tuning on a quic config. Zero values leave the config as is, so any defaults set on it beforehand are kept.
+func (opts *Options) Apply(cfg *quic.Config) {
+	if opts.KeepAlivePeriod > 0 { cfg.KeepAlivePeriod = opts.KeepAlivePeriod }
+	if opts.MaxIdleTimeout > 0 { cfg.MaxIdleTimeout = opts.MaxIdleTimeout }
+	if opts.InitialStreamReceiveWindow > 0 { cfg.InitialStreamReceiveWindow = opts.InitialStreamReceiveWindow }
+	if opts.MaxStreamReceiveWindow > 0 { cfg.MaxStreamReceiveWindow = opts.MaxStreamReceiveWindow }
+	if opts.InitialConnectionReceiveWindow > 0 { cfg.InitialConnectionReceiveWindow = opts.InitialConnectionReceiveWindow }
+	if opts.MaxConnectionReceiveWindow > 0 { cfg.MaxConnectionReceiveWindow = opts.MaxConnectionReceiveWindow }
+	if opts.MaxIncomingUniStreams > 0 { cfg.MaxIncomingUniStreams = opts.MaxIncomingUniStreams }
+	if opts.HandshakeTimeout > 0 { cfg.HandshakeIdleTimeout = opts.HandshakeTimeout }
+}
+
+// Validate
+//	Check that no value is negative, and that the windows are consistent where both sides of a comparison are set.
+//	Initial windows cannot exceed their max, and a single stream cannot be allowed more than the whole connection.
+func (opts *Options) Validate() error {
+	if opts.KeepAlivePeriod < 0 || opts.MaxIdleTimeout < 0 || opts.HandshakeTimeout < 0 || opts.MaxIncomingUniStreams < 0 { return ErrNegativeValue }
+
+	if opts.InitialStreamReceiveWindow > 0 && opts.MaxStreamReceiveWindow > 0 && opts.InitialStreamReceiveWindow > opts.MaxStreamReceiveWindow {
+		return ErrInvalidStreamWindow
+	}
+
+	if opts.InitialConnectionReceiveWindow > 0 && opts.MaxConnectionReceiveWindow > 0 && opts.InitialConnectionReceiveWindow > opts.MaxConnectionReceiveWindow {
+		return ErrInvalidConnectionWindow
+	}
+
+	if opts.MaxStreamReceiveWindow > 0 && opts.MaxConnectionReceiveWindow > 0 && opts.MaxStreamReceiveWindow > opts.MaxConnectionReceiveWindow {
+		return ErrStreamWindowExceedsConnection
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package tuning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+
+func TestPreset(t *testing.T) {
+	tests := []struct {
+		name string
+		preset string
+		expected Options
+		err error
+	}{
+		{ "empty is default", "", Options{}, nil },
+		{ "default", DEFAULT_PRESET, Options{}, nil },
+		{ "wan", WAN_PRESET, HighBandwidthWAN(), nil },
+		{ "names are case sensitive", "WAN", Options{}, ErrUnknownPreset },
+		{ "unknown", "lan", Options{}, ErrUnknownPreset },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, presetErr := Preset(test.preset)
+			if presetErr != test.err { t.Fatalf("expected %v, got %v", test.err, presetErr) }
+			if opts != test.expected { t.Errorf("expected %+v, got %+v", test.expected, opts) }
+			if validateErr := opts.Validate(); validateErr != nil { t.Errorf("expected the preset to be valid, got %v", validateErr) }
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	wan := HighBandwidthWAN()
+	tests := []struct {
+		name string
+		base Options
+		over Options
+		expected func(opts *Options)
+		err error
+	}{
+		{ "nothing set keeps the preset", wan, Options{}, func(opts *Options) {}, nil },
+		{ "set values override the preset", wan, Options{ MaxIdleTimeout: 5 * time.Minute, MaxIncomingUniStreams: 500 }, func(opts *Options) {
+			opts.MaxIdleTimeout = 5 * time.Minute
+			opts.MaxIncomingUniStreams = 500
+		}, nil },
+		{ "negative values do not override", wan, Options{ KeepAlivePeriod: -time.Second }, func(opts *Options) {}, nil },
+		{ "over the default preset", Options{}, Options{ HandshakeTimeout: time.Second }, func(opts *Options) { opts.HandshakeTimeout = time.Second }, nil },
+		{ "override conflicting with the preset", wan, Options{ MaxConnectionReceiveWindow: 32 * 1024 * 1024 }, func(opts *Options) {
+			opts.MaxConnectionReceiveWindow = 32 * 1024 * 1024
+		}, ErrStreamWindowExceedsConnection },
+		{ "initial window past the preset max", wan, Options{ InitialStreamReceiveWindow: 128 * 1024 * 1024 }, func(opts *Options) {
+			opts.InitialStreamReceiveWindow = 128 * 1024 * 1024
+		}, ErrInvalidStreamWindow },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := test.base.Merge(test.over)
+
+			expected := test.base
+			test.expected(&expected)
+			if merged != expected { t.Errorf("expected %+v, got %+v", expected, merged) }
+			if validateErr := merged.Validate(); validateErr != test.err { t.Errorf("expected %v, got %v", test.err, validateErr) }
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		err error
+	}{
+		{ "empty", Options{}, nil },
+		{ "negative duration", Options{ HandshakeTimeout: -1 }, ErrNegativeValue },
+		{ "negative streams", Options{ MaxIncomingUniStreams: -1 }, ErrNegativeValue },
+		{ "initial stream window only", Options{ InitialStreamReceiveWindow: 1 << 30 }, nil },
+		{ "initial stream window equal to max", Options{ InitialStreamReceiveWindow: 1 << 20, MaxStreamReceiveWindow: 1 << 20 }, nil },
+		{ "initial stream window past max", Options{ InitialStreamReceiveWindow: 2 << 20, MaxStreamReceiveWindow: 1 << 20 }, ErrInvalidStreamWindow },
+		{ "initial connection window past max", Options{ InitialConnectionReceiveWindow: 2 << 20, MaxConnectionReceiveWindow: 1 << 20 }, ErrInvalidConnectionWindow },
+		{ "stream window past connection", Options{ MaxStreamReceiveWindow: 2 << 20, MaxConnectionReceiveWindow: 1 << 20 }, ErrStreamWindowExceedsConnection },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if validateErr := test.opts.Validate(); validateErr != test.err { t.Errorf("expected %v, got %v", test.err, validateErr) }
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	cfg := &quic.Config{ KeepAlivePeriod: 3 * time.Second, MaxIncomingUniStreams: 100 }
+
+	wan := HighBandwidthWAN()
+	wan.Apply(cfg)
+
+	expected := quic.Config{
+		KeepAlivePeriod: WAN_KEEP_ALIVE_PERIOD,
+		MaxIdleTimeout: WAN_MAX_IDLE_TIMEOUT,
+		HandshakeIdleTimeout: WAN_HANDSHAKE_TIMEOUT,
+		InitialStreamReceiveWindow: WAN_INITIAL_STREAM_RECEIVE_WINDOW,
+		MaxStreamReceiveWindow: WAN_MAX_STREAM_RECEIVE_WINDOW,
+		InitialConnectionReceiveWindow: WAN_INITIAL_CONNECTION_RECEIVE_WINDOW,
+		MaxConnectionReceiveWindow: WAN_MAX_CONNECTION_RECEIVE_WINDOW,
+		MaxIncomingUniStreams: 100,
+	}
+
+	if cfg.KeepAlivePeriod != expected.KeepAlivePeriod ||
+		cfg.MaxIdleTimeout != expected.MaxIdleTimeout ||
+		cfg.HandshakeIdleTimeout != expected.HandshakeIdleTimeout ||
+		cfg.InitialStreamReceiveWindow != expected.InitialStreamReceiveWindow ||
+		cfg.MaxStreamReceiveWindow != expected.MaxStreamReceiveWindow ||
+		cfg.InitialConnectionReceiveWindow != expected.InitialConnectionReceiveWindow ||
+		cfg.MaxConnectionReceiveWindow != expected.MaxConnectionReceiveWindow ||
+		cfg.MaxIncomingUniStreams != expected.MaxIncomingUniStreams {
+		t.Errorf("expected the wan preset over the existing config, got %+v", cfg)
+	}
+
+	defaults := Options{}
+	before := *cfg
+	defaults.Apply(cfg)
+	if cfg.KeepAlivePeriod != before.KeepAlivePeriod || cfg.MaxConnectionReceiveWindow != before.MaxConnectionReceiveWindow {
+		t.Errorf("expected the default preset to leave the config as is, got %+v", cfg)
+	}
+}
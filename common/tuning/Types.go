@@ -0,0 +1,46 @@
+package tuning
+
+import (
+	"errors"
+	"time"
+)
+
+
+// Options: quic transport tuning shared by the client and server. Zero values keep the defaults
+type Options struct {
+	// KeepAlivePeriod: how often keep alive packets are sent on an idle connection
+	KeepAlivePeriod time.Duration
+	// MaxIdleTimeout: how long a connection may go without receiving anything before it is closed
+	MaxIdleTimeout time.Duration
+	// InitialStreamReceiveWindow: the flow control window, in bytes, each stream starts with
+	InitialStreamReceiveWindow uint64
+	// MaxStreamReceiveWindow: the largest the flow control window of a stream may grow to, in bytes
+	MaxStreamReceiveWindow uint64
+	// InitialConnectionReceiveWindow: the flow control window, in bytes, the connection starts with across all streams
+	InitialConnectionReceiveWindow uint64
+	// MaxConnectionReceiveWindow: the largest the flow control window of the connection may grow to, in bytes
+	MaxConnectionReceiveWindow uint64
+	// MaxIncomingUniStreams: the most unidirectional streams the peer may have open at once
+	MaxIncomingUniStreams int64
+	// HandshakeTimeout: how long the handshake may go without progress before the connection attempt fails
+	HandshakeTimeout time.Duration
+}
+
+
+const DEFAULT_PRESET = "default"
+const WAN_PRESET = "wan"
+
+const WAN_KEEP_ALIVE_PERIOD = 10 * time.Second
+const WAN_MAX_IDLE_TIMEOUT = 60 * time.Second
+const WAN_HANDSHAKE_TIMEOUT = 10 * time.Second
+const WAN_INITIAL_STREAM_RECEIVE_WINDOW = 1024 * 1024 * 4 // 4MiB
+const WAN_MAX_STREAM_RECEIVE_WINDOW = 1024 * 1024 * 64 // 64MiB
+const WAN_INITIAL_CONNECTION_RECEIVE_WINDOW = 1024 * 1024 * 8 // 8MiB
+const WAN_MAX_CONNECTION_RECEIVE_WINDOW = 1024 * 1024 * 256 // 256MiB
+
+
+var ErrInvalidStreamWindow = errors.New("initial stream receive window exceeds the max stream receive window")
+var ErrInvalidConnectionWindow = errors.New("initial connection receive window exceeds the max connection receive window")
+var ErrStreamWindowExceedsConnection = errors.New("max stream receive window exceeds the max connection receive window")
+var ErrNegativeValue = errors.New("tuning values cannot be negative")
+var ErrUnknownPreset = errors.New("unknown tuning preset, expected default or wan")
@@ -0,0 +1,191 @@
+package srv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+)
+
+
+//============================================= Server Admin API
+
+
+// AdminHandler
+//	Serve the admin api, a small JSON api for operators to inspect and manage the running server:
+//		GET  /info                   build info, state, and counts of connections and transfers
+//		GET  /connections            open connections
+//		GET  /transfers              transfers in progress, with the bytes sent so far
+//		POST /transfers/{id}/cancel  cancel a transfer
+//		GET  /rates                  the rate limits in effect and outside of scheduled windows, in bytes per second
+//		PUT  /rates                  replace the rate limits that apply outside of scheduled windows
+//		POST /reload                 reload the configuration, see AdminOpts
+//	Requests are not authenticated, so the handler should only be served on a unix socket or a listener only operators can reach.
+func (srv *QuicServer) AdminHandler(opts *AdminOpts) http.Handler {
+	if opts == nil { opts = &AdminOpts{} }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ADMIN_INFO_PATH, allowMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, srv.Info())
+	}))
+
+	mux.HandleFunc(ADMIN_CONNECTIONS_PATH, allowMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, srv.Connections())
+	}))
+
+	mux.HandleFunc(ADMIN_TRANSFERS_PATH, allowMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, srv.Transfers())
+	}))
+
+	mux.HandleFunc(ADMIN_TRANSFERS_PATH + "/", allowMethod(http.MethodPost, srv.handleCancelTransfer))
+	mux.HandleFunc(ADMIN_RATES_PATH, srv.handleRates)
+	mux.HandleFunc(ADMIN_RELOAD_PATH, allowMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		if opts.Reload == nil {
+			writeError(w, http.StatusNotImplemented, ErrReloadUnsupported)
+			return
+		}
+
+		reloadErr := opts.Reload()
+		if reloadErr != nil {
+			srv.logger.Warn("config reload failed", logger.Err(reloadErr))
+			writeError(w, http.StatusUnprocessableEntity, reloadErr)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return mux
+}
+
+// Info
+//	The build info and state of the server.
+func (srv *QuicServer) Info() ServerInfo {
+	srv.mu.Lock()
+	state := srv.state
+	connections := len(srv.conns)
+	transfers := len(srv.transfers)
+	srv.mu.Unlock()
+
+	return ServerInfo{
+		Build: ReadBuildInfo(),
+		State: state.String(),
+		Started: srv.started,
+		Connections: connections,
+		Transfers: transfers,
+		Rates: srv.RateStatus(),
+	}
+}
+
+// ReadBuildInfo
+//	The module, version, and vcs revision of the running binary, as embedded by the go toolchain.
+//	Fields the toolchain did not record, like the revision for builds outside of a repository, are left empty.
+func ReadBuildInfo() BuildInfo {
+	build := BuildInfo{ GoVersion: runtime.Version() }
+
+	info, ok := debug.ReadBuildInfo()
+	if ! ok { return build }
+
+	build.Module = info.Main.Path
+	build.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+			case "vcs.revision":
+				build.Revision = setting.Value
+			case "vcs.time":
+				build.RevisionTime = setting.Value
+			case "vcs.modified":
+				build.Modified = setting.Value == "true"
+		}
+	}
+
+	return build
+}
+
+// handleCancelTransfer
+//	Cancel the transfer at /transfers/{id}/cancel.
+func (srv *QuicServer) handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	idPart, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, ADMIN_TRANSFERS_PATH + "/"), ADMIN_CANCEL_SUFFIX)
+	if ! ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, parseErr := strconv.ParseUint(idPart, 10, 64)
+	if parseErr != nil {
+		writeError(w, http.StatusBadRequest, parseErr)
+		return
+	}
+
+	cancelErr := srv.CancelTransfer(id)
+	if errors.Is(cancelErr, ErrTransferNotFound) {
+		writeError(w, http.StatusNotFound, cancelErr)
+		return
+	}
+
+	srv.logger.Info("transfer canceled by admin", logger.F(logger.TRANSFER_ID_KEY, id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRates
+//	Report the rate limits, or replace the limits that apply outside of scheduled windows with the limits in the request body.
+func (srv *QuicServer) handleRates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, srv.RateStatus())
+		case http.MethodPut:
+			var limits RateLimits
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+
+			decodeErr := decoder.Decode(&limits)
+			if decodeErr != nil {
+				writeError(w, http.StatusBadRequest, decodeErr)
+				return
+			}
+
+			if limits.Global < 0 || limits.PerConnection < 0 || limits.PerClient < 0 {
+				writeError(w, http.StatusBadRequest, ErrNegativeRate)
+				return
+			}
+
+			srv.SetRateLimits(limits)
+			writeJSON(w, http.StatusOK, srv.RateStatus())
+		default:
+			w.Header().Set("Allow", http.MethodGet + ", " + http.MethodPut)
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+// allowMethod
+//	Wrap a handler so requests with any other method are refused.
+func allowMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// writeJSON
+//	Write a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError
+//	Write an error response, as {"error": "..."}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, AdminError{ Error: err.Error() })
+}
@@ -0,0 +1,23 @@
+package srv
+
+import (
+	"github.com/sirgallo/quicfiletransfer/common/attrs"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Server Attrs
+
+
+// readFileAttrs
+//	Read the attributes a client asked to preserve, to send with the metadata for the file. If none were requested, nil is returned.
+//	Attributes that cannot be read are left out rather than failing the transfer.
+func readFileAttrs(path string, preserve protocol.AttrMask, transferLogger logger.Logger) *protocol.FileAttrs {
+	if preserve == 0 { return nil }
+
+	fileAttrs, readErr := attrs.Read(path, preserve)
+	if readErr != nil { transferLogger.Warn("unable to read some file attributes", logger.Err(readErr)) }
+
+	return fileAttrs
+}
@@ -0,0 +1,69 @@
+package srv
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Server Audit Log
+
+
+// newAuditRecord
+//	Start the audit record for a request from the client on the connection. The handler for the request fills in what it learns as it goes.
+func newAuditRecord(conn quic.Connection, connID uint64, client string, operation string) *AuditRecord {
+	return &AuditRecord{
+		Time: time.Now(),
+		Client: client,
+		Remote: conn.RemoteAddr().String(),
+		ConnID: connID,
+		Operation: operation,
+	}
+}
+
+// audit
+//	Finish the audit record with the duration and outcome of the request, and append it to the audit log as a single line of JSON.
+//	Requests refused by the exports are recorded as denied. A record that cannot be written is logged, since the request has already been served.
+func (srv *QuicServer) audit(record *AuditRecord, requestErr error) {
+	if srv.auditLog == nil { return }
+
+	record.Duration = time.Since(record.Time).Seconds()
+	switch {
+		case requestErr == nil:
+			record.Outcome = TRANSFER_RESULT_COMPLETE
+		case errors.Is(requestErr, ErrAccessDenied):
+			record.Outcome = AUDIT_OUTCOME_DENIED
+		case errors.Is(requestErr, ErrTransferCanceled):
+			record.Outcome = TRANSFER_RESULT_CANCELED
+		default:
+			record.Outcome = TRANSFER_RESULT_FAILED
+			record.Error = requestErr.Error()
+	}
+
+	line, marshalErr := json.Marshal(record)
+	if marshalErr != nil {
+		srv.logger.Error("audit record not written", logger.F(logger.PATH_KEY, record.Path), logger.F("client", record.Client), logger.Err(marshalErr))
+		return
+	}
+
+	srv.auditMu.Lock()
+	_, writeErr := srv.auditLog.Write(append(line, '\n'))
+	srv.auditMu.Unlock()
+
+	if writeErr != nil { srv.logger.Error("audit record not written", logger.F(logger.PATH_KEY, record.Path), logger.F("client", record.Client), logger.Err(writeErr)) }
+}
+
+// auditRanges
+//	Convert the ranges of a request for the audit record.
+func auditRanges(ranges []protocol.Range) []AuditRange {
+	converted := make([]AuditRange, len(ranges))
+	for idx, r := range ranges { converted[idx] = AuditRange{ Offset: r.Offset, Length: r.Length } }
+
+	return converted
+}
@@ -0,0 +1,51 @@
+package srv
+
+import (
+	"io"
+	"os"
+
+	"github.com/sirgallo/quicfiletransfer/common/compress"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Server Compression
+
+
+// resolveCodec
+//	Determine the codec for a transfer from the one the client requested.
+//	In auto mode, samples spread evenly across the file are compressed with zstd.
+//	If the samples do not shrink by at least 10%, the data is treated as incompressible and sent as is,
+//	since compressing it would only cost cpu on both ends.
+func resolveCodec(file *os.File, fileSize uint64, requested protocol.Codec, transferLogger logger.Logger) protocol.Codec {
+	if requested != protocol.CODEC_AUTO { return requested }
+
+	sampleSize := uint64(COMPRESSION_SAMPLE_SIZE)
+	stride := fileSize / COMPRESSION_SAMPLE_COUNT
+	if stride < sampleSize { sampleSize, stride = fileSize, fileSize } // small files are sampled whole, so samples never overlap
+
+	sample := make([]byte, 0, COMPRESSION_SAMPLE_COUNT * COMPRESSION_SAMPLE_SIZE)
+	for offset := uint64(0); offset < fileSize && len(sample) < cap(sample); offset += stride {
+		buf := make([]byte, sampleSize)
+		nRead, readErr := file.ReadAt(buf, int64(offset))
+		if readErr != nil && readErr != io.EOF {
+			transferLogger.Warn("unable to sample file for compression", logger.Err(readErr))
+			return protocol.CODEC_NONE
+		}
+
+		sample = append(sample, buf[:nRead]...)
+	}
+
+	ratio, ratioErr := compress.Ratio(protocol.CODEC_ZSTD, sample)
+	if ratioErr != nil {
+		transferLogger.Warn("unable to sample file for compression", logger.Err(ratioErr))
+		return protocol.CODEC_NONE
+	}
+
+	codec := protocol.CODEC_ZSTD
+	if ratio > COMPRESSION_AUTO_MAX_RATIO { codec = protocol.CODEC_NONE }
+
+	transferLogger.Debug("sampled file for compression", logger.F("ratio", ratio), logger.F("codec", compress.CodecName(codec)))
+	return codec
+}
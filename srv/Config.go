@@ -0,0 +1,312 @@
+package srv
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/rotate"
+	"github.com/sirgallo/quicfiletransfer/common/tuning"
+
+	customtls "github.com/sirgallo/quicfiletransfer/common/tls"
+)
+
+
+//============================================= Server Config
+
+
+// DefaultConfig
+//	The configuration used for any field not set in the config file or on the command line.
+func DefaultConfig() *Config {
+	return &Config{
+		Listen: ListenConfig{ Host: DEFAULT_HOST, Port: DEFAULT_PORT },
+		TLS: TLSConfig{ Org: DEFAULT_ORG },
+		Limits: LimitsConfig{ MaxStreamsPerConnection: DEFAULT_MAX_STREAMS_PER_CONNECTION, MaxStreamsPerRequest: DEFAULT_MAX_STREAMS_PER_REQUEST },
+		Log: LogConfig{ Level: DEFAULT_LOG_LEVEL },
+		Metrics: MetricsConfig{ Path: DEFAULT_METRICS_PATH },
+		Audit: AuditConfig{ MaxSizeMB: DEFAULT_AUDIT_MAX_SIZE_MB },
+		ShutdownTimeout: Duration(DEFAULT_SHUTDOWN_TIMEOUT),
+	}
+}
+
+// Load
+//	Read a JSON config file over the current configuration, so fields missing from the file keep their values.
+//	Unknown fields are rejected, and syntax errors report the line and column they occur at.
+func (cfg *Config) Load(path string) error {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil { return readErr }
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	decodeErr := decoder.Decode(cfg)
+	if decodeErr != nil { return fmt.Errorf("%s: %w", path, describeJSONError(data, decodeErr)) }
+
+	_, trailingErr := decoder.Token()
+	if trailingErr != io.EOF { return fmt.Errorf("%s: unexpected data after the config object", path) }
+
+	return nil
+}
+
+// Validate
+//	Check every field of the configuration, returning every problem found along with the field it was found in.
+func (cfg *Config) Validate() error {
+	var problems []error
+	invalid := func(field string, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: " + format, append([]interface{}{ field }, args...)...))
+	}
+
+	if cfg.Listen.Port < 1 || cfg.Listen.Port > 65535 { invalid("listen.port", "must be between 1 and 65535, got %d", cfg.Listen.Port) }
+	if (cfg.TLS.CertPath == "") != (cfg.TLS.KeyPath == "") { invalid("tls", "certPath and keyPath must be set together") }
+	if cfg.TLS.RequireClientCert && cfg.TLS.ClientCAPath == "" { invalid("tls.requireClientCert", "requires clientCAPath") }
+
+	names := make(map[string]bool, len(cfg.Exports))
+	for idx, export := range cfg.Exports {
+		field := fmt.Sprintf("exports[%d]", idx)
+		if export.Name == "" { invalid(field + ".name", "must be set") }
+		if names[export.Name] { invalid(field + ".name", "duplicate export %q", export.Name) }
+		names[export.Name] = true
+
+		pathErr := validateExportPath(export.Path)
+		if pathErr != nil { invalid(field + ".path", "%v", pathErr) }
+
+		for clientIdx, client := range export.Clients {
+			if ! strings.HasPrefix(client, CLIENT_CN_PREFIX) && ! strings.HasPrefix(client, CLIENT_IP_PREFIX) {
+				invalid(fmt.Sprintf("%s.clients[%d]", field, clientIdx), "must start with %s or %s, got %q", CLIENT_CN_PREFIX, CLIENT_IP_PREFIX, client)
+			}
+		}
+	}
+
+	if cfg.Limits.MaxStreamsPerConnection < 0 { invalid("limits.maxStreamsPerConnection", "cannot be negative") }
+	if cfg.Limits.MaxStreamsPerRequest < 0 { invalid("limits.maxStreamsPerRequest", "cannot be negative") }
+	if cfg.Rates.MaxRate < 0 { invalid("rates.maxRate", "cannot be negative") }
+	if cfg.Rates.MaxRatePerConnection < 0 { invalid("rates.maxRatePerConnection", "cannot be negative") }
+	if cfg.Rates.MaxRatePerClient < 0 { invalid("rates.maxRatePerClient", "cannot be negative") }
+
+	_, parseScheduleErr := ParseRateSchedule(cfg.Rates.Schedule)
+	if parseScheduleErr != nil { invalid("rates.schedule", "%v", parseScheduleErr) }
+
+	if cfg.Quic.KeepAlivePeriod < 0 { invalid("quic.keepAlivePeriod", "cannot be negative") }
+	if cfg.Quic.MaxIdleTimeout < 0 { invalid("quic.maxIdleTimeout", "cannot be negative") }
+	if cfg.Quic.MaxIncomingUniStreams < 0 { invalid("quic.maxIncomingUniStreams", "cannot be negative") }
+	if cfg.Quic.HandshakeTimeout < 0 { invalid("quic.handshakeTimeout", "cannot be negative") }
+
+	tuningOpts, presetErr := cfg.Quic.tuning()
+	if presetErr != nil { invalid("quic.preset", "%v", presetErr) }
+
+	tuningErr := tuningOpts.Validate()
+	if presetErr == nil && tuningErr != nil { invalid("quic", "%v", tuningErr) }
+
+	_, parseLevelErr := logger.ParseLevel(cfg.Log.Level)
+	if parseLevelErr != nil { invalid("log.level", "%v", parseLevelErr) }
+	if cfg.Metrics.Listen != "" {
+		_, _, splitErr := net.SplitHostPort(cfg.Metrics.Listen)
+		if splitErr != nil { invalid("metrics.listen", "%v", splitErr) }
+	}
+
+	if cfg.Admin.Socket != "" && cfg.Admin.Listen != "" { invalid("admin", "socket and listen cannot both be set") }
+	if cfg.Admin.Listen != "" {
+		_, _, splitErr := net.SplitHostPort(cfg.Admin.Listen)
+		if splitErr != nil { invalid("admin.listen", "%v", splitErr) }
+	}
+
+	if cfg.Audit.Path != "" && cfg.Audit.MaxSizeMB <= 0 { invalid("audit.maxSizeMB", "must be greater than 0, got %d", cfg.Audit.MaxSizeMB) }
+	if cfg.Audit.MaxFiles < 0 { invalid("audit.maxFiles", "cannot be negative") }
+
+	if ! strings.HasPrefix(cfg.Metrics.Path, "/") { invalid("metrics.path", "must start with /, got %q", cfg.Metrics.Path) }
+	if cfg.ShutdownTimeout < 0 { invalid("shutdownTimeout", "cannot be negative") }
+
+	if len(problems) == 0 { return nil }
+	return fmt.Errorf("%w:\n%w", ErrInvalidConfig, errors.Join(problems...))
+}
+
+// ServerOpts
+//	Build the options for the server from a validated configuration, loading certificates and opening the log and audit files.
+//	Without a cert and key, a self signed cert is generated.
+func (cfg *Config) ServerOpts() (*QuicServerOpts, error) {
+	cert, certErr := cfg.TLS.certificate()
+	if certErr != nil { return nil, certErr }
+
+	srvLogger, loggerErr := cfg.Log.logger()
+	if loggerErr != nil { return nil, loggerErr }
+
+	schedule, parseScheduleErr := ParseRateSchedule(cfg.Rates.Schedule)
+	if parseScheduleErr != nil { return nil, parseScheduleErr }
+
+	tuningOpts, presetErr := cfg.Quic.tuning()
+	if presetErr != nil { return nil, presetErr }
+
+	auditLog, auditErr := cfg.Audit.writer()
+	if auditErr != nil { return nil, auditErr }
+
+	opts := &QuicServerOpts{
+		Host: cfg.Listen.Host,
+		Port: cfg.Listen.Port,
+		TlsCert: cert,
+		EnableTracer: cfg.Log.Tracer,
+		Logger: srvLogger,
+		MaxStreamsPerConnection: cfg.Limits.MaxStreamsPerConnection,
+		MaxStreamsPerRequest: cfg.Limits.MaxStreamsPerRequest,
+		RateLimits: cfg.Rates.limits(),
+		RateSchedule: schedule,
+		Exports: cfg.Exports,
+		RequireClientCert: cfg.TLS.RequireClientCert,
+		Tuning: tuningOpts,
+	}
+
+	if auditLog != nil { opts.AuditLog = auditLog }
+
+	if cfg.TLS.ClientCAPath == "" { return opts, nil }
+
+	caPem, readCAErr := os.ReadFile(cfg.TLS.ClientCAPath)
+	if readCAErr != nil { return nil, readCAErr }
+
+	opts.ClientCAs = x509.NewCertPool()
+	if ! opts.ClientCAs.AppendCertsFromPEM(caPem) { return nil, fmt.Errorf("%s: no certificates found", cfg.TLS.ClientCAPath) }
+
+	return opts, nil
+}
+
+// ApplyConfig
+//	Apply the parts of a validated configuration that can change while the server runs: the exports, with their allowed clients, and the rate limits and schedule.
+//	New requests are checked against the new exports right away, and transfers in progress switch to the new rate limits.
+//	The listen address, tls, stream limits, quic tuning, logging, metrics, and the audit log only change on restart.
+func (srv *QuicServer) ApplyConfig(cfg *Config) error {
+	exports, resolveErr := resolveExports(cfg.Exports)
+	if resolveErr != nil { return resolveErr }
+
+	schedule, parseScheduleErr := ParseRateSchedule(cfg.Rates.Schedule)
+	if parseScheduleErr != nil { return parseScheduleErr }
+
+	srv.mu.Lock()
+	srv.exports = exports
+	srv.mu.Unlock()
+
+	srv.limiters.setSchedule(schedule)
+	srv.SetRateLimits(cfg.Rates.limits())
+
+	srv.logger.Info("config applied", logger.F("exports", len(exports)), logger.F("rateWindows", len(schedule)))
+	return nil
+}
+
+// UnmarshalJSON
+//	Parse a duration string, like "30s" or "1m30s".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	unmarshalErr := json.Unmarshal(data, &value)
+	if unmarshalErr != nil { return fmt.Errorf("duration must be a string like \"30s\": %w", unmarshalErr) }
+
+	parsed, parseErr := time.ParseDuration(value)
+	if parseErr != nil { return parseErr }
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON
+//	Write the duration as a string, like "30s".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// certificate
+//	Load the server certificate, or generate a self signed one if no cert and key are set.
+func (tlsCfg *TLSConfig) certificate() (*tls.Certificate, error) {
+	if tlsCfg.CertPath == "" && tlsCfg.KeyPath == "" { return customtls.GenerateTLSCert(tlsCfg.Org) }
+
+	cert, loadErr := tls.LoadX509KeyPair(tlsCfg.CertPath, tlsCfg.KeyPath)
+	if loadErr != nil { return nil, loadErr }
+
+	return &cert, nil
+}
+
+// logger
+//	Create the server logger, appending to the log file if one is set. The file stays open for the life of the process.
+func (logCfg *LogConfig) logger() (logger.Logger, error) {
+	level, parseLevelErr := logger.ParseLevel(logCfg.Level)
+	if parseLevelErr != nil { return nil, parseLevelErr }
+	if logCfg.Path == "" { return logger.NewStdLogger(os.Stderr, level), nil }
+
+	logFile, openErr := os.OpenFile(logCfg.Path, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+	if openErr != nil { return nil, openErr }
+
+	return logger.NewStdLogger(logFile, level), nil
+}
+
+// writer
+//	Open the audit log for appending, rotating it by size. Returns nil if no path is set. The file stays open for the life of the process.
+func (auditCfg *AuditConfig) writer() (*rotate.Writer, error) {
+	if auditCfg.Path == "" { return nil, nil }
+	return rotate.NewWriter(auditCfg.Path, int64(auditCfg.MaxSizeMB) * MB, auditCfg.MaxFiles)
+}
+
+// limits
+//	The rate limits for the configuration, converted from MB to bytes per second.
+func (ratesCfg *RatesConfig) limits() RateLimits {
+	return RateLimits{
+		Global: int64(ratesCfg.MaxRate * MB),
+		PerConnection: int64(ratesCfg.MaxRatePerConnection * MB),
+		PerClient: int64(ratesCfg.MaxRatePerClient * MB),
+	}
+}
+
+// tuning
+//	The quic tuning options for the configuration, with the fields that are set layered over the preset.
+func (quicCfg *QuicConfig) tuning() (tuning.Options, error) {
+	preset, presetErr := tuning.Preset(quicCfg.Preset)
+	if presetErr != nil { return tuning.Options{}, presetErr }
+
+	return preset.Merge(tuning.Options{
+		KeepAlivePeriod: time.Duration(quicCfg.KeepAlivePeriod),
+		MaxIdleTimeout: time.Duration(quicCfg.MaxIdleTimeout),
+		InitialStreamReceiveWindow: quicCfg.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow: quicCfg.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: quicCfg.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow: quicCfg.MaxConnectionReceiveWindow,
+		MaxIncomingUniStreams: quicCfg.MaxIncomingUniStreams,
+		HandshakeTimeout: time.Duration(quicCfg.HandshakeTimeout),
+	}), nil
+}
+
+// validateExportPath
+//	Check that the path of an export is an absolute path to an existing directory.
+func validateExportPath(path string) error {
+	if ! filepath.IsAbs(path) { return fmt.Errorf("must be an absolute path, got %q", path) }
+
+	info, statErr := os.Stat(path)
+	if statErr != nil { return statErr }
+	if ! info.IsDir() { return fmt.Errorf("%q is not a directory", path) }
+
+	return nil
+}
+
+// describeJSONError
+//	Add the line and column to JSON syntax and type errors, which otherwise only report a byte offset.
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	offset := int64(-1)
+	switch {
+		case errors.As(err, &syntaxErr):
+			offset = syntaxErr.Offset
+		case errors.As(err, &typeErr):
+			offset = typeErr.Offset
+	}
+
+	if offset < 0 || offset > int64(len(data)) { return err }
+
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
@@ -0,0 +1,154 @@
+package srv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+
+// writeConfig
+//	Write a config file to a temporary directory, returning its path.
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeErr := os.WriteFile(path, []byte(contents), 0644)
+	if writeErr != nil { t.Fatal(writeErr) }
+
+	return path
+}
+
+
+func TestValidate(t *testing.T) {
+	exportDir := t.TempDir()
+	exportFile := filepath.Join(exportDir, "file")
+	os.WriteFile(exportFile, nil, 0644)
+
+	tests := []struct {
+		name string
+		mutate func(cfg *Config)
+		// fields: the fields reported as invalid, empty if the config is valid
+		fields []string
+	}{
+		{ "defaults", func(cfg *Config) {}, nil },
+		{ "full config", func(cfg *Config) {
+			cfg.Exports = []Export{{ Name: "files", Path: exportDir, Clients: []string{ "cn:alice", "ip:10.0.0.0/8" } }}
+			cfg.Rates = RatesConfig{ MaxRate: 100, MaxRatePerClient: 10, Schedule: "mon-fri 09:00-17:00 50" }
+			cfg.Quic.Preset = "wan"
+			cfg.Metrics.Listen = "127.0.0.1:9100"
+			cfg.Admin.Socket = "/run/admin.sock"
+			cfg.Audit.Path = "/var/log/audit.log"
+		}, nil },
+		{ "port out of range", func(cfg *Config) { cfg.Listen.Port = 70000 }, []string{ "listen.port" } },
+		{ "cert without key", func(cfg *Config) { cfg.TLS.CertPath = "cert.pem" }, []string{ "tls" } },
+		{ "client cert without ca", func(cfg *Config) { cfg.TLS.RequireClientCert = true }, []string{ "tls.requireClientCert" } },
+		{ "export without name", func(cfg *Config) { cfg.Exports = []Export{{ Path: exportDir }} }, []string{ "exports[0].name" } },
+		{ "duplicate export", func(cfg *Config) { cfg.Exports = []Export{{ Name: "a", Path: exportDir }, { Name: "a", Path: exportDir }} }, []string{ "exports[1].name" } },
+		{ "relative export path", func(cfg *Config) { cfg.Exports = []Export{{ Name: "a", Path: "files" }} }, []string{ "exports[0].path" } },
+		{ "export path is a file", func(cfg *Config) { cfg.Exports = []Export{{ Name: "a", Path: exportFile }} }, []string{ "exports[0].path" } },
+		{ "export path missing", func(cfg *Config) { cfg.Exports = []Export{{ Name: "a", Path: filepath.Join(exportDir, "missing") }} }, []string{ "exports[0].path" } },
+		{ "client without prefix", func(cfg *Config) { cfg.Exports = []Export{{ Name: "a", Path: exportDir, Clients: []string{ "alice" } }} }, []string{ "exports[0].clients[0]" } },
+		{ "negative limits", func(cfg *Config) {
+			cfg.Limits = LimitsConfig{ MaxStreamsPerConnection: -1, MaxStreamsPerRequest: -1 }
+		}, []string{ "limits.maxStreamsPerConnection", "limits.maxStreamsPerRequest" } },
+		{ "negative rates", func(cfg *Config) {
+			cfg.Rates = RatesConfig{ MaxRate: -1, MaxRatePerConnection: -1, MaxRatePerClient: -1 }
+		}, []string{ "rates.maxRate", "rates.maxRatePerConnection", "rates.maxRatePerClient" } },
+		{ "empty rate window", func(cfg *Config) { cfg.Rates.Schedule = "09:00-09:00 10" }, []string{ "rates.schedule" } },
+		{ "unknown preset", func(cfg *Config) { cfg.Quic.Preset = "lan" }, []string{ "quic.preset" } },
+		{ "negative quic durations", func(cfg *Config) {
+			cfg.Quic.KeepAlivePeriod = Duration(-time.Second)
+			cfg.Quic.HandshakeTimeout = Duration(-time.Second)
+		}, []string{ "quic.keepAlivePeriod", "quic.handshakeTimeout" } },
+		{ "unknown log level", func(cfg *Config) { cfg.Log.Level = "loud" }, []string{ "log.level" } },
+		{ "metrics listen without port", func(cfg *Config) { cfg.Metrics.Listen = "127.0.0.1" }, []string{ "metrics.listen" } },
+		{ "metrics path without slash", func(cfg *Config) { cfg.Metrics.Path = "metrics" }, []string{ "metrics.path" } },
+		{ "admin socket and listen", func(cfg *Config) { cfg.Admin = AdminConfig{ Socket: "/run/admin.sock", Listen: "127.0.0.1:9200" } }, []string{ "admin" } },
+		{ "audit without max size", func(cfg *Config) { cfg.Audit = AuditConfig{ Path: "/var/log/audit.log" } }, []string{ "audit.maxSizeMB" } },
+		{ "negative audit max files", func(cfg *Config) { cfg.Audit.MaxFiles = -1 }, []string{ "audit.maxFiles" } },
+		{ "negative shutdown timeout", func(cfg *Config) { cfg.ShutdownTimeout = Duration(-time.Second) }, []string{ "shutdownTimeout" } },
+		{ "every problem is reported", func(cfg *Config) {
+			cfg.Listen.Port = 0
+			cfg.Log.Level = "loud"
+			cfg.Metrics.Path = ""
+		}, []string{ "listen.port", "log.level", "metrics.path" } },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			test.mutate(cfg)
+
+			validateErr := cfg.Validate()
+			if len(test.fields) == 0 {
+				if validateErr != nil { t.Fatalf("expected a valid config, got %v", validateErr) }
+				return
+			}
+
+			if ! errors.Is(validateErr, ErrInvalidConfig) { t.Fatalf("expected %v, got %v", ErrInvalidConfig, validateErr) }
+
+			problems := strings.Split(validateErr.Error(), "\n")[1:]
+			if len(problems) != len(test.fields) { t.Errorf("expected %d problems, got %q", len(test.fields), problems) }
+			for _, field := range test.fields {
+				found := false
+				for _, problem := range problems {
+					if strings.HasPrefix(problem, field + ":") { found = true }
+				}
+
+				if ! found { t.Errorf("expected a problem with %s, got %q", field, problems) }
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		contents string
+		expected func(cfg *Config)
+		// err: a substring of the expected error, empty if the file loads
+		err string
+	}{
+		{ "empty object keeps defaults", `{}`, func(cfg *Config) {}, "" },
+		{ "file overrides defaults", `{ "listen": { "port": 2000 }, "log": { "level": "debug" }, "shutdownTimeout": "5s" }`, func(cfg *Config) {
+			cfg.Listen.Port = 2000
+			cfg.Log.Level = "debug"
+			cfg.ShutdownTimeout = Duration(5 * time.Second)
+		}, "" },
+		{ "missing fields of a section keep defaults", `{ "listen": { "host": "127.0.0.1" } }`, func(cfg *Config) { cfg.Listen.Host = "127.0.0.1" }, "" },
+		{ "exports", `{ "exports": [ { "name": "files", "path": "/srv/files", "clients": [ "cn:alice" ] } ] }`, func(cfg *Config) {
+			cfg.Exports = []Export{{ Name: "files", Path: "/srv/files", Clients: []string{ "cn:alice" } }}
+		}, "" },
+		{ "unknown field", `{ "listen": { "prot": 2000 } }`, nil, `unknown field "prot"` },
+		{ "syntax error has a position", "{\n  \"listen\": { \"port\": 2000, }\n}", nil, "line 2, column" },
+		{ "type error has a position", "{\n\n  \"listen\": { \"port\": \"2000\" }\n}", nil, "line 3, column" },
+		{ "bad duration", `{ "shutdownTimeout": 30 }`, nil, "duration must be a string" },
+		{ "trailing data", `{} {}`, nil, "unexpected data after the config object" },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfig(t, test.contents)
+
+			cfg := DefaultConfig()
+			loadErr := cfg.Load(path)
+			if test.err != "" {
+				if loadErr == nil || ! strings.Contains(loadErr.Error(), test.err) { t.Fatalf("expected an error containing %q, got %v", test.err, loadErr) }
+				if ! strings.HasPrefix(loadErr.Error(), path + ": ") { t.Errorf("expected the error to name the file, got %v", loadErr) }
+				return
+			}
+
+			if loadErr != nil { t.Fatal(loadErr) }
+
+			expected := DefaultConfig()
+			test.expected(expected)
+			if ! reflect.DeepEqual(cfg, expected) { t.Errorf("expected %+v, got %+v", expected, cfg) }
+		})
+	}
+
+	missingErr := DefaultConfig().Load(filepath.Join(t.TempDir(), "missing.json"))
+	if ! os.IsNotExist(missingErr) { t.Errorf("expected a missing file to fail with not exist, got %v", missingErr) }
+}
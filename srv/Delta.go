@@ -0,0 +1,101 @@
+package srv
+
+import (
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/delta"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/md5"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Server Delta
+
+
+// handleDeltaRequest
+//	The client sends the block signatures of its existing copy of the file.
+//	The server scans its file for those blocks and responds with the size and md5 of the file, along with the blocks the client can copy from its own copy.
+//	The block size and number of blocks are checked before the file is opened, since they decide how much memory the scan uses.
+//	Everything not covered by a copy is requested afterwards as ranges, over the usual parallel data streams, and audited as a file request of its own.
+func (srv *QuicServer) handleDeltaRequest(conn quic.Connection, commStream quic.Stream, payload []byte, record *AuditRecord, connLogger logger.Logger) error {
+	deltaReq, desReqErr := protocol.DeserializeDeltaRequest(payload)
+	if desReqErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, desReqErr.Error())
+		return desReqErr
+	}
+
+	validateErr := delta.ValidateSignatures(deltaReq.BlockSize, len(deltaReq.Blocks))
+	if validateErr != nil {
+		conn.CloseWithError(common.PROTOCOL_ERROR, validateErr.Error())
+		return validateErr
+	}
+
+	record.Path = deltaReq.Path
+	transferLogger := connLogger.With(logger.F(logger.PATH_KEY, deltaReq.Path))
+	export, servePath, authErr := srv.authorizeRequest(conn, record.Client, deltaReq.Path, transferLogger)
+	if authErr != nil { return authErr }
+	if export != nil { record.Export = export.Name }
+
+	transferLogger.Info("delta requested", logger.F("blockSize", deltaReq.BlockSize), logger.F("blocks", len(deltaReq.Blocks)))
+
+	file, openErr := os.Open(servePath)
+	if openErr != nil { 
+		conn.CloseWithError(common.INTERNAL_ERROR, openErr.Error())
+		return openErr 
+	}
+
+	defer file.Close()
+
+	fileStat, statErr := file.Stat()
+	if statErr != nil { 
+		conn.CloseWithError(common.INTERNAL_ERROR, statErr.Error())
+		return statErr 
+	}
+
+	fileSize := uint64(fileStat.Size())
+	record.Size = fileSize
+
+	md5, getMd5Err := md5.ReadMD5FromFile(servePath + common.MD5_SUFFIX)
+	if getMd5Err != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, getMd5Err.Error())
+		return getMd5Err 
+	}
+
+	record.Md5 = hex.EncodeToString(md5)
+
+	scanStartTime := time.Now()
+	copies, computeErr := delta.ComputeCopies(file, fileSize, deltaReq.BlockSize, deltaReq.Blocks)
+	if computeErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, computeErr.Error())
+		return computeErr
+	}
+
+	reused := uint64(0)
+	for _, c := range copies { reused += c.Length }
+	transferLogger.Debug("delta computed", 
+		logger.F("copies", len(copies)), 
+		logger.F("reused", reused), 
+		logger.F("size", fileSize), 
+		logger.F("elapsed", time.Since(scanStartTime)),
+	)
+
+	metaPayload := protocol.SerializeDeltaMeta(&protocol.DeltaMeta{ 
+		Size: fileSize, 
+		Md5: md5, 
+		Copies: copies, 
+		Attrs: readFileAttrs(servePath, deltaReq.Preserve, transferLogger),
+	})
+	writeMetaErr := protocol.WriteMessage(commStream, protocol.DELTA_META, metaPayload)
+	if writeMetaErr != nil {
+		conn.CloseWithError(common.TRANSPORT_ERROR, writeMetaErr.Error())
+		return writeMetaErr
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package srv
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+)
+
+
+//============================================= Server Exports
+
+
+// resolveExports
+//	Check every export and resolve its path to an absolute path without symlinks, so requested paths can be compared against it.
+func resolveExports(exports []Export) ([]Export, error) {
+	resolved := make([]Export, 0, len(exports))
+	for _, export := range exports {
+		if export.Name == "" || ! filepath.IsAbs(export.Path) { return nil, ErrInvalidExport }
+
+		root, evalErr := filepath.EvalSymlinks(export.Path)
+		if evalErr != nil { return nil, evalErr }
+
+		export.Path = root
+		resolved = append(resolved, export)
+	}
+
+	return resolved, nil
+}
+
+// authorize
+//	Check that a client may read a path, returning the path to serve. Without exports, every path is served as requested.
+//	Otherwise the path, with symlinks resolved, must be inside an export that allows the client. The innermost matching export is used.
+//	The resolved path is returned so the path that was checked is the one opened, rather than the requested path, whose symlinks may have changed since.
+//	Exports are replaced rather than modified when the config is applied, so the current set is read once under the lock.
+func (srv *QuicServer) authorize(client, path string) (*Export, string, error) {
+	srv.mu.Lock()
+	exports := srv.exports
+	srv.mu.Unlock()
+
+	if len(exports) == 0 { return nil, filepath.Clean(path), nil }
+
+	resolved, evalErr := filepath.EvalSymlinks(filepath.Clean(path))
+	if evalErr != nil { return nil, "", evalErr }
+
+	var matched *Export
+	for idx := range exports {
+		export := &exports[idx]
+		if ! isWithin(export.Path, resolved) { continue }
+		if matched == nil || len(export.Path) > len(matched.Path) { matched = export }
+	}
+
+	if matched == nil || ! matched.allows(client) { return nil, "", ErrAccessDenied }
+	return matched, resolved, nil
+}
+
+// authorizeRequest
+//	Authorize the path of a request for the client on the connection, closing the connection if it is refused.
+//	Returns the path to serve, which is the only path the request may open. Access denials are closed with ACCESS_DENIED_ERROR, which clients do not retry.
+func (srv *QuicServer) authorizeRequest(conn quic.Connection, client string, path string, requestLogger logger.Logger) (*Export, string, error) {
+	export, resolved, authErr := srv.authorize(client, path)
+	if authErr == ErrAccessDenied {
+		requestLogger.Warn("access denied", logger.F("client", client))
+		conn.CloseWithError(common.ACCESS_DENIED_ERROR, authErr.Error())
+		return nil, "", authErr
+	}
+
+	if authErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, authErr.Error())
+		return nil, "", authErr
+	}
+
+	if export != nil { requestLogger.Debug("request authorized", logger.F("export", export.Name), logger.F("client", client), logger.F("resolved", resolved)) }
+	return export, resolved, nil
+}
+
+// allows
+//	Check whether a client identity may read from the export.
+func (export *Export) allows(client string) bool {
+	if len(export.Clients) == 0 { return true }
+
+	for _, allowed := range export.Clients {
+		if allowed == client { return true }
+	}
+
+	return false
+}
+
+// isWithin
+//	Check whether a path is the root or below it. Both must be clean absolute paths.
+func isWithin(root, path string) bool {
+	rel, relErr := filepath.Rel(root, path)
+	if relErr != nil { return false }
+
+	return rel != ".." && ! strings.HasPrefix(rel, ".." + string(filepath.Separator))
+}
@@ -1,16 +1,24 @@
 package srv
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
 	"io"
-	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/quic-go/quic-go"
 
 	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/compress"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
 	"github.com/sirgallo/quicfiletransfer/common/md5"
+	"github.com/sirgallo/quicfiletransfer/common/metrics"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+	"github.com/sirgallo/quicfiletransfer/common/ratelimit"
 	"github.com/sirgallo/quicfiletransfer/common/serialize"
 )
 
@@ -20,7 +28,15 @@ import (
 
 // handleConnection
 //	Accept multiple streams from a single connection since QUIC can multiplex streams.
-func handleConnection(conn quic.Connection) error {
+//	Every transfer on the connection shares the connection's budget of data streams, and the rate limits for the connection and its client.
+//	The client is identified once the handshake completes, and that identity is used for every request on the connection.
+//	Once the server is shutting down, new requests are refused by resetting their streams with SHUTDOWN_ERROR, while requests already in flight finish.
+func (srv *QuicServer) handleConnection(conn quic.Connection, connID uint64, client string, connLogger logger.Logger) error {
+	budget := newStreamBudget(srv.maxStreamsPerConnection)
+
+	limiters := srv.limiters.acquire(connID, client)
+	defer srv.limiters.release(connID, client)
+
 	for {
 		stream, streamErr := conn.AcceptStream(context.Background())
 		if streamErr != nil { 
@@ -28,155 +44,463 @@ func handleConnection(conn quic.Connection) error {
 			return streamErr 
 		}
 
-		go handleCommStream(conn, stream)
+		if ! srv.beginRequest(connID) {
+			stream.CancelRead(quic.StreamErrorCode(common.SHUTDOWN_ERROR))
+			stream.CancelWrite(quic.StreamErrorCode(common.SHUTDOWN_ERROR))
+			continue
+		}
+
+		go func() {
+			defer srv.endRequest(connID)
+
+			handleErr := srv.handleCommStream(conn, connID, client, stream, budget, limiters, connLogger)
+			if handleErr != nil && handleErr != ErrTransferCanceled { connLogger.Error("file transfer failed", logger.Err(handleErr)) }
+		}()
 	}
 }
 
 // handleCommStream
 //	The bidirectional communication channel between the client and server.
-//	For individual streams get the file to transfer.
-//	The server opens the file and determines the size of the chunk to send to the client.
-//	The server then sends a metadata payload to the client containing filesize, chunksize, and the start offset to process.
-//	The data from the chunk in the file is written to the stream to be received by the client.
-func handleCommStream(conn quic.Connection, commStream quic.Stream) error {
+//	Each comm stream carries a single request: a file to transfer, or a delta or list request, which is answered on its own.
+//	Every request is recorded in the audit log once it finishes, including requests denied by the exports, requests that cannot be read, and unexpected messages.
+func (srv *QuicServer) handleCommStream(
+	conn quic.Connection,
+	connID uint64,
+	client string,
+	commStream quic.Stream,
+	budget *streamBudget,
+	limiters []*ratelimit.Limiter,
+	connLogger logger.Logger,
+) error {
 	defer commStream.Close()
 
-	buf := make([]byte, common.CLIENT_PAYLOAD_MAX_LENGTH)
-	payloadLength, readPayloadErr := commStream.Read(buf)
+	record := newAuditRecord(conn, connID, client, AUDIT_OPERATION_UNKNOWN)
+	msgType, payload, readPayloadErr := protocol.ReadMessage(commStream)
 	if readPayloadErr != nil { 
 		conn.CloseWithError(common.TRANSPORT_ERROR, readPayloadErr.Error())
+		srv.audit(record, readPayloadErr)
 		return readPayloadErr 
 	}
 
-	totalStreamsForFile := uint8(buf[0])
-	fileName := string(buf[1:payloadLength])
+	var requestErr error
+	switch msgType {
+		case protocol.FILE_REQUEST:
+			record.Operation = AUDIT_OPERATION_FILE
+			requestErr = srv.handleFileRequest(conn, connID, commStream, payload, budget, limiters, record, connLogger)
+		case protocol.DELTA_REQUEST:
+			record.Operation = AUDIT_OPERATION_DELTA
+			requestErr = srv.handleDeltaRequest(conn, commStream, payload, record, connLogger)
+		case protocol.LIST_REQUEST:
+			record.Operation = AUDIT_OPERATION_LIST
+			requestErr = srv.handleListRequest(conn, commStream, payload, record, connLogger)
+		default:
+			record.Operation = AUDIT_OPERATION_INVALID
+			conn.CloseWithError(common.TRANSPORT_ERROR, protocol.ErrUnexpectedMessage.Error())
+			requestErr = protocol.ErrUnexpectedMessage
+	}
+
+	srv.audit(record, requestErr)
+	return requestErr
+}
+
+// handleFileRequest
+//	The server opens the requested file, at the path it was authorized at, and sends a metadata payload to the client containing filesize and md5.
+//	The requested ranges (or the entire file) are then divided into work units on a shared queue. For sparse files, the holes are left out of the ranges and the data extents are sent in the metadata.
+//	Each data stream pulls units from the queue until it is empty, so no stream sits idle while others still have work.
+//	For every unit, the data stream writes a header with the offset and size of the unit, followed by the data from the unit in the file.
+//	If the transfer is compressed, units are instead sent as a series of compressed chunks, each with its own header.
+//	Once every stream has finished, the server reports the total number of data streams it opened so the client knows when it has accepted them all.
+//	The bytes sent are counted for the export and client, and the throughput of each data stream is observed once it closes.
+//	The transfer is tracked while in progress, so it can be listed and canceled. Canceling resets its streams without closing the connection.
+//	The requested ranges, the file's size and md5, and the bytes sent are filled into the audit record.
+func (srv *QuicServer) handleFileRequest(
+	conn quic.Connection,
+	connID uint64,
+	commStream quic.Stream,
+	payload []byte,
+	budget *streamBudget,
+	limiters []*ratelimit.Limiter,
+	record *AuditRecord,
+	connLogger logger.Logger,
+) error {
+	fileReq, desReqErr := protocol.DeserializeFileRequest(payload)
+	if desReqErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, desReqErr.Error())
+		return desReqErr
+	}
+
+	record.Path = fileReq.Path
+	transferLogger := connLogger.With(logger.F(logger.PATH_KEY, fileReq.Path))
+	export, servePath, authErr := srv.authorizeRequest(conn, record.Client, fileReq.Path, transferLogger)
+	if authErr != nil { return authErr }
+
+	result := TRANSFER_RESULT_FAILED
+	srv.metrics.transferStarted()
+	defer func() { srv.metrics.transferFinished(result) }()
+
+	exportName := ""
+	if export != nil { exportName = export.Name }
+	record.Export = exportName
 
-	log.Printf("filename: %s, total streams for file: %d\n", fileName, totalStreamsForFile)
+	client := record.Client
+	sent := srv.metrics.sentBytes.With(exportName, client)
+
+	transferLogger.Info("file requested", 
+		logger.F("streams", fileReq.Streams), 
+		logger.F("ranges", len(fileReq.Ranges)), 
+		logger.F("compression", compress.CodecName(fileReq.Compression)),
+	)
 	
-	file, openErr := os.Open(fileName)
+	file, openErr := os.Open(servePath)
 	if openErr != nil { 
 		conn.CloseWithError(common.INTERNAL_ERROR, openErr.Error())
 		return openErr 
 	}
 
+	defer file.Close()
+
 	fileStat, statErr := file.Stat()
-	if statErr != nil {
-		file.Close()
-		conn.CloseWithError(common.INTERNAL_ERROR, openErr.Error())
-		return statErr
+	if statErr != nil { 
+		conn.CloseWithError(common.INTERNAL_ERROR, statErr.Error())
+		return statErr 
 	}
 
-	file.Close()
-
 	fileSize := uint64(fileStat.Size())
-	md5, getMd5Err := md5.ReadMD5FromFile(fileName + ".md5")
+	record.Size = fileSize
+
+	md5, getMd5Err := md5.ReadMD5FromFile(servePath + common.MD5_SUFFIX)
 	if getMd5Err != nil {
 		conn.CloseWithError(common.INTERNAL_ERROR, getMd5Err.Error())
 		return getMd5Err 
 	}
 
-	log.Printf("fileSize: %d\n", fileSize)
+	record.Md5 = hex.EncodeToString(md5)
+
+	ranges := fileReq.Ranges
+	if len(ranges) == 0 { ranges = []protocol.Range{{ Offset: 0, Length: fileSize }} }
+	record.Ranges = auditRanges(ranges)
 
-	metaPayload := func() []byte {
-		p := make([]byte, common.FILE_META_PAYLOAD_MAX_LENGTH)
-		copy(p[:8], serialize.SerializeUint64(fileSize))
-		copy(p[8:], md5)
+	validateErr := validateRanges(ranges, fileSize)
+	if validateErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, validateErr.Error())
+		return validateErr
+	}
 
-		return p
-	}()
+	extents, sparse := sparseExtents(file, fileSize, transferLogger)
+	if sparse { ranges = intersectExtents(ranges, extents) }
+
+	codec := resolveCodec(file, fileSize, fileReq.Compression, transferLogger)
+
+	transferCtx, cancelTransfer := context.WithCancel(conn.Context())
+	defer cancelTransfer()
+
+	streams := newTransferStreams(budget, srv.maxStreamsPerRequest)
+	transfer := srv.trackTransfer(&activeTransfer{
+		connID: connID,
+		client: client,
+		path: fileReq.Path,
+		export: exportName,
+		size: rangesSize(ranges),
+		streams: streams,
+		cancel: cancelTransfer,
+		commStream: commStream,
+	})
+
+	defer srv.untrackTransfer(transfer.id)
+	defer func() { record.Bytes = transfer.sent.Value() }()
+	record.TransferID = transfer.id
+	defer func() { if transfer.isCanceled() { result = TRANSFER_RESULT_CANCELED } }()
+	transferLogger = transferLogger.With(logger.F(logger.TRANSFER_ID_KEY, transfer.id))
+
+	totalStreamsForFile, reserveErr := streams.reserve(transferCtx, int(fileReq.Streams))
+	if reserveErr != nil { return reserveErr }
+	defer streams.wait() // returns unused reserved slots to the connection if the transfer fails early
+	if totalStreamsForFile < int(fileReq.Streams) { 
+		transferLogger.Debug("stream count reduced by server limits", logger.F("requested", fileReq.Streams), logger.F("granted", totalStreamsForFile))
+	}
 
-	_, writeMetaErr := commStream.Write(metaPayload)
+	metaPayload := protocol.SerializeFileMeta(&protocol.FileMeta{ 
+		Size: fileSize, 
+		Md5: md5, 
+		Streams: uint16(totalStreamsForFile), 
+		MaxStreams: uint16(srv.maxStreamsPerRequest),
+		Compression: codec,
+		Sparse: sparse,
+		Extents: extents,
+		Attrs: readFileAttrs(servePath, fileReq.Preserve, transferLogger),
+	})
+	writeMetaErr := protocol.WriteMessage(commStream, protocol.FILE_META, metaPayload)
 	if writeMetaErr != nil {
 		conn.CloseWithError(common.TRANSPORT_ERROR, writeMetaErr.Error())
 		return writeMetaErr
 	}
 
-	var multiplexWG sync.WaitGroup
-	for s := range make([]uint8, totalStreamsForFile) {
-		multiplexWG.Add(1)
+	transferLogger.Debug("file metadata sent", logger.F("size", fileSize))
 
-		dataStream, openStreamErr := conn.OpenUniStream()
-		if openStreamErr != nil {
-			conn.CloseWithError(common.TRANSPORT_ERROR, openStreamErr.Error())
-			return openStreamErr
+	var streamErr error
+	var errOnce sync.Once
+
+	queue := newWorkQueue(ranges, WORK_UNIT_SIZE)
+	transferLogger.Debug("work queue created", logger.F("units", queue.size()))
+
+	worker := func(s int, dataStream quic.SendStream, shouldRetire func() bool) {
+		defer dataStream.Close()
+		if ! transfer.addStream(dataStream) { return }
+
+		streamLogger := transferLogger.With(logger.F(logger.STREAM_KEY, s))
+		limitedStream := ratelimit.NewWriter(transferCtx, dataStream, limiters...)
+		meteredStream := newMeteredWriter(limitedStream, sent)
+
+		started := time.Now()
+		sendErr := srv.sendUnits(commStream, meteredStream, file, queue, codec, &transfer.sent, shouldRetire, streamLogger)
+		srv.metrics.streamFinished(meteredStream.written, time.Since(started))
+		if sendErr != nil {
+			errOnce.Do(func() { streamErr = sendErr })
+			if ! transfer.isCanceled() { conn.CloseWithError(common.TRANSPORT_ERROR, sendErr.Error()) }
+			return
 		}
 
-		go func(s uint8) {
-			defer multiplexWG.Done()
-			defer dataStream.Close()
+		streamLogger.Debug("data stream finished")
+	}
 
-			chunkSize := fileSize / uint64(totalStreamsForFile)
-			startOffset := uint64(s) * chunkSize
-		
-			if fileSize % uint64(totalStreamsForFile) != 0 && uint8(s) == totalStreamsForFile - 1 {
-				chunkSize += fileSize % uint64(totalStreamsForFile)
-			}
-		
-			log.Printf("startOffset: %d, chunkSize: %d\n", startOffset, chunkSize)
-		
-			sendPayload := func() []byte {
-				p := make([]byte, common.CHUNK_META_PAYLOAD_MAX_LENGTH)
-				copy(p[:8], serialize.SerializeUint64(startOffset))
-				copy(p[8:], serialize.SerializeUint64(chunkSize))
-				
-				return p
-			}()
-		
-			_, writeErr := dataStream.Write(sendPayload)
-			if writeErr != nil {
-				conn.CloseWithError(common.TRANSPORT_ERROR, openErr.Error()) 
-				return 
-			}
-
-			f, openChunkErr := os.OpenFile(fileName, os.O_RDONLY, 0666)
-			if openChunkErr != nil {
-				conn.CloseWithError(common.INTERNAL_ERROR, openChunkErr.Error())
-				return
-			}
-
-			defer f.Close()
-
-			totalBytesStreamed := int64(0)
-			for int64(chunkSize) > totalBytesStreamed {
-				_, seekErr := f.Seek(int64(startOffset) + totalBytesStreamed, 0)
-				if seekErr != nil { 
-					conn.CloseWithError(common.INTERNAL_ERROR, seekErr.Error())
-					return
-				}
-				
-				var n int64
-				var streamFileErr error
+	for range make([]int, totalStreamsForFile) {
+		startErr := streams.start(conn, worker)
+		if startErr != nil {
+			if transfer.isCanceled() { break }
+
+			conn.CloseWithError(common.TRANSPORT_ERROR, startErr.Error())
+			return startErr
+		}
+	}
+
+	go srv.handleStreamAdjustments(conn, commStream, queue, streams, worker, transferLogger)
+
+	totalStreamsOpened := streams.wait()
+	if transfer.isCanceled() {
+		transferLogger.Info("file transfer canceled", logger.F("sent", transfer.sent.Value()))
+		return ErrTransferCanceled
+	}
+
+	commStream.CancelRead(common.NO_ERROR)
+	if streamErr != nil { return streamErr }
+
+	writeDoneErr := protocol.WriteMessage(commStream, protocol.TRANSFER_DONE, serialize.SerializeUint32(uint32(totalStreamsOpened)))
+	if writeDoneErr != nil {
+		conn.CloseWithError(common.TRANSPORT_ERROR, writeDoneErr.Error())
+		return writeDoneErr
+	}
+	
+	result = TRANSFER_RESULT_COMPLETE
+	transferLogger.Info("file transfer complete", logger.F("size", fileSize), logger.F("streams", totalStreamsOpened))
+	return nil
+}
+
+// handleStreamAdjustments
+//	Read control messages from the client while the transfer is in progress.
+//	The client can request additional data streams, which begin pulling from the same work queue if the server's stream limits allow,
+//	or retire streams, which close once they finish their current work unit.
+//	Returns once the comm stream is closed for reading.
+func (srv *QuicServer) handleStreamAdjustments(
+	conn quic.Connection,
+	commStream quic.Stream,
+	queue *workQueue,
+	streams *transferStreams,
+	worker func(int, quic.SendStream, func() bool),
+	transferLogger logger.Logger,
+) {
+	for {
+		msgType, payload, readErr := protocol.ReadMessage(commStream)
+		if readErr != nil { return }
+		count, desCountErr := serialize.DeserializeUint16(payload)
+		if desCountErr != nil { 
+			transferLogger.Warn("invalid stream adjustment payload", logger.Err(desCountErr))
+			continue
+		}
 
-				copyChunk := func () int64 {
-					if totalBytesStreamed + int64(STREAM_CHUNK_BUFFER_SIZE) > int64(chunkSize) {
-						return int64(chunkSize) - totalBytesStreamed
+		switch msgType {
+			case protocol.ADD_STREAMS:
+				transferLogger.Debug("adding streams", logger.F("count", count))
+				for range make([]int, int(count)) {
+					if queue.remaining() == 0 { break }
+
+					startErr := streams.start(conn, worker)
+					if startErr != nil {
+						transferLogger.Debug("unable to add stream", logger.Err(startErr))
+						break
 					}
-					
-					return int64(STREAM_CHUNK_BUFFER_SIZE)
-				}()
-
-				n, streamFileErr = io.CopyN(dataStream, f, copyChunk)
-				if streamFileErr == io.EOF { break }
-				if streamFileErr != nil && streamFileErr != io.EOF {
-					conn.CloseWithError(common.TRANSPORT_ERROR, streamFileErr.Error())
-					return 
 				}
+			case protocol.RETIRE_STREAMS:
+				transferLogger.Debug("retiring streams", logger.F("count", count))
+				streams.retire(int(count))
+			default:
+				transferLogger.Warn("unexpected message on comm stream", logger.F("type", msgType))
+		}
+	}
+}
+
+// sendUnits
+//	Pull work units off of the queue and write each to the data stream.
+//	The data stream is wrapped with the rate limiters for the server, connection, and client, so every stream of every transfer shares them.
+//	Between units, the stream checks whether the client asked for it to be retired.
+//	Streams share a single file descriptor and read with pread (ReadAt), so there is no per slice seek, into buffers from a pool shared across all streams.
+//	Before each unit is sent, the kernel is advised to read the unit ahead into the page cache.
+//	sendfile/splice are not usable here since quic encrypts packets in user space, so the file data must pass through a buffer.
+func (srv *QuicServer) sendUnits(
+	commStream quic.Stream,
+	dataStream io.Writer,
+	file *os.File,
+	queue *workQueue,
+	codec protocol.Codec,
+	progress *metrics.Counter,
+	shouldRetire func() bool,
+	streamLogger logger.Logger,
+) error {
+	buf := srv.bufferPool.Get()
+	defer srv.bufferPool.Put(buf)
+
+	var encoder compress.Encoder
+	if codec != protocol.CODEC_NONE {
+		var newEncoderErr error
+		encoder, newEncoderErr = compress.NewEncoder(codec)
+		if newEncoderErr != nil { return newEncoderErr }
+	}
+
+	var encoded bytes.Buffer
+
+	for {
+		if shouldRetire() {
+			streamLogger.Debug("data stream retired")
+			return nil
+		}
+
+		unit, ok := queue.next()
+		if ! ok { return nil }
+
+		streamLogger.Debug("sending unit", logger.F("offset", unit.Offset), logger.F("size", unit.Length))
+		adviseReadahead(file, unit.Offset, unit.Length)
+
+		var sendErr error
+		if encoder == nil {
+			sendErr = sendRawUnit(commStream, dataStream, file, unit, buf, progress)
+		} else { sendErr = sendCompressedUnit(commStream, dataStream, file, unit, buf, codec, encoder, &encoded, progress) }
+
+		if sendErr != nil { return sendErr }
+	}
+}
+
+// sendRawUnit
+//	Write the header for the unit, followed by the data from the unit in the file.
+//	After each slice of the file is written, the number of bytes is reported to the client on the comm stream and added to the progress of the transfer.
+func sendRawUnit(commStream quic.Stream, dataStream io.Writer, file *os.File, unit protocol.Range, buf []byte, progress *metrics.Counter) error {
+	header := &protocol.ChunkHeader{ Offset: unit.Offset, Size: unit.Length, EncodedSize: unit.Length, Codec: protocol.CODEC_NONE }
+	_, writeErr := dataStream.Write(protocol.SerializeChunkHeader(header))
+	if writeErr != nil { return writeErr }
+
+	totalBytesStreamed := uint64(0)
+	for unit.Length > totalBytesStreamed {
+		readSize := uint64(len(buf))
+		if unit.Length - totalBytesStreamed < readSize { readSize = unit.Length - totalBytesStreamed }
+
+		nRead, readErr := readSlice(file, buf[:readSize], unit.Offset + totalBytesStreamed)
+		if readErr != nil { return readErr }
+
+		_, streamFileErr := dataStream.Write(buf[:nRead])
+		if streamFileErr != nil { return streamFileErr }
+
+		totalBytesStreamed += uint64(nRead)
+		progress.Add(uint64(nRead))
+
+		writeBytesErr := protocol.WriteMessage(commStream, protocol.PROGRESS, serialize.SerializeUint64(uint64(nRead)))
+		if writeBytesErr != nil { return writeBytesErr }
+	}
+
+	return nil
+}
+
+// sendCompressedUnit
+//	Split the unit into slices the size of the buffer, compressing each into its own chunk with its own header.
+//	Compressing per slice bounds the memory held per stream and lets the client write each chunk as soon as it is decoded.
+//	Slices that do not shrink, like already compressed data within an otherwise compressible file, are sent uncompressed.
+func sendCompressedUnit(
+	commStream quic.Stream,
+	dataStream io.Writer,
+	file *os.File,
+	unit protocol.Range,
+	buf []byte,
+	codec protocol.Codec,
+	encoder compress.Encoder,
+	encoded *bytes.Buffer,
+	progress *metrics.Counter,
+) error {
+	totalBytesStreamed := uint64(0)
+	for unit.Length > totalBytesStreamed {
+		readSize := uint64(len(buf))
+		if unit.Length - totalBytesStreamed < readSize { readSize = unit.Length - totalBytesStreamed }
+
+		offset := unit.Offset + totalBytesStreamed
+		nRead, readErr := readSlice(file, buf[:readSize], offset)
+		if readErr != nil { return readErr }
 
-				totalBytesStreamed += n
+		encoded.Reset()
+		encoder.Reset(encoded)
 		
-				_, writeBytesErr := commStream.Write(serialize.SerializeUint64(uint64(n)))
-				if writeBytesErr != nil {
-					conn.CloseWithError(common.TRANSPORT_ERROR, writeBytesErr.Error()) 
-					return 
-				}
-			}
+		_, encodeErr := encoder.Write(buf[:nRead])
+		if encodeErr != nil { return encodeErr }
+
+		closeErr := encoder.Close()
+		if closeErr != nil { return closeErr }
 
-			log.Println("successfully transferred chunk", s)
-		}(uint8(s))
+		header := &protocol.ChunkHeader{ Offset: offset, Size: uint64(nRead), EncodedSize: uint64(nRead), Codec: protocol.CODEC_NONE }
+		chunk := buf[:nRead]
+		if encoded.Len() < nRead {
+			header.EncodedSize = uint64(encoded.Len())
+			header.Codec = codec
+			chunk = encoded.Bytes()
+		}
+
+		_, writeHeaderErr := dataStream.Write(protocol.SerializeChunkHeader(header))
+		if writeHeaderErr != nil { return writeHeaderErr }
+
+		_, streamChunkErr := dataStream.Write(chunk)
+		if streamChunkErr != nil { return streamChunkErr }
+
+		totalBytesStreamed += uint64(nRead)
+		progress.Add(uint64(nRead))
+
+		writeBytesErr := protocol.WriteMessage(commStream, protocol.PROGRESS, serialize.SerializeUint64(uint64(nRead)))
+		if writeBytesErr != nil { return writeBytesErr }
 	}
 
-	multiplexWG.Wait()
-	
-	log.Println("done")
 	return nil
-}
\ No newline at end of file
+}
+
+// readSlice
+//	Read exactly len(buf) bytes of the file at the offset.
+func readSlice(file *os.File, buf []byte, offset uint64) (int, error) {
+	nRead, readErr := file.ReadAt(buf, int64(offset))
+	if nRead < len(buf) { 
+		if readErr == nil || readErr == io.EOF { return nRead, io.ErrUnexpectedEOF }
+		return nRead, readErr
+	}
+
+	return nRead, nil
+}
+
+// rangesSize
+//	The total number of bytes in the ranges.
+func rangesSize(ranges []protocol.Range) uint64 {
+	total := uint64(0)
+	for _, r := range ranges { total += r.Length }
+
+	return total
+}
+
+// validateRanges
+//	Ensure every requested range falls within the file.
+func validateRanges(ranges []protocol.Range, fileSize uint64) error {
+	for _, r := range ranges {
+		if r.Offset > fileSize || r.Length > fileSize - r.Offset { return errors.New("requested range exceeds file size") }
+	}
+
+	return nil
+}
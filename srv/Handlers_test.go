@@ -0,0 +1,142 @@
+package srv
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/metrics"
+	"github.com/sirgallo/quicfiletransfer/common/pool"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+	"github.com/sirgallo/quicfiletransfer/common/serialize"
+)
+
+
+const BENCH_FILE_SIZE = 1024 * 1024 * 64 // 64MiB
+
+// discardStream: a comm stream that drops the progress messages written to it. Only Write is implemented
+type discardStream struct {
+	quic.Stream
+}
+
+func (discardStream) Write(p []byte) (int, error) { return len(p), nil }
+
+// benchFile
+//	Create a file of random data for the benchmarks, which is read from the page cache after the first pass.
+func benchFile(b *testing.B) *os.File {
+	data := make([]byte, BENCH_FILE_SIZE)
+	rand.Read(data)
+
+	path := filepath.Join(b.TempDir(), "bench")
+	writeErr := os.WriteFile(path, data, 0644)
+	if writeErr != nil { b.Fatal(writeErr) }
+
+	file, openErr := os.Open(path)
+	if openErr != nil { b.Fatal(openErr) }
+
+	b.Cleanup(func() { file.Close() })
+	return file
+}
+
+// sendUnitsSeekCopy
+//	The read loop sendUnits replaced: every stream opens its own descriptor, then seeks and copies each slice with io.CopyN.
+func sendUnitsSeekCopy(commStream io.Writer, dataStream io.Writer, fileName string, queue *workQueue) error {
+	f, openErr := os.OpenFile(fileName, os.O_RDONLY, 0666)
+	if openErr != nil { return openErr }
+	defer f.Close()
+
+	for {
+		unit, ok := queue.next()
+		if ! ok { return nil }
+
+		_, writeErr := dataStream.Write(protocol.SerializeChunkHeader(&protocol.ChunkHeader{ Offset: unit.Offset, Size: unit.Length, EncodedSize: unit.Length }))
+		if writeErr != nil { return writeErr }
+
+		totalBytesStreamed := int64(0)
+		for int64(unit.Length) > totalBytesStreamed {
+			_, seekErr := f.Seek(int64(unit.Offset) + totalBytesStreamed, 0)
+			if seekErr != nil { return seekErr }
+
+			copyChunk := int64(STREAM_CHUNK_BUFFER_SIZE)
+			if totalBytesStreamed + copyChunk > int64(unit.Length) { copyChunk = int64(unit.Length) - totalBytesStreamed }
+
+			n, copyErr := io.CopyN(dataStream, f, copyChunk)
+			if copyErr == io.EOF { return io.ErrUnexpectedEOF }
+			if copyErr != nil { return copyErr }
+
+			totalBytesStreamed += n
+
+			writeBytesErr := protocol.WriteMessage(commStream, protocol.PROGRESS, serialize.SerializeUint64(uint64(n)))
+			if writeBytesErr != nil { return writeBytesErr }
+		}
+	}
+}
+
+// benchmarkStreams
+//	Send the whole file over the given number of streams sharing a work queue, once per iteration.
+func benchmarkStreams(b *testing.B, streams int, send func(queue *workQueue) error) {
+	b.SetBytes(BENCH_FILE_SIZE)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		queue := newWorkQueue([]protocol.Range{{ Offset: 0, Length: BENCH_FILE_SIZE }}, WORK_UNIT_SIZE)
+
+		var wg sync.WaitGroup
+		errs := make([]error, streams)
+		for s := 0; s < streams; s++ {
+			wg.Add(1)
+			go func(s int) {
+				defer wg.Done()
+				errs[s] = send(queue)
+			}(s)
+		}
+
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil { b.Fatal(err) }
+		}
+	}
+}
+
+
+func BenchmarkSendUnits(b *testing.B) {
+	file := benchFile(b)
+	srv := &QuicServer{ bufferPool: pool.NewBufferPool(STREAM_CHUNK_BUFFER_SIZE) }
+	progress := &metrics.Counter{}
+	neverRetire := func() bool { return false }
+
+	for _, streams := range []int{ 1, 4 } {
+		b.Run(fmt.Sprintf("pread/streams=%d", streams), func(b *testing.B) {
+			benchmarkStreams(b, streams, func(queue *workQueue) error {
+				return srv.sendUnits(discardStream{}, io.Discard, file, queue, protocol.CODEC_NONE, progress, neverRetire, logger.NewNopLogger())
+			})
+		})
+
+		b.Run(fmt.Sprintf("seek/streams=%d", streams), func(b *testing.B) {
+			benchmarkStreams(b, streams, func(queue *workQueue) error {
+				return sendUnitsSeekCopy(discardStream{}, io.Discard, file.Name(), queue)
+			})
+		})
+	}
+}
+
+func BenchmarkReadSlice(b *testing.B) {
+	file := benchFile(b)
+	buf := make([]byte, STREAM_CHUNK_BUFFER_SIZE)
+	slices := uint64(BENCH_FILE_SIZE / STREAM_CHUNK_BUFFER_SIZE)
+
+	b.SetBytes(STREAM_CHUNK_BUFFER_SIZE)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, readErr := readSlice(file, buf, uint64(i) % slices * STREAM_CHUNK_BUFFER_SIZE)
+		if readErr != nil { b.Fatal(readErr) }
+	}
+}
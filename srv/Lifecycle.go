@@ -0,0 +1,231 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+)
+
+
+//============================================= Server Lifecycle
+
+
+// State
+//	The current lifecycle state of the server.
+func (srv *QuicServer) State() ServerState {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return srv.state
+}
+
+// Ready
+//	Closed once the server is accepting connections. If the server is shut down before it starts serving, this is never closed, so wait on Done as well.
+func (srv *QuicServer) Ready() <-chan struct{} {
+	return srv.ready
+}
+
+// Done
+//	Closed once the server has stopped and its udp connection is closed.
+func (srv *QuicServer) Done() <-chan struct{} {
+	return srv.done
+}
+
+// String
+//	The name of the state, as logged on transitions.
+func (state ServerState) String() string {
+	switch state {
+		case SERVER_NEW:
+			return "new"
+		case SERVER_SERVING:
+			return "serving"
+		case SERVER_DRAINING:
+			return "draining"
+		case SERVER_STOPPED:
+			return "stopped"
+		default:
+			return "unknown"
+	}
+}
+
+// Shutdown
+//	Gracefully shut down the server. The server stops accepting connections, and new requests on open connections are refused.
+//	In flight requests, file transfers as well as delta and list requests, are left to finish.
+//	Connections are closed with SHUTDOWN_ERROR once they have had no requests in flight for SHUTDOWN_IDLE_GRACE, so clients that keep a connection open between requests do not hold up shutdown.
+//	If the context ends first, the remaining connections are closed with SHUTDOWN_ERROR and the context error is returned.
+//	Either way, the server is stopped once this returns.
+func (srv *QuicServer) Shutdown(ctx context.Context) error {
+	srv.beginShutdown()
+
+	ticker := time.NewTicker(SHUTDOWN_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		srv.closeIdleConnections()
+
+		remaining := srv.openConnections()
+		if remaining == 0 { return srv.closeTransport() }
+
+		select {
+			case <-ctx.Done():
+				srv.logger.Warn("shutdown deadline reached, closing connections", logger.F("connections", remaining))
+				srv.closeConnections()
+				closeErr := srv.closeTransport()
+				if closeErr != nil { return closeErr }
+				return ctx.Err()
+			case <-ticker.C:
+		}
+	}
+}
+
+// Close
+//	Immediately close the server, closing every open connection with SHUTDOWN_ERROR without waiting for transfers to finish.
+func (srv *QuicServer) Close() error {
+	srv.beginShutdown()
+	srv.closeConnections()
+	return srv.closeTransport()
+}
+
+// beginShutdown
+//	Move the server to draining and stop accepting connections. Safe to call more than once.
+func (srv *QuicServer) beginShutdown() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.state >= SERVER_DRAINING { return }
+	srv.setState(SERVER_DRAINING)
+
+	srv.logger.Info("shutting down, draining connections", logger.F("connections", len(srv.conns)))
+	closeErr := srv.listener.Close()
+	if closeErr != nil { srv.logger.Warn("unable to close listener", logger.Err(closeErr)) }
+}
+
+// transition
+//	Move the server from one state to another, returning false if it is not in the expected state.
+func (srv *QuicServer) transition(from, to ServerState) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.state != from { return false }
+
+	srv.setState(to)
+	return true
+}
+
+// setState
+//	Record a state change, closing the channel for it if it has one. The lock must be held.
+func (srv *QuicServer) setState(state ServerState) {
+	srv.state = state
+	srv.logger.Debug("server state changed", logger.F("state", state))
+
+	switch state {
+		case SERVER_SERVING:
+			close(srv.ready)
+		case SERVER_STOPPED:
+			close(srv.done)
+	}
+}
+
+// trackConnection
+//	Register a connection once its handshake completes, so it can be drained on shutdown and listed. Returns false if the server is already closing.
+func (srv *QuicServer) trackConnection(connID uint64, conn quic.Connection, client string) bool {
+	connected := time.Now()
+	tracked := &trackedConn{ conn: conn, client: client, connected: connected, idleSince: connected }
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.state >= SERVER_DRAINING { return false }
+
+	srv.conns[connID] = tracked
+	return true
+}
+
+// untrackConnection
+//	Remove a connection once its handler exits.
+func (srv *QuicServer) untrackConnection(connID uint64) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	delete(srv.conns, connID)
+}
+
+// beginRequest
+//	Count a request as in flight on the connection. Returns false if the server has begun shutting down, in which case the request is refused.
+func (srv *QuicServer) beginRequest(connID uint64) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	tracked, ok := srv.conns[connID]
+	if ! ok || srv.state >= SERVER_DRAINING { return false }
+
+	tracked.requests++
+	return true
+}
+
+// endRequest
+//	Count a request on the connection as finished.
+func (srv *QuicServer) endRequest(connID uint64) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	tracked, ok := srv.conns[connID]
+	if ! ok { return }
+
+	tracked.requests--
+	if tracked.requests == 0 { tracked.idleSince = time.Now() }
+}
+
+// openConnections
+//	The number of connections still open.
+func (srv *QuicServer) openConnections() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return len(srv.conns)
+}
+
+// closeIdleConnections
+//	Close every connection that has had no requests in flight for SHUTDOWN_IDLE_GRACE with SHUTDOWN_ERROR. Their handlers exit once the close is processed, untracking them.
+//	The grace leaves time for the last data of a finished transfer to reach the client, which usually closes the connection itself first.
+func (srv *QuicServer) closeIdleConnections() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, tracked := range srv.conns {
+		if tracked.requests == 0 && time.Since(tracked.idleSince) >= SHUTDOWN_IDLE_GRACE { tracked.conn.CloseWithError(common.SHUTDOWN_ERROR, SHUTDOWN_REASON) }
+	}
+}
+
+// closeConnections
+//	Close every open connection with SHUTDOWN_ERROR, so clients know to retry against the server once it is back.
+func (srv *QuicServer) closeConnections() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, tracked := range srv.conns { tracked.conn.CloseWithError(common.SHUTDOWN_ERROR, SHUTDOWN_REASON) }
+}
+
+// closeTransport
+//	Close the transport and its udp connection once no connections need it, stopping the server. Safe to call more than once.
+//	The transport only closes connections it created itself, so the udp connection the server opened is closed here, freeing the port.
+func (srv *QuicServer) closeTransport() error {
+	srv.closeOnce.Do(func() { 
+		transportErr := srv.transport.Close()
+		udpErr := srv.udpConn.Close()
+		srv.closeErr = errors.Join(transportErr, udpErr)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+
+		srv.setState(SERVER_STOPPED)
+		srv.logger.Info("server stopped")
+	})
+
+	return srv.closeErr
+}
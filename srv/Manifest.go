@@ -0,0 +1,134 @@
+package srv
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/filter"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/md5"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Server Manifest
+
+
+// handleListRequest
+//	The client requests a manifest of every file and directory under a path, to compare against its own copy of the tree.
+//	Entries are sent in batches as the tree is walked. The stream is closed after the last batch.
+//	Md5 files are not listed on their own, since every file carries its md5 in its entry. Files without an md5 file cannot be transferred and are skipped.
+//	Paths excluded by the rules in the request or by ignore files in the tree are left out, so excluded data is never sent.
+//	If the path is a single file, the manifest holds just that file, named by its base name, so the client can check it against a local copy before transferring it.
+//	The number of entries sent is filled into the audit record.
+func (srv *QuicServer) handleListRequest(conn quic.Connection, commStream quic.Stream, payload []byte, record *AuditRecord, connLogger logger.Logger) error {
+	listReq, desReqErr := protocol.DeserializeListRequest(payload)
+	if desReqErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, desReqErr.Error())
+		return desReqErr
+	}
+
+	record.Path = listReq.Path
+	listLogger := connLogger.With(logger.F(logger.PATH_KEY, listReq.Path))
+	export, root, authErr := srv.authorizeRequest(conn, record.Client, listReq.Path, listLogger)
+	if authErr != nil { return authErr }
+	if export != nil { record.Export = export.Name }
+
+	listLogger.Info("manifest requested", logger.F("rules", len(listReq.Rules)))
+
+	treeFilter, filterErr := filter.New(listReq.Rules)
+	if filterErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, filterErr.Error())
+		return filterErr
+	}
+
+	rootStat, statErr := os.Stat(root)
+	if statErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, statErr.Error())
+		return statErr
+	}
+
+	if rootStat.Mode().IsRegular() {
+		fileEntry, entryErr := manifestEntry(root, filepath.Base(root), rootStat)
+		if entryErr == nil { entryErr = protocol.WriteMessage(commStream, protocol.MANIFEST, protocol.SerializeManifest([]protocol.ManifestEntry{ fileEntry })) }
+		if entryErr != nil {
+			conn.CloseWithError(common.INTERNAL_ERROR, entryErr.Error())
+			return entryErr
+		}
+
+		record.Entries = 1
+		listLogger.Debug("manifest sent", logger.F("entries", 1))
+		return nil
+	}
+
+	if ! rootStat.IsDir() {
+		conn.CloseWithError(common.INTERNAL_ERROR, ErrNotDirectory.Error())
+		return ErrNotDirectory
+	}
+
+	totalEntries := 0
+	batch := make([]protocol.ManifestEntry, 0, MANIFEST_BATCH_SIZE)
+	flush := func() error {
+		if len(batch) == 0 { return nil }
+
+		writeErr := protocol.WriteMessage(commStream, protocol.MANIFEST, protocol.SerializeManifest(batch))
+		if writeErr != nil { return writeErr }
+
+		totalEntries += len(batch)
+		record.Entries = totalEntries
+		batch = batch[:0]
+		return nil
+	}
+
+	walkErr := filter.Walk(root, treeFilter, func(relPath string, info fs.FileInfo) error {
+		if ! info.IsDir() && ! info.Mode().IsRegular() { return nil }
+		if info.Mode().IsRegular() && strings.HasSuffix(relPath, common.MD5_SUFFIX) { return nil }
+
+		entry, entryErr := manifestEntry(filepath.Join(root, filepath.FromSlash(relPath)), relPath, info)
+		if entryErr != nil {
+			listLogger.Warn("skipping file without md5", logger.F("file", relPath), logger.Err(entryErr))
+			return nil
+		}
+
+		batch = append(batch, entry)
+		if len(batch) < MANIFEST_BATCH_SIZE { return nil }
+		return flush()
+	})
+
+	if walkErr == nil { walkErr = flush() }
+	if walkErr != nil {
+		conn.CloseWithError(common.INTERNAL_ERROR, walkErr.Error())
+		return walkErr
+	}
+
+	listLogger.Debug("manifest sent", logger.F("entries", totalEntries))
+	return nil
+}
+
+// manifestEntry
+//	Describe a file or directory for the manifest. Files carry their size and the md5 from their md5 file, which must exist.
+func manifestEntry(fullPath, relPath string, info fs.FileInfo) (protocol.ManifestEntry, error) {
+	entry := protocol.ManifestEntry{ 
+		Path: relPath, 
+		ModTime: info.ModTime().UnixNano(), 
+		Mode: uint32(info.Mode()),
+	}
+
+	if ! info.Mode().IsRegular() { return entry, nil }
+
+	fileMd5, getMd5Err := md5.ReadMD5FromFile(fullPath + common.MD5_SUFFIX)
+	if getMd5Err != nil { return entry, getMd5Err }
+
+	entry.Size = uint64(info.Size())
+	entry.Md5 = fileMd5
+	return entry, nil
+}
+
+
+var ErrNotDirectory = errors.New("path is not a directory")
@@ -0,0 +1,180 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+
+	"github.com/sirgallo/quicfiletransfer/common/metrics"
+)
+
+
+//============================================= Server Metrics
+
+
+// Metrics
+//	The registry holding the server's metrics, which can be served for scraping with its Handler.
+//	Metrics are always collected, since updating them costs little more than an atomic add, and embedders may register their own metrics alongside them.
+func (srv *QuicServer) Metrics() *metrics.Registry {
+	return srv.metrics.registry
+}
+
+// newServerMetrics
+//	Register every server metric on a new registry.
+func newServerMetrics() *serverMetrics {
+	registry := metrics.NewRegistry()
+
+	return &serverMetrics{
+		registry: registry,
+		connectionsActive: registry.NewGauge(METRIC_PREFIX + "connections_active", "Connections currently open.").With(),
+		connections: registry.NewCounter(METRIC_PREFIX + "connections_total", "Connections accepted.").With(),
+		handshakes: registry.NewCounter(METRIC_PREFIX + "handshakes_total", "Completed handshakes, by whether 0-RTT data was accepted.", "zero_rtt"),
+		handshakeDuration: registry.NewHistogram(
+			METRIC_PREFIX + "handshake_duration_seconds",
+			"Time from the first packet of a connection until its handshake completed.",
+			metrics.ExponentialBuckets(HANDSHAKE_BUCKET_START, 2, HANDSHAKE_BUCKET_COUNT),
+		).With(),
+		connectionErrors: registry.NewCounter(
+			METRIC_PREFIX + "connection_errors_total",
+			"Connections closed with an error, by error code and whether the server (local) or client (remote) closed them.",
+			"code", "origin",
+		),
+		transfersActive: registry.NewGauge(METRIC_PREFIX + "transfers_active", "File transfers currently in progress.").With(),
+		transfers: registry.NewCounter(METRIC_PREFIX + "transfers_total", "File transfers finished, by result.", "result"),
+		sentBytes: registry.NewCounter(METRIC_PREFIX + "sent_bytes_total", "Bytes written to data streams, including chunk headers, by export and client identity.", "export", "client"),
+		streamThroughput: registry.NewHistogram(
+			METRIC_PREFIX + "stream_throughput_bytes_per_second",
+			"Average throughput of each data stream over its lifetime.",
+			metrics.ExponentialBuckets(THROUGHPUT_BUCKET_START, 2, THROUGHPUT_BUCKET_COUNT),
+		).With(),
+	}
+}
+
+// tracer
+//	A connection tracer that observes how long the handshake takes.
+//	The tracer is created as the first packet of a connection arrives, and the server drops its handshake keys once the handshake completes.
+func (m *serverMetrics) tracer(ctx context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+	started := time.Now()
+
+	return &logging.ConnectionTracer{
+		DroppedEncryptionLevel: func(level logging.EncryptionLevel) {
+			if level == logging.EncryptionHandshake { m.handshakeDuration.Observe(time.Since(started).Seconds()) }
+		},
+	}
+}
+
+// connectionOpened
+//	Count an accepted connection, then wait in the background for its handshake to count whether 0-RTT was accepted.
+func (m *serverMetrics) connectionOpened(conn quic.EarlyConnection) {
+	m.connections.Inc()
+	m.connectionsActive.Inc()
+
+	go func() {
+		select {
+			case <-conn.HandshakeComplete():
+				m.handshakes.With(strconv.FormatBool(conn.ConnectionState().Used0RTT)).Inc()
+			case <-conn.Context().Done():
+		}
+	}()
+}
+
+// connectionClosed
+//	Count a connection once its handler exits, along with the error it was closed with, if any.
+func (m *serverMetrics) connectionClosed(conn quic.Connection) {
+	m.connectionsActive.Dec()
+
+	code, origin, failed := closeReason(context.Cause(conn.Context()))
+	if failed { m.connectionErrors.With(code, origin).Inc() }
+}
+
+// transferStarted
+//	Count a file transfer as in progress.
+func (m *serverMetrics) transferStarted() {
+	m.transfersActive.Inc()
+}
+
+// transferFinished
+//	Count a file transfer as finished, by its result: complete, failed or canceled.
+func (m *serverMetrics) transferFinished(result string) {
+	m.transfersActive.Dec()
+	m.transfers.With(result).Inc()
+}
+
+// streamFinished
+//	Observe the average throughput of a data stream once it closes. Streams that sent nothing are left out.
+func (m *serverMetrics) streamFinished(written uint64, elapsed time.Duration) {
+	if written == 0 || elapsed <= 0 { return }
+	m.streamThroughput.Observe(float64(written) / elapsed.Seconds())
+}
+
+// closeReason
+//	Classify the error a connection was closed with into an error code and the side that closed it.
+//	Connections closed with NO_ERROR, or not closed at all, are not failures.
+func closeReason(err error) (string, string, bool) {
+	var appErr *quic.ApplicationError
+	var transportErr *quic.TransportError
+	var idleErr *quic.IdleTimeoutError
+	var handshakeErr *quic.HandshakeTimeoutError
+	var resetErr *quic.StatelessResetError
+
+	switch {
+		case err == nil:
+			return "", "", false
+		case errors.As(err, &appErr):
+			if appErr.ErrorCode == 0 { return "", "", false }
+			return applicationErrorName(appErr.ErrorCode), errorOrigin(appErr.Remote), true
+		case errors.As(err, &transportErr):
+			if transportErr.ErrorCode == quic.NoError { return "", "", false }
+			return strings.ToLower(transportErr.ErrorCode.String()), errorOrigin(transportErr.Remote), true
+		case errors.As(err, &idleErr):
+			return "idle_timeout", ORIGIN_LOCAL, true
+		case errors.As(err, &handshakeErr):
+			return "handshake_timeout", ORIGIN_LOCAL, true
+		case errors.As(err, &resetErr):
+			return "stateless_reset", ORIGIN_REMOTE, true
+		default:
+			return "unknown", ORIGIN_LOCAL, true
+	}
+}
+
+// applicationErrorName
+//	The name of an application error code, or the code itself if it is not one of ours.
+func applicationErrorName(code quic.ApplicationErrorCode) string {
+	name, ok := applicationErrorNames[code]
+	if ! ok { return strconv.FormatUint(uint64(code), 10) }
+
+	return name
+}
+
+// errorOrigin
+//	The label for the side that closed a connection.
+func errorOrigin(remote bool) string {
+	if remote { return ORIGIN_REMOTE }
+	return ORIGIN_LOCAL
+}
+
+
+//============================================= Metered Writer
+
+
+// newMeteredWriter
+//	Wrap a writer so every byte written to it is added to the counter.
+func newMeteredWriter(w io.Writer, sent *metrics.Counter) *meteredWriter {
+	return &meteredWriter{ w: w, sent: sent }
+}
+
+// Write
+//	Write to the underlying writer, counting the bytes that were written.
+func (mw *meteredWriter) Write(p []byte) (int, error) {
+	n, writeErr := mw.w.Write(p)
+	mw.written += uint64(n)
+	mw.sent.Add(uint64(n))
+
+	return n, writeErr
+}
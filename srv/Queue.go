@@ -0,0 +1,58 @@
+package srv
+
+import "github.com/sirgallo/quicfiletransfer/common/protocol"
+
+
+//============================================= Work Queue
+
+
+// newWorkQueue
+//	Divide the requested ranges into work units of at most unitSize bytes.
+//	Units are cut on multiples of unitSize within the file so that units from different ranges line up on the same boundaries.
+func newWorkQueue(ranges []protocol.Range, unitSize uint64) *workQueue {
+	var units []protocol.Range
+	for _, r := range ranges {
+		offset := r.Offset
+		end := r.Offset + r.Length
+		
+		for offset < end {
+			unitEnd := (offset / unitSize + 1) * unitSize
+			if unitEnd > end { unitEnd = end }
+
+			units = append(units, protocol.Range{ Offset: offset, Length: unitEnd - offset })
+			offset = unitEnd
+		}
+	}
+
+	return &workQueue{ units: units }
+}
+
+// next
+//	Pull the next work unit off of the queue.
+//	Streams pull units as they finish their current one, so faster streams take on more of the file.
+func (queue *workQueue) next() (protocol.Range, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.position >= len(queue.units) { return protocol.Range{}, false }
+
+	unit := queue.units[queue.position]
+	queue.position++
+	
+	return unit, true
+}
+
+// size
+//	The total number of work units in the queue.
+func (queue *workQueue) size() int {
+	return len(queue.units)
+}
+
+// remaining
+//	The number of work units that have not yet been pulled from the queue.
+func (queue *workQueue) remaining() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	return len(queue.units) - queue.position
+}
@@ -0,0 +1,86 @@
+package srv
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+func unit(offset, length uint64) protocol.Range { return protocol.Range{ Offset: offset, Length: length } }
+
+
+func TestWorkQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		ranges []protocol.Range
+		unitSize uint64
+		units []protocol.Range
+	}{
+		{ "empty request", nil, 10, nil },
+		{ "empty range", []protocol.Range{ unit(5, 0) }, 10, nil },
+		{ "smaller than a unit", []protocol.Range{ unit(0, 7) }, 10, []protocol.Range{ unit(0, 7) } },
+		{ "exact multiple", []protocol.Range{ unit(0, 30) }, 10, []protocol.Range{ unit(0, 10), unit(10, 10), unit(20, 10) } },
+		{ "short last unit", []protocol.Range{ unit(0, 25) }, 10, []protocol.Range{ unit(0, 10), unit(10, 10), unit(20, 5) } },
+		{ "re-requested range starts mid unit", []protocol.Range{ unit(13, 20) }, 10, []protocol.Range{ unit(13, 7), unit(20, 10), unit(30, 3) } },
+		{ "re-requested ranges keep request order", []protocol.Range{ unit(42, 3), unit(5, 10) }, 10, []protocol.Range{ unit(42, 3), unit(5, 5), unit(10, 5) } },
+		{ "ranges within one unit stay separate", []protocol.Range{ unit(0, 2), unit(4, 2) }, 10, []protocol.Range{ unit(0, 2), unit(4, 2) } },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := newWorkQueue(test.ranges, test.unitSize)
+			if queue.size() != len(test.units) { t.Fatalf("expected %d units, got %d", len(test.units), queue.size()) }
+
+			var pulled []protocol.Range
+			for {
+				u, ok := queue.next()
+				if ! ok { break }
+
+				pulled = append(pulled, u)
+				if queue.remaining() != len(test.units) - len(pulled) { t.Errorf("expected %d remaining, got %d", len(test.units) - len(pulled), queue.remaining()) }
+			}
+
+			if ! reflect.DeepEqual(pulled, test.units) { t.Errorf("expected %v, got %v", test.units, pulled) }
+			if _, ok := queue.next(); ok { t.Error("expected an empty queue to stay empty") }
+		})
+	}
+}
+
+func TestWorkQueueConcurrentStreams(t *testing.T) {
+	const fileSize = 1000
+	queue := newWorkQueue([]protocol.Range{ unit(0, fileSize) }, 7)
+
+	var mu sync.Mutex
+	var pulled []protocol.Range
+	var wg sync.WaitGroup
+	for s := 0; s < 8; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				u, ok := queue.next()
+				if ! ok { return }
+
+				mu.Lock()
+				pulled = append(pulled, u)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	if len(pulled) != queue.size() { t.Fatalf("expected %d units, got %d", queue.size(), len(pulled)) }
+
+	sort.Slice(pulled, func(i, j int) bool { return pulled[i].Offset < pulled[j].Offset })
+	cursor := uint64(0)
+	for _, u := range pulled {
+		if u.Offset != cursor { t.Fatalf("expected a unit at %d, got %v", cursor, u) }
+		cursor += u.Length
+	}
+
+	if cursor != fileSize { t.Errorf("expected units to cover %d bytes, got %d", fileSize, cursor) }
+}
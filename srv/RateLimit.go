@@ -0,0 +1,149 @@
+package srv
+
+import (
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/ratelimit"
+)
+
+
+//============================================= Server Rate Limits
+
+
+// SetRateLimits
+//	Change the bandwidth limits for the server at runtime. The new limits apply to every open connection and client.
+//	While a scheduled window is active, its global limit takes precedence, and this one applies again once it ends.
+func (srv *QuicServer) SetRateLimits(limits RateLimits) {
+	srv.limiters.set(limits)
+	srv.logger.Info("rate limits updated", 
+		logger.F("global", limits.Global), 
+		logger.F("perConnection", limits.PerConnection), 
+		logger.F("perClient", limits.PerClient),
+	)
+}
+
+// RateLimits
+//	The bandwidth limits currently in effect for the server, including any scheduled window.
+func (srv *QuicServer) RateLimits() RateLimits {
+	srv.limiters.mu.Lock()
+	defer srv.limiters.mu.Unlock()
+
+	return srv.limiters.limits
+}
+
+// RateStatus
+//	The rate limits in effect along with the limits set with SetRateLimits, which differ while a scheduled window is active.
+func (srv *QuicServer) RateStatus() RateStatus {
+	srv.limiters.mu.Lock()
+	defer srv.limiters.mu.Unlock()
+
+	active := activeWindow(srv.limiters.schedule, time.Now()) != nil
+	return RateStatus{ Current: srv.limiters.limits, Base: srv.limiters.base, WindowActive: active }
+}
+
+// newRateLimiters
+//	Create the global limiter. Connection and client limiters are created as connections are accepted.
+func newRateLimiters(limits RateLimits, schedule []RateWindow) *rateLimiters {
+	rl := &rateLimiters{
+		base: limits,
+		schedule: schedule,
+		global: ratelimit.NewLimiter(0),
+		connections: make(map[uint64]*ratelimit.Limiter),
+		clients: make(map[string]*clientLimiter),
+	}
+
+	rl.apply(time.Now())
+	return rl
+}
+
+// acquire
+//	Create the limiter for a new connection and take a reference on the limiter for its client,
+//	returning every limiter that data sent on the connection must wait on.
+func (rl *rateLimiters) acquire(connID uint64, client string) []*ratelimit.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	connLimiter := ratelimit.NewLimiter(rl.limits.PerConnection)
+	rl.connections[connID] = connLimiter
+
+	cl, ok := rl.clients[client]
+	if ! ok {
+		cl = &clientLimiter{ limiter: ratelimit.NewLimiter(rl.limits.PerClient) }
+		rl.clients[client] = cl
+	}
+
+	cl.connections++
+	return []*ratelimit.Limiter{ rl.global, connLimiter, cl.limiter }
+}
+
+// release
+//	Remove the limiter for a closed connection. The client limiter is removed once the client has no open connections.
+func (rl *rateLimiters) release(connID uint64, client string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	delete(rl.connections, connID)
+
+	cl, ok := rl.clients[client]
+	if ! ok { return }
+
+	cl.connections--
+	if cl.connections <= 0 { delete(rl.clients, client) }
+}
+
+// set
+//	Replace the limits that apply outside of scheduled windows.
+func (rl *rateLimiters) set(limits RateLimits) {
+	rl.mu.Lock()
+	rl.base = limits
+	rl.mu.Unlock()
+
+	rl.apply(time.Now())
+}
+
+// setSchedule
+//	Replace the scheduled windows. The limits in effect are updated on the next check of the schedule.
+func (rl *rateLimiters) setSchedule(schedule []RateWindow) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.schedule = schedule
+}
+
+// apply
+//	Determine the limits in effect at the given time and, if they changed, apply them to every existing limiter.
+//	Returns true if the limits changed.
+func (rl *rateLimiters) apply(now time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	limits := rl.base
+	if window := activeWindow(rl.schedule, now); window != nil { limits.Global = window.Global }
+	if limits == rl.limits { return false }
+
+	rl.limits = limits
+	rl.global.SetRate(limits.Global)
+	for _, connLimiter := range rl.connections { connLimiter.SetRate(limits.PerConnection) }
+	for _, cl := range rl.clients { cl.limiter.SetRate(limits.PerClient) }
+
+	return true
+}
+
+// clientIdentity
+//	Identify the client for per client limits.
+//	If the client presented a certificate that the server verified, its common name is used. Otherwise, the remote ip is used.
+//	The certificate is only verified once the handshake completes, so this must not be called before then.
+func clientIdentity(conn quic.Connection) string {
+	verifiedChains := conn.ConnectionState().TLS.VerifiedChains
+	if len(verifiedChains) > 0 && len(verifiedChains[0]) > 0 && verifiedChains[0][0].Subject.CommonName != "" {
+		return CLIENT_CN_PREFIX + verifiedChains[0][0].Subject.CommonName
+	}
+
+	host, _, splitErr := net.SplitHostPort(conn.RemoteAddr().String())
+	if splitErr != nil { return CLIENT_IP_PREFIX + conn.RemoteAddr().String() }
+	return CLIENT_IP_PREFIX + host
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package srv
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+
+// adviseReadahead
+//	Hint to the kernel that the range a stream is about to send will be needed soon, so it begins reading it into the page cache asynchronously.
+//	The hint is best effort, so errors are ignored.
+func adviseReadahead(f *os.File, offset, length uint64) {
+	unix.Fadvise(int(f.Fd()), int64(offset), int64(length), unix.FADV_WILLNEED)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package srv
+
+import "os"
+
+
+// adviseReadahead
+//	Readahead hints are only supported on linux. Elsewhere this is a no-op.
+func adviseReadahead(f *os.File, offset, length uint64) {}
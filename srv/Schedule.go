@@ -0,0 +1,173 @@
+package srv
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+)
+
+
+//============================================= Server Rate Schedule
+
+
+// ParseRateSchedule
+//	Parse a schedule of rate windows, separated by semicolons. Each window has the format:
+//		[days] HH:MM-HH:MM MB
+//	where days is an optional comma separated list of days or day ranges (mon-fri,sun), and MB is the global limit in MB per second (0 is unlimited).
+//	The per connection and per client limits are not part of a window, so they stay in effect while it is active.
+//	For example, "mon-fri 09:00-17:00 100; 22:00-06:00 0".
+func ParseRateSchedule(spec string) ([]RateWindow, error) {
+	var schedule []RateWindow
+	for _, windowSpec := range strings.Split(spec, ";") {
+		fields := strings.Fields(windowSpec)
+		if len(fields) == 0 { continue }
+		if len(fields) < 2 || len(fields) > 3 { return nil, ErrInvalidRateWindow }
+
+		window := RateWindow{}
+		if len(fields) == 3 {
+			days, parseDaysErr := parseDays(fields[0])
+			if parseDaysErr != nil { return nil, parseDaysErr }
+
+			window.Days = days
+			fields = fields[1:]
+		}
+
+		bounds := strings.Split(fields[0], "-")
+		if len(bounds) != 2 { return nil, ErrInvalidRateWindow }
+
+		start, parseStartErr := parseTimeOfDay(bounds[0])
+		if parseStartErr != nil { return nil, parseStartErr }
+
+		end, parseEndErr := parseTimeOfDay(bounds[1])
+		if parseEndErr != nil { return nil, parseEndErr }
+		if start == end { return nil, ErrEmptyRateWindow }
+
+		rateMB, parseRateErr := strconv.ParseFloat(fields[1], 64)
+		if parseRateErr != nil || rateMB < 0 { return nil, ErrInvalidRateWindow }
+
+		window.Start = start
+		window.End = end
+		window.Global = int64(rateMB * 1024 * 1024)
+		schedule = append(schedule, window)
+	}
+
+	return schedule, nil
+}
+
+// runRateSchedule
+//	Check the schedule continuously, so transfers already in progress speed up or slow down as windows begin and end.
+//	Returns when stop is closed.
+func (srv *QuicServer) runRateSchedule(stop <-chan struct{}) {
+	ticker := time.NewTicker(RATE_SCHEDULE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				if srv.limiters.apply(now) {
+					limits := srv.RateLimits()
+					srv.logger.Info("scheduled rate limits applied", 
+						logger.F("global", limits.Global), 
+						logger.F("perConnection", limits.PerConnection), 
+						logger.F("perClient", limits.PerClient),
+					)
+				}
+		}
+	}
+}
+
+// activeWindow
+//	The first window in the schedule active at the given time, or nil if none are.
+//	A window that runs past midnight is active after midnight if it started on the previous day.
+//	The time of day is read from the clock rather than measured from midnight, so windows keep to wall time on days with a daylight saving change.
+func activeWindow(schedule []RateWindow, now time.Time) *RateWindow {
+	sinceMidnight := time.Duration(now.Hour()) * time.Hour + time.Duration(now.Minute()) * time.Minute + time.Duration(now.Second()) * time.Second
+	yesterday := (now.Weekday() + 6) % 7
+
+	for idx := range schedule {
+		window := &schedule[idx]
+		switch {
+			case window.Start <= window.End:
+				if sinceMidnight >= window.Start && sinceMidnight < window.End && window.onDay(now.Weekday()) { return window }
+			case sinceMidnight >= window.Start:
+				if window.onDay(now.Weekday()) { return window }
+			case sinceMidnight < window.End:
+				if window.onDay(yesterday) { return window }
+		}
+	}
+
+	return nil
+}
+
+// onDay
+//	Whether the window starts on the given day.
+func (window *RateWindow) onDay(day time.Weekday) bool {
+	if len(window.Days) == 0 { return true }
+	for _, d := range window.Days {
+		if d == day { return true }
+	}
+
+	return false
+}
+
+// parseDays
+//	Parse a comma separated list of days or day ranges, like mon-fri,sun.
+func parseDays(spec string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 { return nil, ErrInvalidRateWindow }
+
+		first, parseFirstErr := parseDay(bounds[0])
+		if parseFirstErr != nil { return nil, parseFirstErr }
+
+		last := first
+		if len(bounds) == 2 {
+			var parseLastErr error
+			last, parseLastErr = parseDay(bounds[1])
+			if parseLastErr != nil { return nil, parseLastErr }
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == last { break }
+		}
+	}
+
+	return days, nil
+}
+
+// parseDay
+//	Parse the three letter abbreviation of a day.
+func parseDay(spec string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(spec, day.String()[:3]) { return day, nil }
+	}
+
+	return time.Sunday, ErrInvalidRateWindow
+}
+
+// parseTimeOfDay
+//	Parse HH:MM into the offset from midnight. 24:00 is allowed as the end of the day.
+func parseTimeOfDay(spec string) (time.Duration, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 { return 0, ErrInvalidRateWindow }
+
+	hours, parseHoursErr := strconv.Atoi(parts[0])
+	if parseHoursErr != nil { return 0, ErrInvalidRateWindow }
+
+	minutes, parseMinutesErr := strconv.Atoi(parts[1])
+	if parseMinutesErr != nil || minutes < 0 || minutes > 59 { return 0, ErrInvalidRateWindow }
+	if hours < 0 || hours > 24 || (hours == 24 && minutes != 0) { return 0, ErrInvalidRateWindow }
+
+	return time.Duration(hours) * time.Hour + time.Duration(minutes) * time.Minute, nil
+}
+
+
+var ErrInvalidRateWindow = errors.New("invalid rate window, expected [days] HH:MM-HH:MM MB")
+var ErrEmptyRateWindow = errors.New("rate window cannot start and end at the same time")
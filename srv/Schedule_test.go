@@ -0,0 +1,127 @@
+package srv
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+
+// at: a local time in the week starting Sunday, October 18 2026
+func at(day time.Weekday, hours, minutes int) time.Time {
+	return time.Date(2026, time.October, 18 + int(day), hours, minutes, 0, 0, time.Local)
+}
+
+func window(days []time.Weekday, start, end time.Duration, global int64) RateWindow {
+	return RateWindow{ Days: days, Start: start, End: end, Global: global }
+}
+
+func weekdays() []time.Weekday {
+	return []time.Weekday{ time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday }
+}
+
+
+func TestParseRateSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		expected []RateWindow
+		err error
+	}{
+		{ "empty", "", nil, nil },
+		{ "every day", "09:00-17:00 100", []RateWindow{ window(nil, 9 * time.Hour, 17 * time.Hour, 100 * MB) }, nil },
+		{ "weekday range", "mon-fri 09:00-17:00 1.5", []RateWindow{ window(weekdays(), 9 * time.Hour, 17 * time.Hour, 1.5 * MB) }, nil },
+		{ "day range wraps the week", "fri-mon 01:00-02:00 1", []RateWindow{
+			window([]time.Weekday{ time.Friday, time.Saturday, time.Sunday, time.Monday }, time.Hour, 2 * time.Hour, MB),
+		}, nil },
+		{ "day list", "sat,SUN 00:00-24:00 0", []RateWindow{ window([]time.Weekday{ time.Saturday, time.Sunday }, 0, 24 * time.Hour, 0) }, nil },
+		{ "crosses midnight", "22:00-06:30 0", []RateWindow{ window(nil, 22 * time.Hour, 6 * time.Hour + 30 * time.Minute, 0) }, nil },
+		{ "several windows", "mon-fri 09:00-17:00 100; 22:00-06:00 0;", []RateWindow{
+			window(weekdays(), 9 * time.Hour, 17 * time.Hour, 100 * MB),
+			window(nil, 22 * time.Hour, 6 * time.Hour, 0),
+		}, nil },
+		{ "start equals end", "09:00-09:00 10", nil, ErrEmptyRateWindow },
+		{ "midnight to midnight", "00:00-00:00 10", nil, ErrEmptyRateWindow },
+		{ "missing rate", "09:00-17:00", nil, ErrInvalidRateWindow },
+		{ "too many fields", "mon 09:00-17:00 10 20", nil, ErrInvalidRateWindow },
+		{ "negative rate", "09:00-17:00 -1", nil, ErrInvalidRateWindow },
+		{ "unknown day", "funday 09:00-17:00 10", nil, ErrInvalidRateWindow },
+		{ "bad minutes", "09:60-17:00 10", nil, ErrInvalidRateWindow },
+		{ "past the end of the day", "09:00-24:01 10", nil, ErrInvalidRateWindow },
+		{ "missing end", "09:00 10", nil, ErrInvalidRateWindow },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseRateSchedule(test.spec)
+			if ! errors.Is(err, test.err) { t.Fatalf("expected error %v, got %v", test.err, err) }
+			if ! reflect.DeepEqual(schedule, test.expected) { t.Errorf("expected %+v, got %+v", test.expected, schedule) }
+		})
+	}
+}
+
+func TestActiveWindow(t *testing.T) {
+	schedule, parseErr := ParseRateSchedule("mon-fri 09:00-17:00 100; fri 22:00-06:00 5; 23:00-01:00 1")
+	if parseErr != nil { t.Fatal(parseErr) }
+
+	tests := []struct {
+		name string
+		now time.Time
+		expected int
+	}{
+		{ "weekday inside", at(time.Wednesday, 12, 0), 0 },
+		{ "weekday at start", at(time.Monday, 9, 0), 0 },
+		{ "weekday at end", at(time.Monday, 17, 0), -1 },
+		{ "weekend outside weekday range", at(time.Saturday, 12, 0), -1 },
+		{ "overnight before midnight on its day", at(time.Friday, 22, 30), 1 },
+		{ "overnight after midnight on the next day", at(time.Saturday, 5, 59), 1 },
+		{ "overnight ends", at(time.Saturday, 6, 0), -1 },
+		{ "overnight not started on other days", at(time.Thursday, 22, 30), -1 },
+		{ "overnight after midnight started the wrong day", at(time.Friday, 3, 0), -1 },
+		{ "first window in order wins", at(time.Friday, 23, 30), 1 },
+		{ "every day overnight before midnight", at(time.Sunday, 23, 30), 2 },
+		{ "every day overnight after midnight", at(time.Monday, 0, 30), 2 },
+		{ "every day overnight ends", at(time.Monday, 1, 0), -1 },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window := activeWindow(schedule, test.now)
+			switch {
+				case test.expected < 0 && window != nil:
+					t.Errorf("expected no window, got %+v", *window)
+				case test.expected >= 0 && window != &schedule[test.expected]:
+					t.Errorf("expected window %d, got %v", test.expected, window)
+			}
+		})
+	}
+}
+
+func TestActiveWindowDaylightSaving(t *testing.T) {
+	location, loadErr := time.LoadLocation("America/New_York")
+	if loadErr != nil { t.Skipf("time zone data unavailable: %v", loadErr) }
+
+	schedule, parseErr := ParseRateSchedule("09:30-10:30 10")
+	if parseErr != nil { t.Fatal(parseErr) }
+
+	// clocks move forward at 2am, so 10:00 is only 9 hours after midnight
+	springForward := time.Date(2026, time.March, 8, 10, 0, 0, 0, location)
+	if activeWindow(schedule, springForward) == nil { t.Errorf("expected the window to be active at %v", springForward) }
+
+	// clocks move back at 2am, so 10:00 is 11 hours after midnight
+	fallBack := time.Date(2026, time.November, 1, 10, 0, 0, 0, location)
+	if activeWindow(schedule, fallBack) == nil { t.Errorf("expected the window to be active at %v", fallBack) }
+}
+
+func TestRateLimitersKeepBaseLimitsInWindow(t *testing.T) {
+	base := RateLimits{ Global: 50 * MB, PerConnection: 10 * MB, PerClient: 20 * MB }
+	rl := newRateLimiters(base, []RateWindow{ window(nil, 9 * time.Hour, 17 * time.Hour, 100 * MB) })
+
+	rl.apply(at(time.Monday, 12, 0))
+	expected := RateLimits{ Global: 100 * MB, PerConnection: 10 * MB, PerClient: 20 * MB }
+	if rl.limits != expected { t.Errorf("inside window expected %+v, got %+v", expected, rl.limits) }
+
+	rl.apply(at(time.Monday, 18, 0))
+	if rl.limits != base { t.Errorf("outside window expected %+v, got %+v", base, rl.limits) }
+}
@@ -3,11 +3,12 @@ package srv
 import ( 
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"net"
 	"os"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
@@ -15,6 +16,8 @@ import (
 	"github.com/quic-go/quic-go/qlog"
 
 	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/pool"
 )
 
 
@@ -23,26 +26,47 @@ import (
 
 // NewQuicServer
 //	Create the quic file transfer server.
-//	If tracer is enabled, a log of all events will be dumped to the directy the server is run in.
+//	If tracer is enabled, a log of all events will be dumped to the directy the server is run in. Handshakes are always traced for the server's metrics.
+//	With client CAs, clients may present certificates, which are verified and identify the client for exports and rate limits.
 func NewQuicServer(opts *QuicServerOpts) (*QuicServer, error) {
+	srvLogger := opts.Logger
+	if srvLogger == nil { srvLogger = logger.NewNopLogger() }
+
+	exports, resolveErr := resolveExports(opts.Exports)
+	if resolveErr != nil { return nil, resolveErr }
+
+	tuningErr := opts.Tuning.Validate()
+	if tuningErr != nil { return nil, tuningErr }
+
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{ *opts.TlsCert },
 		NextProtos: []string{ common.FTRANSFER_PROTO },
 	}
 
-	quicConfig := &quic.Config{ Allow0RTT: true, EnableDatagrams: true, KeepAlivePeriod: 3 * time.Second }
+	if opts.ClientCAs != nil {
+		tlsConfig.ClientCAs = opts.ClientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if opts.RequireClientCert { tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert }
+	}
+
+	srvMetrics := newServerMetrics()
+	quicConfig := &quic.Config{ Allow0RTT: true, EnableDatagrams: true, KeepAlivePeriod: DEFAULT_KEEP_ALIVE_PERIOD, Tracer: srvMetrics.tracer }
+	opts.Tuning.Apply(quicConfig)
 
 	if opts.EnableTracer {
-		log.Println("enable tracer:", opts.EnableTracer)
+		srvLogger.Info("tracer enabled")
 		tracer := func(ctx context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
 			role := "server"
 			if p == logging.PerspectiveClient { role = "client" }
 			
 			filename := fmt.Sprintf("./log_%s_%s.qlog", connID, role)
 			f, createErr := os.Create(filename)
-			if createErr != nil { log.Fatal(createErr) }
+			if createErr != nil { 
+				srvLogger.Error("unable to create tracer file", logger.F(logger.PATH_KEY, filename), logger.Err(createErr))
+				return srvMetrics.tracer(ctx, p, connID)
+			}
 			
-			return qlog.NewConnectionTracer(f, p, connID)
+			return logging.NewMultiplexedConnectionTracer(qlog.NewConnectionTracer(f, p, connID), srvMetrics.tracer(ctx, p, connID))
 		}
 
 		quicConfig.Tracer = tracer
@@ -51,39 +75,131 @@ func NewQuicServer(opts *QuicServerOpts) (*QuicServer, error) {
 	udpConn, udpErr := net.ListenUDP(common.NET_PROTOCOL, &net.UDPAddr{ IP: net.ParseIP(opts.Host), Port: opts.Port })
 	if udpErr != nil { return nil, udpErr }
 
-	tr := quic.Transport{ Conn: udpConn }
+	tr := &quic.Transport{ Conn: udpConn }
 	listener, listenQuicErr := tr.ListenEarly(tlsConfig, quicConfig)
-	if listenQuicErr != nil { return nil, listenQuicErr }
+	if listenQuicErr != nil {
+		udpConn.Close()
+		return nil, listenQuicErr
+	}
 
-	log.Printf("quic transport layer started for: %s\n", listener.Addr().String())
-	return &QuicServer{ host: opts.Host, port: opts.Port, listener: listener }, nil
+	srvLogger.Info("quic transport layer started", logger.F("addr", listener.Addr().String()))
+	maxStreamsPerConnection := opts.MaxStreamsPerConnection
+	if maxStreamsPerConnection <= 0 { maxStreamsPerConnection = DEFAULT_MAX_STREAMS_PER_CONNECTION }
+
+	maxStreamsPerRequest := opts.MaxStreamsPerRequest
+	if maxStreamsPerRequest <= 0 { maxStreamsPerRequest = DEFAULT_MAX_STREAMS_PER_REQUEST }
+	if maxStreamsPerRequest > maxStreamsPerConnection { maxStreamsPerRequest = maxStreamsPerConnection }
+	if maxStreamsPerRequest > math.MaxUint16 { maxStreamsPerRequest = math.MaxUint16 }
+
+	return &QuicServer{ 
+		transport: tr,
+		udpConn: udpConn,
+		host: opts.Host, 
+		port: opts.Port, 
+		listener: listener, 
+		logger: srvLogger,
+		maxStreamsPerConnection: maxStreamsPerConnection,
+		maxStreamsPerRequest: maxStreamsPerRequest,
+		bufferPool: pool.NewBufferPool(STREAM_CHUNK_BUFFER_SIZE),
+		limiters: newRateLimiters(opts.RateLimits, opts.RateSchedule),
+		exports: exports,
+		started: time.Now(),
+		conns: make(map[uint64]*trackedConn),
+		transfers: make(map[uint64]*activeTransfer),
+		ready: make(chan struct{}),
+		done: make(chan struct{}),
+		metrics: srvMetrics,
+		auditLog: opts.AuditLog,
+	}, nil
 }
 
 // Listen
 //	Begin accepting and processing connections from clients.
-//	This is asynchronous.
+//	This blocks until the server stops. After Shutdown or Close, ErrServerClosed is returned. Connections with requests still in flight during Shutdown may still be open when it returns.
+//	Transient accept errors are retried with backoff. If the listener fails for good, the server is closed and the error is returned.
 func (srv *QuicServer) Listen() error {
 	defer srv.listener.Close()
+
+	if ! srv.transition(SERVER_NEW, SERVER_SERVING) { return ErrServerClosed }
+
+	stopSchedule := make(chan struct{})
+	defer close(stopSchedule)
+	go srv.runRateSchedule(stopSchedule) // runs even without windows, so a schedule applied later takes effect
 	
-	var listenWG sync.WaitGroup
-	
-	listenWG.Add(1)
-	go func() {
-		defer listenWG.Done()
-		for {
-			conn, connErr := srv.listener.Accept(context.Background())
-			if connErr != nil { 
-				log.Println("connection error:", connErr.Error())
-				continue 
+	failures := 0
+	for {
+		conn, connErr := srv.listener.Accept(context.Background())
+		if connErr != nil { 
+			if srv.State() != SERVER_SERVING { return ErrServerClosed }
+
+			failures++
+			if isFatalAcceptError(connErr) || failures >= ACCEPT_MAX_FAILURES {
+				srv.logger.Error("listener failed, closing server", logger.F("failures", failures), logger.Err(connErr))
+				srv.Close()
+				return connErr
 			}
 
-			go func () {
-				handleErr := handleConnection(conn)
-				if handleErr != nil { log.Println("error on handler:", handleErr.Error()) }
-			}()
+			delay := acceptBackoff(failures)
+			srv.logger.Warn("accept failed, retrying", logger.F("failures", failures), logger.F("delay", delay), logger.Err(connErr))
+			time.Sleep(delay)
+			continue 
 		}
-	}()
 
-	listenWG.Wait()
-	return nil
-}
\ No newline at end of file
+		failures = 0
+		connID := atomic.AddUint64(&srv.connCounter, 1)
+		connLogger := srv.logger.With(
+			logger.F(logger.CONN_ID_KEY, connID),
+			logger.F(logger.REMOTE_ADDR_KEY, conn.RemoteAddr()),
+		)
+
+		srv.metrics.connectionOpened(conn)
+
+		go func () {
+			defer srv.metrics.connectionClosed(conn)
+
+			if ! awaitHandshake(conn) {
+				connLogger.Debug("connection closed before its handshake completed", logger.Err(context.Cause(conn.Context())))
+				return
+			}
+
+			client := clientIdentity(conn)
+			if ! srv.trackConnection(connID, conn, client) {
+				conn.CloseWithError(common.SHUTDOWN_ERROR, SHUTDOWN_REASON)
+				return
+			}
+
+			defer srv.untrackConnection(connID)
+
+			handleErr := srv.handleConnection(conn, connID, client, connLogger)
+			if handleErr != nil { connLogger.Debug("connection handler exited", logger.Err(handleErr)) }
+		}()
+	}
+}
+
+// awaitHandshake
+//	Wait for the handshake of an accepted connection to complete, returning false if the connection closes first.
+//	The listener accepts connections early, before the client certificate is received and verified, so clients can only be identified once this returns.
+func awaitHandshake(conn quic.EarlyConnection) bool {
+	select {
+		case <-conn.HandshakeComplete():
+			return true
+		case <-conn.Context().Done():
+			return false
+	}
+}
+
+// isFatalAcceptError
+//	Check whether an accept error means the listener is closed for good. Once closed, the listener returns the same error on every accept.
+func isFatalAcceptError(err error) bool {
+	return errors.Is(err, quic.ErrServerClosed) || errors.Is(err, net.ErrClosed)
+}
+
+// acceptBackoff
+//	The delay after consecutive accept failures, doubling from ACCEPT_INITIAL_BACKOFF up to ACCEPT_MAX_BACKOFF.
+func acceptBackoff(failures int) time.Duration {
+	delay := ACCEPT_INITIAL_BACKOFF
+	for attempt := 1; attempt < failures && delay < ACCEPT_MAX_BACKOFF; attempt++ { delay *= 2 }
+	if delay > ACCEPT_MAX_BACKOFF { delay = ACCEPT_MAX_BACKOFF }
+
+	return delay
+}
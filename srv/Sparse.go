@@ -0,0 +1,87 @@
+package srv
+
+import (
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+//============================================= Server Sparse
+
+
+// sparseExtents
+//	Find the data extents of a file so that its holes are never read or sent. Holes smaller than MIN_HOLE_SIZE are sent as data.
+//	Reports false if the file has no holes worth skipping, or too many extents to send in the file metadata, in which case the whole file is sent.
+func sparseExtents(file *os.File, size uint64, transferLogger logger.Logger) ([]protocol.Range, bool) {
+	if size == 0 { return nil, false }
+
+	extents, extentsErr := dataExtents(file, size)
+	if extentsErr != nil {
+		transferLogger.Debug("unable to find data extents, sending the whole file", logger.Err(extentsErr))
+		return nil, false
+	}
+
+	extents = mergeExtents(extents, MIN_HOLE_SIZE)
+	if len(extents) == 1 && extents[0].Offset == 0 && extents[0].Length == size { return nil, false }
+	if len(extents) > MAX_EXTENTS {
+		transferLogger.Debug("too many data extents, sending the whole file", logger.F("extents", len(extents)))
+		return nil, false
+	}
+
+	dataSize := uint64(0)
+	for _, extent := range extents { dataSize += extent.Length }
+	transferLogger.Debug("sparse file", logger.F("extents", len(extents)), logger.F("data", dataSize), logger.F("size", size))
+
+	return extents, true
+}
+
+// mergeExtents
+//	Merge extents separated by holes smaller than minHole. Extents are in order and do not overlap.
+func mergeExtents(extents []protocol.Range, minHole uint64) []protocol.Range {
+	var merged []protocol.Range
+	for _, extent := range extents {
+		if len(merged) > 0 {
+			last := &merged[len(merged) - 1]
+			lastEnd := last.Offset + last.Length
+			if extent.Offset - lastEnd < minHole {
+				last.Length = extent.Offset + extent.Length - last.Offset
+				continue
+			}
+		}
+
+		merged = append(merged, extent)
+	}
+
+	return merged
+}
+
+// intersectExtents
+//	Limit the requested ranges to the data extents of the file, dropping the holes.
+func intersectExtents(ranges, extents []protocol.Range) []protocol.Range {
+	var intersected []protocol.Range
+	for _, r := range ranges {
+		end := r.Offset + r.Length
+		first := sort.Search(len(extents), func(idx int) bool { return extents[idx].Offset + extents[idx].Length > r.Offset })
+
+		for _, extent := range extents[first:] {
+			if extent.Offset >= end { break }
+
+			start := extent.Offset
+			if r.Offset > start { start = r.Offset }
+
+			extentEnd := extent.Offset + extent.Length
+			if end < extentEnd { extentEnd = end }
+
+			intersected = append(intersected, protocol.Range{ Offset: start, Length: extentEnd - start })
+		}
+	}
+
+	return intersected
+}
+
+
+var errSparseUnsupported = errors.New("sparse files not supported on this platform")
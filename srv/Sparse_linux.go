@@ -0,0 +1,39 @@
+//go:build linux
+
+package srv
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+// dataExtents
+//	Walk the data extents of a file with SEEK_DATA and SEEK_HOLE. Seeking past the last extent fails with ENXIO, which ends the walk.
+//	The file offset is restored afterwards, although every read on the server is positional.
+func dataExtents(f *os.File, size uint64) ([]protocol.Range, error) {
+	defer f.Seek(0, io.SeekStart)
+
+	var extents []protocol.Range
+	offset := int64(0)
+	for offset < int64(size) {
+		dataStart, seekDataErr := f.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(seekDataErr, unix.ENXIO) { break }
+		if seekDataErr != nil { return nil, seekDataErr }
+
+		holeStart, seekHoleErr := f.Seek(dataStart, unix.SEEK_HOLE)
+		if seekHoleErr != nil { return nil, seekHoleErr }
+		if holeStart > int64(size) { holeStart = int64(size) }
+		if holeStart <= dataStart { break }
+
+		extents = append(extents, protocol.Range{ Offset: uint64(dataStart), Length: uint64(holeStart - dataStart) })
+		offset = holeStart
+	}
+
+	return extents, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package srv
+
+import (
+	"os"
+
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+)
+
+
+// dataExtents
+//	SEEK_DATA and SEEK_HOLE are only used on linux. Elsewhere every file is sent in full.
+func dataExtents(f *os.File, size uint64) ([]protocol.Range, error) {
+	return nil, errSparseUnsupported
+}
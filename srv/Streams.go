@@ -0,0 +1,230 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+
+//============================================= Transfer Streams
+
+
+// newTransferStreams
+//	Track the data streams serving a single transfer.
+//	Streams can be added and retired while the transfer is in progress, within the per request limit and the connection's budget.
+func newTransferStreams(budget *streamBudget, maxStreams int) *transferStreams {
+	streams := &transferStreams{ budget: budget, maxStreams: maxStreams }
+	streams.cond = sync.NewCond(&streams.mu)
+
+	return streams
+}
+
+// reserve
+//	Reserve slots for the initial data streams of the transfer.
+//	The request is capped at the per request limit, then blocks until the connection has at least one slot free.
+//	Returns the number of streams granted, which is negotiated back to the client.
+func (streams *transferStreams) reserve(ctx context.Context, requested int) (int, error) {
+	if requested > streams.maxStreams { requested = streams.maxStreams }
+	if requested < 1 { requested = 1 }
+
+	granted, acquireErr := streams.budget.acquire(ctx, requested)
+	if acquireErr != nil { return 0, acquireErr }
+
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	streams.reserved += granted
+	return granted, nil
+}
+
+// start
+//	Open a new data stream and run a worker for it, unless the transfer has already finished.
+//	Reserved slots are used first. Otherwise a slot is taken from the connection's budget if one is free and the transfer is under its limit.
+//	Opening blocks until the client allows another stream rather than failing at the client's stream limit.
+//	The worker is given its stream index, the stream, and a function to check whether it has been asked to retire.
+//	start is not safe to call concurrently for the same transfer.
+func (streams *transferStreams) start(conn quic.Connection, worker func(idx int, dataStream quic.SendStream, shouldRetire func() bool)) error {
+	streams.mu.Lock()
+
+	if streams.finished { 
+		streams.mu.Unlock()
+		return errTransferFinished 
+	}
+
+	switch {
+		case streams.reserved > 0:
+			streams.reserved--
+		case streams.active >= streams.maxStreams || ! streams.budget.tryAcquire():
+			streams.mu.Unlock()
+			return errStreamLimit
+	}
+
+	idx := streams.opened
+	streams.opened++
+	streams.active++
+	streams.mu.Unlock()
+
+	dataStream, openStreamErr := conn.OpenUniStreamSync(conn.Context())
+	if openStreamErr != nil { 
+		streams.mu.Lock()
+		streams.opened--
+		streams.releaseLocked()
+		streams.mu.Unlock()
+
+		return openStreamErr 
+	}
+
+	go func() {
+		retired := false
+		shouldRetire := func() bool {
+			retired = streams.claimRetire()
+			return retired
+		}
+
+		worker(idx, dataStream, shouldRetire)
+		if ! retired { streams.release() }
+	}()
+
+	return nil
+}
+
+// retire
+//	Request that n data streams close once they finish their current work unit.
+//	At least one stream always remains active so the transfer can complete.
+func (streams *transferStreams) retire(n int) {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	streams.pendingRetire += n
+}
+
+// claimRetire
+//	Called by a worker between work units. If a retire request is pending and this is not the last active stream, the worker retires.
+func (streams *transferStreams) claimRetire() bool {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	if streams.pendingRetire == 0 || streams.active <= 1 { return false }
+
+	streams.pendingRetire--
+	streams.releaseLocked()
+
+	return true
+}
+
+// release
+//	Mark a worker as finished, returning its slot to the connection's budget.
+func (streams *transferStreams) release() {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	streams.releaseLocked()
+}
+
+func (streams *transferStreams) releaseLocked() {
+	streams.active--
+	streams.budget.release(1)
+	streams.cond.Broadcast()
+}
+
+// activeStreams
+//	The number of data streams currently sending.
+func (streams *transferStreams) activeStreams() int {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	return streams.active
+}
+
+// wait
+//	Block until every worker has finished, then prevent new workers from starting.
+//	Any reserved slots that were never used are returned to the connection's budget.
+//	Returns the total number of data streams opened for the transfer.
+func (streams *transferStreams) wait() int {
+	streams.mu.Lock()
+	defer streams.mu.Unlock()
+
+	for streams.active > 0 { streams.cond.Wait() }
+	streams.finished = true
+
+	streams.budget.release(streams.reserved)
+	streams.reserved = 0
+
+	return streams.opened
+}
+
+
+//============================================= Stream Budget
+
+
+// newStreamBudget
+//	Create the budget for a connection with the given number of data stream slots.
+func newStreamBudget(limit int) *streamBudget {
+	budget := &streamBudget{ available: limit }
+	budget.cond = sync.NewCond(&budget.mu)
+
+	return budget
+}
+
+// acquire
+//	Block until at least one slot is free, then take up to want slots.
+//	Returns early with an error if the context is cancelled, for example when the connection closes.
+func (budget *streamBudget) acquire(ctx context.Context, want int) (int, error) {
+	acquired := make(chan struct{})
+	defer close(acquired)
+
+	go func() {
+		select {
+			case <-ctx.Done():
+				budget.mu.Lock()
+				defer budget.mu.Unlock()
+				budget.cond.Broadcast()
+			case <-acquired:
+		}
+	}()
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	for budget.available == 0 {
+		if ctx.Err() != nil { return 0, ctx.Err() }
+		budget.cond.Wait()
+	}
+
+	granted := want
+	if granted > budget.available { granted = budget.available }
+	budget.available -= granted
+
+	return granted, nil
+}
+
+// tryAcquire
+//	Take a single slot if one is free, without blocking.
+func (budget *streamBudget) tryAcquire() bool {
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	if budget.available == 0 { return false }
+
+	budget.available--
+	return true
+}
+
+// release
+//	Return slots to the budget, waking any transfers waiting for one.
+func (budget *streamBudget) release(n int) {
+	if n == 0 { return }
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	budget.available += n
+	budget.cond.Broadcast()
+}
+
+
+var errTransferFinished = errors.New("transfer already finished")
+var errStreamLimit = errors.New("stream limit reached")
@@ -0,0 +1,102 @@
+package srv
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+
+func TestStreamBudgetAcquire(t *testing.T) {
+	tests := []struct {
+		name string
+		limit int
+		wants []int
+		granted []int
+		available int
+	}{
+		{ "grants what is wanted", 10, []int{ 4 }, []int{ 4 }, 6 },
+		{ "grants up to the limit", 10, []int{ 16 }, []int{ 10 }, 0 },
+		{ "later requests get what is left", 10, []int{ 6, 6 }, []int{ 6, 4 }, 0 },
+		{ "exact fit", 8, []int{ 3, 5 }, []int{ 3, 5 }, 0 },
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			budget := newStreamBudget(test.limit)
+			for idx, want := range test.wants {
+				granted, acquireErr := budget.acquire(context.Background(), want)
+				if acquireErr != nil { t.Fatal(acquireErr) }
+				if granted != test.granted[idx] { t.Errorf("request %d: expected %d granted, got %d", idx, test.granted[idx], granted) }
+			}
+
+			if budget.available != test.available { t.Errorf("expected %d available, got %d", test.available, budget.available) }
+		})
+	}
+}
+
+func TestStreamBudgetTryAcquire(t *testing.T) {
+	budget := newStreamBudget(2)
+	for idx, expected := range []bool{ true, true, false } {
+		if budget.tryAcquire() != expected { t.Errorf("attempt %d: expected %v", idx, expected) }
+	}
+
+	budget.release(1)
+	if ! budget.tryAcquire() { t.Error("expected a released slot to be acquired") }
+	if budget.tryAcquire() { t.Error("expected the budget to be exhausted again") }
+
+	budget.release(0)
+	if budget.available != 0 { t.Errorf("expected releasing nothing to leave the budget empty, got %d", budget.available) }
+}
+
+func TestStreamBudgetAcquireWaitsForRelease(t *testing.T) {
+	budget := newStreamBudget(3)
+	budget.acquire(context.Background(), 3)
+
+	granted := make(chan int)
+	go func() {
+		n, _ := budget.acquire(context.Background(), 3)
+		granted <- n
+	}()
+
+	select {
+		case n := <-granted:
+			t.Fatalf("expected acquire to block on an exhausted budget, got %d", n)
+		case <-time.After(50 * time.Millisecond):
+	}
+
+	budget.release(2)
+	select {
+		case n := <-granted:
+			if n != 2 { t.Errorf("expected the 2 released slots, got %d", n) }
+		case <-time.After(time.Second):
+			t.Fatal("expected acquire to return once slots were released")
+	}
+}
+
+func TestStreamBudgetAcquireCanceled(t *testing.T) {
+	budget := newStreamBudget(1)
+	budget.acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		_, acquireErr := budget.acquire(ctx, 1)
+		result <- acquireErr
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+		case acquireErr := <-result:
+			if acquireErr != context.Canceled { t.Errorf("expected %v, got %v", context.Canceled, acquireErr) }
+		case <-time.After(time.Second):
+			t.Fatal("expected acquire to return once the context was canceled")
+	}
+
+	if budget.available != 0 { t.Errorf("expected a canceled acquire to take nothing, got %d available", budget.available) }
+
+	_, canceledErr := budget.acquire(ctx, 1)
+	if canceledErr != context.Canceled { t.Errorf("expected an already canceled context to fail, got %v", canceledErr) }
+}
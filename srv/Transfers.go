@@ -0,0 +1,142 @@
+package srv
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+)
+
+
+//============================================= Server Transfers
+
+
+// Connections
+//	The connections currently open, ordered by id.
+func (srv *QuicServer) Connections() []ConnectionInfo {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	transfers := make(map[uint64]int, len(srv.conns))
+	for _, transfer := range srv.transfers { transfers[transfer.connID]++ }
+
+	infos := make([]ConnectionInfo, 0, len(srv.conns))
+	for connID, tracked := range srv.conns {
+		infos = append(infos, ConnectionInfo{
+			ID: connID,
+			Remote: tracked.conn.RemoteAddr().String(),
+			Client: tracked.client,
+			Connected: tracked.connected,
+			Transfers: transfers[connID],
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Transfers
+//	The file transfers in progress, ordered by id, with the bytes sent so far.
+func (srv *QuicServer) Transfers() []TransferInfo {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	infos := make([]TransferInfo, 0, len(srv.transfers))
+	for _, transfer := range srv.transfers { infos = append(infos, transfer.info()) }
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// CancelTransfer
+//	Stop a file transfer in progress, leaving its connection and any other transfers on it open.
+//	Its comm stream and data streams are reset with CANCELED_ERROR, which clients do not retry.
+func (srv *QuicServer) CancelTransfer(id uint64) error {
+	srv.mu.Lock()
+	transfer, ok := srv.transfers[id]
+	srv.mu.Unlock()
+
+	if ! ok { return ErrTransferNotFound }
+
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+
+	if transfer.canceled { return nil }
+	transfer.canceled = true
+	transfer.cancel()
+
+	transfer.commStream.CancelRead(quic.StreamErrorCode(common.CANCELED_ERROR))
+	transfer.commStream.CancelWrite(quic.StreamErrorCode(common.CANCELED_ERROR))
+	for _, dataStream := range transfer.dataStreams { dataStream.CancelWrite(quic.StreamErrorCode(common.CANCELED_ERROR)) }
+
+	return nil
+}
+
+// trackTransfer
+//	Register a transfer so it can be listed and canceled, assigning it an id.
+func (srv *QuicServer) trackTransfer(transfer *activeTransfer) *activeTransfer {
+	transfer.id = atomic.AddUint64(&srv.transferCounter, 1)
+	transfer.started = time.Now()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.transfers[transfer.id] = transfer
+	return transfer
+}
+
+// untrackTransfer
+//	Remove a transfer once it has finished.
+func (srv *QuicServer) untrackTransfer(id uint64) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	delete(srv.transfers, id)
+}
+
+// addStream
+//	Register a data stream of the transfer, so it is reset if the transfer is canceled.
+//	Returns false if the transfer was already canceled, in which case the stream is reset right away.
+func (transfer *activeTransfer) addStream(dataStream quic.SendStream) bool {
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+
+	if transfer.canceled {
+		dataStream.CancelWrite(quic.StreamErrorCode(common.CANCELED_ERROR))
+		return false
+	}
+
+	transfer.dataStreams = append(transfer.dataStreams, dataStream)
+	return true
+}
+
+// isCanceled
+//	Check whether the transfer was canceled.
+func (transfer *activeTransfer) isCanceled() bool {
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+
+	return transfer.canceled
+}
+
+// info
+//	The state of the transfer as listed by the admin api.
+func (transfer *activeTransfer) info() TransferInfo {
+	streams := 0
+	if transfer.streams != nil { streams = transfer.streams.activeStreams() }
+
+	return TransferInfo{
+		ID: transfer.id,
+		ConnID: transfer.connID,
+		Client: transfer.client,
+		Path: transfer.path,
+		Export: transfer.export,
+		Size: transfer.size,
+		Sent: transfer.sent.Value(),
+		Streams: streams,
+		Started: transfer.started,
+	}
+}
@@ -1,9 +1,24 @@
 package srv
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
 
 	"github.com/quic-go/quic-go"
+
+	"github.com/sirgallo/quicfiletransfer/common"
+	"github.com/sirgallo/quicfiletransfer/common/logger"
+	"github.com/sirgallo/quicfiletransfer/common/metrics"
+	"github.com/sirgallo/quicfiletransfer/common/pool"
+	"github.com/sirgallo/quicfiletransfer/common/protocol"
+	"github.com/sirgallo/quicfiletransfer/common/ratelimit"
+	"github.com/sirgallo/quicfiletransfer/common/tuning"
 )
 
 
@@ -17,13 +32,463 @@ type QuicServerOpts struct {
 	TlsCert *tls.Certificate
 	// EnableTracer: adds a file logger to capture events on the http3 server
 	EnableTracer bool
+	// Logger: optional structured logger. If not provided, the server is silent
+	Logger logger.Logger
+	// MaxStreamsPerConnection: the most data streams open at once across all transfers on a connection
+	MaxStreamsPerConnection int
+	// MaxStreamsPerRequest: the most data streams open at once for a single transfer
+	MaxStreamsPerRequest int
+	// RateLimits: the bandwidth limits for data sent by the server. Can be changed at runtime with SetRateLimits
+	RateLimits RateLimits
+	// RateSchedule: daily windows with their own rate limits, checked continuously. Outside every window, RateLimits applies
+	RateSchedule []RateWindow
+	// Exports: the directories files are served from. If empty, any path the server can read is served
+	Exports []Export
+	// ClientCAs: the certificate authorities client certificates are verified against. If not provided, clients are identified by remote ip
+	ClientCAs *x509.CertPool
+	// RequireClientCert: refuse clients that do not present a certificate signed by ClientCAs
+	RequireClientCert bool
+	// Tuning: quic transport tuning. Zero values keep the server defaults
+	Tuning tuning.Options
+	// AuditLog: optional writer receiving an AuditRecord as a line of JSON for every request, like a rotate.Writer. Records are written one at a time
+	AuditLog io.Writer
+}
+
+// Export: a directory the server serves files from
+type Export struct {
+	// Name: identifies the export in logs
+	Name string `json:"name"`
+	// Path: the absolute path of the directory. Requested paths are checked against it with symlinks resolved, so links cannot escape it
+	Path string `json:"path"`
+	// Clients: the client identities allowed to read from the export, like cn:alice for a verified certificate or ip:10.0.0.5. If empty, every client is allowed
+	Clients []string `json:"clients"`
+}
+
+// Config: the server configuration file, in JSON. Every field is optional, and flags given on the command line override it
+type Config struct {
+	Listen ListenConfig `json:"listen"`
+	TLS TLSConfig `json:"tls"`
+	Exports []Export `json:"exports"`
+	Limits LimitsConfig `json:"limits"`
+	Rates RatesConfig `json:"rates"`
+	Quic QuicConfig `json:"quic"`
+	Log LogConfig `json:"log"`
+	Metrics MetricsConfig `json:"metrics"`
+	Admin AdminConfig `json:"admin"`
+	Audit AuditConfig `json:"audit"`
+	// ShutdownTimeout: how long to wait for in flight transfers on shutdown before closing connections, like "30s"
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+// ListenConfig: the address the server listens on
+type ListenConfig struct {
+	Host string `json:"host"`
+	Port int `json:"port"`
+}
+
+// TLSConfig: the server certificate and client verification. Without a cert and key, a self signed cert is generated for Org
+type TLSConfig struct {
+	CertPath string `json:"certPath"`
+	KeyPath string `json:"keyPath"`
+	Org string `json:"org"`
+	// ClientCAPath: a pem file of the certificate authorities client certificates are verified against
+	ClientCAPath string `json:"clientCAPath"`
+	// RequireClientCert: refuse clients without a verified certificate. Requires ClientCAPath
+	RequireClientCert bool `json:"requireClientCert"`
+}
+
+// LimitsConfig: the data stream limits, see QuicServerOpts
+type LimitsConfig struct {
+	MaxStreamsPerConnection int `json:"maxStreamsPerConnection"`
+	MaxStreamsPerRequest int `json:"maxStreamsPerRequest"`
+}
+
+// RatesConfig: the bandwidth limits in MB per second, 0 is unlimited, along with a schedule in the format of ParseRateSchedule
+type RatesConfig struct {
+	MaxRate float64 `json:"maxRate"`
+	MaxRatePerConnection float64 `json:"maxRatePerConnection"`
+	MaxRatePerClient float64 `json:"maxRatePerClient"`
+	Schedule string `json:"schedule"`
+}
+
+// QuicConfig: quic transport tuning, see tuning.Options. Windows are in bytes. Fields that are set override the preset, default or wan
+type QuicConfig struct {
+	Preset string `json:"preset"`
+	KeepAlivePeriod Duration `json:"keepAlivePeriod"`
+	MaxIdleTimeout Duration `json:"maxIdleTimeout"`
+	InitialStreamReceiveWindow uint64 `json:"initialStreamReceiveWindow"`
+	MaxStreamReceiveWindow uint64 `json:"maxStreamReceiveWindow"`
+	InitialConnectionReceiveWindow uint64 `json:"initialConnectionReceiveWindow"`
+	MaxConnectionReceiveWindow uint64 `json:"maxConnectionReceiveWindow"`
+	MaxIncomingUniStreams int64 `json:"maxIncomingUniStreams"`
+	HandshakeTimeout Duration `json:"handshakeTimeout"`
+}
+
+// LogConfig: server logging
+type LogConfig struct {
+	// Level: the minimum level to output, one of debug, info, warn, error, silent
+	Level string `json:"level"`
+	// Path: a file to append logs to. If empty, logs go to stderr
+	Path string `json:"path"`
+	// Tracer: write a qlog file for every connection to the working directory
+	Tracer bool `json:"tracer"`
+}
+
+// AdminConfig: where the admin api is served. At most one of Socket and Listen may be set, and if neither is, the admin api is not served
+type AdminConfig struct {
+	// Socket: the path of a unix socket to serve the admin api on, only accessible to the user running the server
+	Socket string `json:"socket"`
+	// Listen: the host:port to serve the admin api on over http, which should only be reachable by operators since requests are not authenticated
+	Listen string `json:"listen"`
+}
+
+// AuditConfig: the audit log, recording every request made to the server
+type AuditConfig struct {
+	// Path: the file to append audit records to. If empty, requests are not audited
+	Path string `json:"path"`
+	// MaxSizeMB: the size the file grows to before it is rotated
+	MaxSizeMB int `json:"maxSizeMB"`
+	// MaxFiles: the most rotated files to keep, removing the oldest. 0 keeps every rotated file
+	MaxFiles int `json:"maxFiles"`
+}
+
+// MetricsConfig: the http listener serving the server's metrics for prometheus
+type MetricsConfig struct {
+	// Listen: the host:port to serve metrics on, like 127.0.0.1:9100. If empty, metrics are not served
+	Listen string `json:"listen"`
+	// Path: the path metrics are served at
+	Path string `json:"path"`
+}
+
+// Duration: a time.Duration written in config files as a string, like "30s" or "1m30s"
+type Duration time.Duration
+
+// RateLimits: bandwidth limits for data sent by the server, in bytes per second. 0 is unlimited
+type RateLimits struct {
+	// Global: the limit across every connection to the server
+	Global int64 `json:"global"`
+	// PerConnection: the limit across every transfer on a single connection
+	PerConnection int64 `json:"perConnection"`
+	// PerClient: the limit across every connection from the same client, identified by its verified certificate common name or otherwise its remote ip
+	PerClient int64 `json:"perClient"`
 }
 
 // QuicServer: the quic server implementation
 type QuicServer struct {
+	transport *quic.Transport
+	udpConn *net.UDPConn
 	listener *quic.EarlyListener
 	host string
 	port int
+	logger logger.Logger
+	connCounter uint64
+	maxStreamsPerConnection int
+	maxStreamsPerRequest int
+	bufferPool *pool.BufferPool
+	limiters *rateLimiters
+	exports []Export
+	transferCounter uint64
+	started time.Time
+	mu sync.Mutex
+	conns map[uint64]*trackedConn
+	transfers map[uint64]*activeTransfer
+	state ServerState
+	ready chan struct{}
+	done chan struct{}
+	closeOnce sync.Once
+	closeErr error
+	metrics *serverMetrics
+	auditLog io.Writer
+	auditMu sync.Mutex
+}
+
+// ServerState: the lifecycle state of the server
+type ServerState uint8
+
+const (
+	// SERVER_NEW: created, but not yet accepting connections
+	SERVER_NEW ServerState = iota
+	// SERVER_SERVING: accepting connections
+	SERVER_SERVING
+	// SERVER_DRAINING: no longer accepting connections or requests, waiting for in flight transfers
+	SERVER_DRAINING
+	// SERVER_STOPPED: every connection and the udp connection are closed
+	SERVER_STOPPED
+)
+
+// trackedConn: an open connection, kept so it can be drained on shutdown and listed by the admin api
+type trackedConn struct {
+	conn quic.Connection
+	client string
+	connected time.Time
+	// requests: the requests in flight on the connection, of any kind
+	requests int
+	// idleSince: when the last request in flight on the connection finished
+	idleSince time.Time
+}
+
+// activeTransfer: a file transfer in progress, kept so it can be listed and canceled by the admin api
+type activeTransfer struct {
+	id uint64
+	connID uint64
+	client string
+	path string
+	export string
+	size uint64
+	started time.Time
+	sent metrics.Counter
+	streams *transferStreams
+	cancel context.CancelFunc
+	mu sync.Mutex
+	canceled bool
+	commStream quic.Stream
+	dataStreams []quic.SendStream
+}
+
+// ConnectionInfo: an open connection, as listed by the admin api
+type ConnectionInfo struct {
+	ID uint64 `json:"id"`
+	Remote string `json:"remote"`
+	Client string `json:"client"`
+	Connected time.Time `json:"connected"`
+	Transfers int `json:"transfers"`
+}
+
+// TransferInfo: a file transfer in progress, as listed by the admin api
+type TransferInfo struct {
+	ID uint64 `json:"id"`
+	ConnID uint64 `json:"connId"`
+	Client string `json:"client"`
+	Path string `json:"path"`
+	Export string `json:"export"`
+	// Size: the bytes of file data requested, with holes in sparse files left out
+	Size uint64 `json:"size"`
+	// Sent: the bytes of file data sent so far, before compression
+	Sent uint64 `json:"sent"`
+	Streams int `json:"streams"`
+	Started time.Time `json:"started"`
+}
+
+// BuildInfo: the version of the server binary, read from the build information embedded by the go toolchain
+type BuildInfo struct {
+	Module string `json:"module"`
+	Version string `json:"version"`
+	Revision string `json:"revision"`
+	RevisionTime string `json:"revisionTime"`
+	Modified bool `json:"modified"`
+	GoVersion string `json:"goVersion"`
+}
+
+// ServerInfo: the state of the server, as reported by the admin api
+type ServerInfo struct {
+	Build BuildInfo `json:"build"`
+	State string `json:"state"`
+	Started time.Time `json:"started"`
+	Connections int `json:"connections"`
+	Transfers int `json:"transfers"`
+	Rates RateStatus `json:"rates"`
+}
+
+// RateStatus: the rate limits in effect, and the limits that apply outside of scheduled windows
+type RateStatus struct {
+	Current RateLimits `json:"current"`
+	Base RateLimits `json:"base"`
+	WindowActive bool `json:"windowActive"`
+}
+
+// AdminOpts: the options for the admin api
+type AdminOpts struct {
+	// Reload: reloads the configuration of the server, usually by reading the config file again and calling ApplyConfig. If not provided, reloading is not supported
+	Reload func() error
+}
+
+// AdminError: the body of an admin api error response
+type AdminError struct {
+	Error string `json:"error"`
+}
+
+// AuditRecord: a request made to the server, as written to the audit log once it finishes
+type AuditRecord struct {
+	// Time: when the request was received
+	Time time.Time `json:"time"`
+	Client string `json:"client"`
+	Remote string `json:"remote"`
+	ConnID uint64 `json:"connId"`
+	// TransferID: the id of a file transfer, as listed by the admin api
+	TransferID uint64 `json:"transferId,omitempty"`
+	// Operation: one of file, delta, or list. A request that cannot be read is unknown, and a message that is not a request is invalid
+	Operation string `json:"operation"`
+	Path string `json:"path"`
+	Export string `json:"export,omitempty"`
+	// Ranges: the byte ranges of a file request, or the whole file if the client requested all of it
+	Ranges []AuditRange `json:"ranges,omitempty"`
+	// Size: the size of the requested file
+	Size uint64 `json:"size,omitempty"`
+	// Bytes: the bytes of file data sent, before compression
+	Bytes uint64 `json:"bytes"`
+	// Md5: the md5 of the requested file, in hex
+	Md5 string `json:"md5,omitempty"`
+	// Entries: the entries sent in the manifest of a list request
+	Entries int `json:"entries,omitempty"`
+	Duration float64 `json:"durationSeconds"`
+	// Outcome: one of complete, failed, canceled, or denied
+	Outcome string `json:"outcome"`
+	Error string `json:"error,omitempty"`
+}
+
+// AuditRange: a byte range of a file
+type AuditRange struct {
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+}
+
+// serverMetrics: the metrics collected by the server
+type serverMetrics struct {
+	registry *metrics.Registry
+	connectionsActive *metrics.Gauge
+	connections *metrics.Counter
+	handshakes *metrics.CounterVec
+	handshakeDuration *metrics.Histogram
+	connectionErrors *metrics.CounterVec
+	transfersActive *metrics.Gauge
+	transfers *metrics.CounterVec
+	sentBytes *metrics.CounterVec
+	streamThroughput *metrics.Histogram
+}
+
+// meteredWriter: a writer that counts the bytes written through it, for the sent bytes of a client and the throughput of a data stream
+type meteredWriter struct {
+	w io.Writer
+	sent *metrics.Counter
+	written uint64
+}
+
+// RateWindow: a time of day window, in the server's local time, with its own rate limits
+type RateWindow struct {
+	// Days: the days of the week the window starts on. If empty, the window applies every day
+	Days []time.Weekday
+	// Start: the offset from midnight the window begins at
+	Start time.Duration
+	// End: the offset from midnight the window ends at. If before Start, the window runs past midnight into the next day
+	End time.Duration
+	// Global: the global limit while the window is active, in bytes per second. The per connection and per client limits are kept
+	Global int64
+}
+
+// rateLimiters: the token buckets shared by every data stream on the server
+type rateLimiters struct {
+	mu sync.Mutex
+	base RateLimits
+	schedule []RateWindow
+	limits RateLimits
+	global *ratelimit.Limiter
+	connections map[uint64]*ratelimit.Limiter
+	clients map[string]*clientLimiter
+}
+
+// clientLimiter: the token bucket for a client identity, kept while the client has open connections
+type clientLimiter struct {
+	limiter *ratelimit.Limiter
+	connections int
+}
+
+// workQueue: the shared queue of work units for a single transfer, pulled from by each data stream
+type workQueue struct {
+	mu sync.Mutex
+	units []protocol.Range
+	position int
 }
 
-const STREAM_CHUNK_BUFFER_SIZE = 1024 * 1024 * 2 // 2KiB
\ No newline at end of file
+// transferStreams: the data streams serving a single transfer
+type transferStreams struct {
+	mu sync.Mutex
+	cond *sync.Cond
+	budget *streamBudget
+	maxStreams int
+	reserved int
+	opened int
+	active int
+	pendingRetire int
+	finished bool
+}
+
+// streamBudget: the data stream slots available on a single connection, shared by every transfer on it
+type streamBudget struct {
+	mu sync.Mutex
+	cond *sync.Cond
+	available int
+}
+
+const STREAM_CHUNK_BUFFER_SIZE = 1024 * 1024 * 2 // 2MiB
+const WORK_UNIT_SIZE = 1024 * 1024 * 16 // 16MB
+const DEFAULT_MAX_STREAMS_PER_CONNECTION = 1024
+const DEFAULT_MAX_STREAMS_PER_REQUEST = 256
+const COMPRESSION_SAMPLE_COUNT = 8
+const COMPRESSION_SAMPLE_SIZE = 1024 * 64 // 64KiB
+const COMPRESSION_AUTO_MAX_RATIO = 0.9
+const RATE_SCHEDULE_INTERVAL = 1 * time.Second
+const MANIFEST_BATCH_SIZE = 1024
+const MIN_HOLE_SIZE = 1024 * 64 // 64KiB
+const MAX_EXTENTS = 1024 * 64
+const SHUTDOWN_POLL_INTERVAL = 100 * time.Millisecond
+const SHUTDOWN_REASON = "server shutting down"
+const SHUTDOWN_IDLE_GRACE = 2 * time.Second // data sent just before a request finished may still be in flight
+const ACCEPT_INITIAL_BACKOFF = 5 * time.Millisecond
+const ACCEPT_MAX_BACKOFF = 1 * time.Second
+const ACCEPT_MAX_FAILURES = 10
+const DEFAULT_KEEP_ALIVE_PERIOD = 3 * time.Second
+const DEFAULT_HOST = "0.0.0.0"
+const DEFAULT_PORT = 1234
+const DEFAULT_ORG = "test"
+const DEFAULT_LOG_LEVEL = "info"
+const DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+const MB = 1024 * 1024
+const CLIENT_CN_PREFIX = "cn:"
+const CLIENT_IP_PREFIX = "ip:"
+const DEFAULT_METRICS_PATH = "/metrics"
+const METRIC_PREFIX = "quicsrv_"
+const HANDSHAKE_BUCKET_START = 0.001 // 1ms
+const HANDSHAKE_BUCKET_COUNT = 14
+const THROUGHPUT_BUCKET_START = 1024 * 64 // 64KiB/s
+const THROUGHPUT_BUCKET_COUNT = 18
+const TRANSFER_RESULT_COMPLETE = "complete"
+const TRANSFER_RESULT_FAILED = "failed"
+const TRANSFER_RESULT_CANCELED = "canceled"
+const ADMIN_INFO_PATH = "/info"
+const ADMIN_CONNECTIONS_PATH = "/connections"
+const ADMIN_TRANSFERS_PATH = "/transfers"
+const ADMIN_CANCEL_SUFFIX = "/cancel"
+const ADMIN_RATES_PATH = "/rates"
+const ADMIN_RELOAD_PATH = "/reload"
+const AUDIT_OPERATION_FILE = "file"
+const AUDIT_OPERATION_DELTA = "delta"
+const AUDIT_OPERATION_LIST = "list"
+const AUDIT_OPERATION_UNKNOWN = "unknown"
+const AUDIT_OPERATION_INVALID = "invalid"
+const AUDIT_OUTCOME_DENIED = "denied"
+const DEFAULT_AUDIT_MAX_SIZE_MB = 100
+const ORIGIN_LOCAL = "local"
+const ORIGIN_REMOTE = "remote"
+
+
+var applicationErrorNames = map[quic.ApplicationErrorCode]string{
+	common.NO_ERROR: "no_error",
+	common.INTERNAL_ERROR: "internal_error",
+	common.CONNECTION_ERROR: "connection_error",
+	common.TRANSPORT_ERROR: "transport_error",
+	common.SHUTDOWN_ERROR: "shutdown",
+	common.ACCESS_DENIED_ERROR: "access_denied",
+	common.CANCELED_ERROR: "canceled",
+	common.PROTOCOL_ERROR: "protocol_error",
+}
+
+
+var ErrServerClosed = errors.New("server closed")
+var ErrAccessDenied = errors.New("access denied")
+var ErrInvalidExport = errors.New("export must have a name and an existing directory as its path")
+var ErrInvalidConfig = errors.New("invalid config")
+var ErrTransferNotFound = errors.New("transfer not found")
+var ErrTransferCanceled = errors.New("transfer canceled")
+var ErrReloadUnsupported = errors.New("reloading the configuration is not supported")
+var ErrNegativeRate = errors.New("rate limits cannot be negative")
+var ErrMethodNotAllowed = errors.New("method not allowed")